@@ -7,6 +7,8 @@ import (
 	"time"
 
 	"github.com/ebml-go/webm"
+	"github.com/xlab/libvpx-go/vpx"
+	"github.com/xlab/libvpx-go/webmwriter"
 )
 
 type Stream interface {
@@ -24,12 +26,27 @@ type webmStream struct {
 
 	reader *webm.Reader
 	rebase chan time.Duration
+	// packets demuxed from the reader, drained on seek
+	vPackets chan webm.Packet
+	aPackets chan webm.Packet
 }
 
 func NewStream(r io.ReadSeeker) (Stream, error) {
 	s := &webmStream{
 		rebase: make(chan time.Duration, 10),
 	}
+	start, err := r.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return nil, err
+	}
+	// the webm package does not decode the Colour element of the video tracks
+	colours, err := webmwriter.ReadTrackColours(r)
+	if err != nil {
+		log.Println("[WARN] webm: failed to read the track colours:", err)
+	}
+	if _, err := r.Seek(start, io.SeekStart); err != nil {
+		return nil, err
+	}
 	reader, err := webm.Parse(r, &s.meta)
 	if err != nil {
 		err = fmt.Errorf("parse error: %v", err)
@@ -40,11 +57,18 @@ func NewStream(r io.ReadSeeker) (Stream, error) {
 	atrack := s.meta.FindFirstAudioTrack()
 	vPackets := make(chan webm.Packet, 32)
 	aPackets := make(chan webm.Packet, 32)
+	s.vPackets, s.aPackets = vPackets, aPackets
 	if vtrack != nil {
 		log.Printf("webm: found video track: %dx%d dur: %v %s", vtrack.DisplayWidth,
 			vtrack.DisplayHeight, s.meta.Segment.GetDuration(), vtrack.CodecID)
+		var colour vpx.ColorInfo
+		if c, ok := colours[vtrack.TrackNumber]; ok {
+			colour = c.ColorInfo()
+			log.Printf("webm: video colour: matrix %d, transfer %d, primaries %d",
+				colour.Matrix, colour.Transfer, colour.Primaries)
+		}
 
-		s.vdec = NewVDecoder(VCodec(vtrack.CodecID), vPackets)
+		s.vdec = NewVDecoder(VCodec(vtrack.CodecID), colour, vPackets)
 	}
 	if atrack != nil {
 		log.Printf("webm: found audio track: ch: %d %.1fHz, dur: %v, codec: %s", atrack.Channels,
@@ -88,11 +112,28 @@ func (s *webmStream) ADecoder() *ADecoder {
 	return s.adec
 }
 
+// Seek drops the packets demuxed before the seek, the few still buffered by the reader
+// are inter frames the video decoder skips until the keyframe at the new position.
 func (s *webmStream) Seek(d time.Duration) {
+	if s.vdec != nil {
+		s.vdec.Seek()
+	}
+	drain(s.vPackets)
+	drain(s.aPackets)
 	s.reader.Seek(d)
 	s.rebase <- d
 }
 
+func drain(packets chan webm.Packet) {
+	for {
+		select {
+		case <-packets:
+		default:
+			return
+		}
+	}
+}
+
 func (s *webmStream) Rebase() <-chan time.Duration {
 	return s.rebase
 }
@@ -6,6 +6,8 @@ import (
 	"time"
 
 	"github.com/ebml-go/webm"
+	"github.com/xlab/libvpx-go/vp8"
+	"github.com/xlab/libvpx-go/vp9"
 	"github.com/xlab/libvpx-go/vpx"
 )
 
@@ -13,14 +15,22 @@ type Frame struct {
 	*image.RGBA
 	Timecode   time.Duration
 	IsKeyframe bool
+	Color      vpx.ColorInfo
+	// DisplayWidth and DisplayHeight are the render size coded in the stream,
+	// the frame is stretched to it when it differs from the coded size.
+	DisplayWidth  uint32
+	DisplayHeight uint32
 }
 
 type VDecoder struct {
 	enabled bool
+	codec   VCodec
 
 	src   <-chan webm.Packet
-	ctx   *vpx.CodecCtx
-	iface *vpx.CodecIface
+	dec   *vpx.Decoder
+	seekC chan struct{}
+	// color is the colour of the track in the container, if any
+	color vpx.ColorInfo
 }
 
 type VCodec string
@@ -31,50 +41,109 @@ const (
 	CodecVP10 VCodec = "V_VP10"
 )
 
-func NewVDecoder(codec VCodec, src <-chan webm.Packet) *VDecoder {
+func NewVDecoder(codec VCodec, color vpx.ColorInfo, src <-chan webm.Packet) *VDecoder {
 	dec := &VDecoder{
-		src: src,
-		ctx: vpx.NewCodecCtx(),
+		codec: codec,
+		src:   src,
+		color: color,
+		seekC: make(chan struct{}, 1),
 	}
+	var iface *vpx.CodecIface
+	var cfg vpx.DecoderConfig
 	switch codec {
 	case CodecVP8:
-		dec.iface = vpx.DecoderIfaceVP8()
+		iface = vpx.DecoderIfaceVP8()
 	case CodecVP9:
-		dec.iface = vpx.DecoderIfaceVP9()
+		iface = vpx.DecoderIfaceVP9()
 	default: // others are currently disabled
 		log.Println("[WARN] unsupported VPX codec:", codec)
 		return dec
 	}
-	err := vpx.Error(vpx.CodecDecInitVer(dec.ctx, dec.iface, nil, 0, vpx.DecoderABIVersion))
+	d, err := vpx.NewDecoder(iface, cfg)
 	if err != nil {
 		log.Println("[WARN]", err)
 		return dec
 	}
+	dec.dec = d
 	dec.enabled = true
 	return dec
 }
 
+// Seek makes the decoder drop the frames it still holds before the stream position changes
+// and skip the packets up to the next keyframe.
+func (v *VDecoder) Seek() {
+	select {
+	case v.seekC <- struct{}{}:
+	default:
+	}
+}
+
 func (v *VDecoder) Process(out chan<- Frame) {
 	defer close(out)
+	if v.dec != nil {
+		defer v.dec.Close()
+	}
+	var seeking bool
 	for pkt := range v.src {
 		if !v.enabled {
 			continue
 		}
-		dataSize := uint32(len(pkt.Data))
-		err := vpx.Error(vpx.CodecDecode(v.ctx, string(pkt.Data), dataSize, nil, 0))
+		select {
+		case <-v.seekC:
+			if err := v.dec.Flush(); err == nil {
+				for v.dec.NextFrame() != nil {
+				}
+			}
+			seeking = true
+		default:
+		}
+		if seeking {
+			// packets read before the seek may still come, decoding
+			// resumes at the keyframe of the new position
+			if !v.isKeyframe(pkt.Data) {
+				continue
+			}
+			seeking = false
+		}
+		err := v.dec.DecodePts(pkt.Data, vpx.CodecPts(pkt.Timecode))
 		if err != nil {
 			log.Println("[WARN]", err)
 			continue
 		}
-		var iter vpx.CodecIter
-		img := vpx.CodecGetFrame(v.ctx, &iter)
-		for img != nil {
-			img.Deref()
-			out <- Frame{
-				RGBA:     img.ImageRGBA(),
-				Timecode: pkt.Timecode,
-			}
-			img = vpx.CodecGetFrame(v.ctx, &iter)
+		v.emitFrames(out)
+	}
+	if v.enabled {
+		// drain the frames still held by the decoder
+		if err := v.dec.Flush(); err != nil {
+			log.Println("[WARN]", err)
+			return
+		}
+		v.emitFrames(out)
+	}
+}
+
+func (v *VDecoder) isKeyframe(data []byte) bool {
+	switch v.codec {
+	case CodecVP8:
+		h, err := vp8.ParseFrameHeader(data)
+		return err == nil && h.KeyFrame
+	case CodecVP9:
+		h, _ := vp9.ParseHeader(data)
+		return h != nil && h.IsKeyframe()
+	}
+	return false
+}
+
+func (v *VDecoder) emitFrames(out chan<- Frame) {
+	for frame := v.dec.NextFrame(); frame != nil; frame = v.dec.NextFrame() {
+		color := frame.Color.WithContainer(v.color)
+		out <- Frame{
+			RGBA:     frame.ImageRGBAColor(color),
+			Timecode: time.Duration(frame.Pts),
+			Color:    color,
+
+			DisplayWidth:  frame.DisplayWidth,
+			DisplayHeight: frame.DisplayHeight,
 		}
 	}
 }
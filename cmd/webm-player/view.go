@@ -109,16 +109,16 @@ func (v *View) nkStep() {
 	if nk.NkBegin(v.ctx, windowName, bounds, nk.WindowNoScrollbar) > 0 {
 		nk.NkWindowSetBounds(v.ctx, bounds)
 		nk.NkWindowCollapse(v.ctx, windowName, nk.Maximized)
-		viewWidth, viewHeight := letterbox(float32(v.width), float32(v.height),
-			float32(width), float32(height)-panelHeight)
-
 		v.frameMux.RLock()
 		if v.frame == nil {
 			// Draw logo if no frame yet
 			nk.NkLayoutRowStatic(v.ctx, 200, 200, 1)
 			nk.NkImage(v.ctx, v.bgImg)
 		} else {
-			// Display frame as image
+			// Display frame as image, stretched to its display aspect ratio
+			dispWidth, dispHeight := v.displaySize(v.frame)
+			viewWidth, viewHeight := letterbox(dispWidth, dispHeight,
+				float32(width), float32(height)-panelHeight)
 			v.frameImg = rgbaTex(&v.frameTex, v.frame.RGBA)
 			nk.NkLayoutRowStatic(v.ctx, viewHeight, int32(viewWidth), 1)
 			nk.NkImage(v.ctx, v.frameImg)
@@ -199,18 +199,32 @@ func (v *View) getPos() (vPos, curPos, maxPos int32) {
 	return
 }
 
+// displaySize returns the size the frame should be shown at. The render size coded
+// in the stream takes precedence when it differs from the coded size, then comes
+// the display size of the container track, which applies to the whole stream.
+func (v *View) displaySize(f *Frame) (float32, float32) {
+	coded := f.Bounds()
+	w, h := float32(coded.Dx()), float32(coded.Dy())
+	switch {
+	case f.DisplayWidth > 0 && f.DisplayHeight > 0 &&
+		(int(f.DisplayWidth) != coded.Dx() || int(f.DisplayHeight) != coded.Dy()):
+		return float32(f.DisplayWidth), float32(f.DisplayHeight)
+	case v.width > 0 && v.height > 0:
+		return float32(v.width), float32(v.height)
+	}
+	return w, h
+}
+
+// letterbox fits the content into the box keeping its aspect ratio.
 func letterbox(contentW, contentH float32, boxW, boxH float32) (float32, float32) {
+	if contentW <= 0 || contentH <= 0 || boxW <= 0 || boxH <= 0 {
+		return boxW, boxH
+	}
 	ratio := contentH / contentW
-	if contentW > boxW {
-		contentH -= ratio * (contentW - boxW)
-		contentW = boxW
-		return contentW, contentH
-	} else if contentW < boxW {
-		contentH += ratio * (boxW - contentW)
-		contentW = boxW
-		return contentW, contentH
+	if boxW*ratio <= boxH {
+		return boxW, boxW * ratio
 	}
-	return boxW, boxW * ratio
+	return boxH / ratio, boxH
 }
 
 func rgbaTex(tex *uint32, rgba *image.RGBA) nk.Image {
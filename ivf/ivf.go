@@ -0,0 +1,103 @@
+// Package ivf implements reading and writing of IVF files, the simple
+// container used by vpxenc, vpxdec and the libvpx test vectors.
+package ivf
+
+import (
+	"encoding/binary"
+	"errors"
+
+	"github.com/xlab/libvpx-go/vpx"
+)
+
+const (
+	signature       = "DKIF"
+	fileHeaderSize  = 32
+	frameHeaderSize = 12
+
+	frameCountOffset = 24
+
+	// maxFrameSize guards against corrupted frame headers, same as vpxdec does.
+	maxFrameSize = 256 * 1024 * 1024
+)
+
+var (
+	ErrInvalidSignature   = errors.New("ivf: invalid file signature")
+	ErrInvalidHeader      = errors.New("ivf: invalid file header")
+	ErrUnsupportedFourCC  = errors.New("ivf: unsupported fourcc")
+	ErrInvalidFrameHeader = errors.New("ivf: invalid frame header")
+	ErrNotSeekable        = errors.New("ivf: underlying stream is not seekable")
+	ErrFrameOutOfRange    = errors.New("ivf: frame index out of range")
+	ErrWriterClosed       = errors.New("ivf: writer is closed")
+	ErrFrameSizeTooLarge  = errors.New("ivf: frame size does not fit the file header")
+)
+
+// FileHeader is the 32-byte header found at the beginning of every IVF file.
+// The timebase of frame timestamps is TimebaseNum/TimebaseDen seconds.
+type FileHeader struct {
+	FourCC      uint32
+	Width       uint16
+	Height      uint16
+	TimebaseDen uint32
+	TimebaseNum uint32
+	FrameCount  uint32
+}
+
+// FrameHeader is the 12-byte header preceding every frame.
+type FrameHeader struct {
+	Size uint32
+	Pts  int64
+}
+
+// Frame is a single compressed frame read from an IVF file.
+type Frame struct {
+	FrameHeader
+	Data []byte
+}
+
+func (h *FileHeader) marshal() []byte {
+	buf := make([]byte, fileHeaderSize)
+	copy(buf[0:4], signature)
+	binary.LittleEndian.PutUint16(buf[4:], 0)
+	binary.LittleEndian.PutUint16(buf[6:], fileHeaderSize)
+	binary.LittleEndian.PutUint32(buf[8:], h.FourCC)
+	binary.LittleEndian.PutUint16(buf[12:], h.Width)
+	binary.LittleEndian.PutUint16(buf[14:], h.Height)
+	binary.LittleEndian.PutUint32(buf[16:], h.TimebaseDen)
+	binary.LittleEndian.PutUint32(buf[20:], h.TimebaseNum)
+	binary.LittleEndian.PutUint32(buf[24:], h.FrameCount)
+	return buf
+}
+
+func (h *FileHeader) unmarshal(buf []byte) error {
+	if string(buf[0:4]) != signature {
+		return ErrInvalidSignature
+	}
+	if binary.LittleEndian.Uint16(buf[4:]) != 0 ||
+		binary.LittleEndian.Uint16(buf[6:]) != fileHeaderSize {
+		return ErrInvalidHeader
+	}
+	h.FourCC = binary.LittleEndian.Uint32(buf[8:])
+	h.Width = binary.LittleEndian.Uint16(buf[12:])
+	h.Height = binary.LittleEndian.Uint16(buf[14:])
+	h.TimebaseDen = binary.LittleEndian.Uint32(buf[16:])
+	h.TimebaseNum = binary.LittleEndian.Uint32(buf[20:])
+	h.FrameCount = binary.LittleEndian.Uint32(buf[24:])
+	switch h.FourCC {
+	case vpx.Vp8Fourcc, vpx.Vp9Fourcc:
+	default:
+		return ErrUnsupportedFourCC
+	}
+	return nil
+}
+
+func (h *FrameHeader) marshal() []byte {
+	buf := make([]byte, frameHeaderSize)
+	binary.LittleEndian.PutUint32(buf[0:], h.Size)
+	binary.LittleEndian.PutUint64(buf[4:], uint64(h.Pts))
+	return buf
+}
+
+func (h *FrameHeader) unmarshal(buf []byte) {
+	h.Size = binary.LittleEndian.Uint32(buf[0:])
+	h.Pts = int64(binary.LittleEndian.Uint64(buf[4:]))
+}
@@ -0,0 +1,155 @@
+package ivf
+
+import "io"
+
+// Reader reads frames from an IVF stream. If the underlying reader implements
+// io.Seeker, frames can be accessed by index using SeekFrame, the frame index
+// is built lazily as the stream is read or seeked through.
+type Reader struct {
+	Header FileHeader
+
+	r      io.Reader
+	offset int64
+	frame  int
+
+	// index holds the byte offsets of frames seen so far, index[i] is the
+	// offset of the header of the i-th frame.
+	index []int64
+	eof   bool
+}
+
+// NewReader parses the file header from r and returns a Reader positioned
+// at the first frame.
+func NewReader(r io.Reader) (*Reader, error) {
+	buf := make([]byte, fileHeaderSize)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		if err == io.EOF || err == io.ErrUnexpectedEOF {
+			return nil, ErrInvalidHeader
+		}
+		return nil, err
+	}
+	reader := &Reader{
+		r:      r,
+		offset: fileHeaderSize,
+		index:  []int64{fileHeaderSize},
+	}
+	if err := reader.Header.unmarshal(buf); err != nil {
+		return nil, err
+	}
+	return reader, nil
+}
+
+// ReadFrame reads the next frame, it returns io.EOF when there are no more frames.
+func (r *Reader) ReadFrame() (*Frame, error) {
+	hdr, err := r.readFrameHeader()
+	if err != nil {
+		return nil, err
+	}
+	frame := &Frame{
+		FrameHeader: *hdr,
+		Data:        make([]byte, hdr.Size),
+	}
+	if _, err := io.ReadFull(r.r, frame.Data); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	r.advance(int64(hdr.Size))
+	return frame, nil
+}
+
+// Frame returns the index of the frame that will be returned by the next ReadFrame call.
+func (r *Reader) Frame() int {
+	return r.frame
+}
+
+// SeekFrame positions the reader so that the next ReadFrame call returns
+// the n-th frame (counting from zero). The underlying reader must implement io.Seeker.
+func (r *Reader) SeekFrame(n int) error {
+	seeker, ok := r.r.(io.Seeker)
+	if !ok {
+		return ErrNotSeekable
+	}
+	if n < 0 {
+		return ErrFrameOutOfRange
+	}
+	if n < len(r.index) {
+		return r.seekIndexed(seeker, n)
+	}
+	// scan forward from the last known frame, skipping the payloads
+	last := len(r.index) - 1
+	if err := r.seekIndexed(seeker, last); err != nil {
+		return err
+	}
+	for r.frame < n {
+		hdr, err := r.readFrameHeader()
+		if err == io.EOF {
+			return ErrFrameOutOfRange
+		} else if err != nil {
+			return err
+		}
+		if _, err := seeker.Seek(int64(hdr.Size), io.SeekCurrent); err != nil {
+			return err
+		}
+		r.advance(int64(hdr.Size))
+	}
+	return nil
+}
+
+// Count returns the number of frames in the stream. Unlike Header.FrameCount,
+// which may be missing in files written by live encoders, the value is computed
+// by indexing the whole stream. The current read position is preserved.
+func (r *Reader) Count() (int, error) {
+	seeker, ok := r.r.(io.Seeker)
+	if !ok {
+		return 0, ErrNotSeekable
+	}
+	pos := r.frame
+	if !r.eof {
+		if err := r.SeekFrame(int(^uint(0) >> 1)); err != ErrFrameOutOfRange {
+			return 0, err
+		}
+	}
+	count := len(r.index) - 1
+	if err := r.seekIndexed(seeker, pos); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+func (r *Reader) seekIndexed(seeker io.Seeker, n int) error {
+	if _, err := seeker.Seek(r.index[n], io.SeekStart); err != nil {
+		return err
+	}
+	r.offset = r.index[n]
+	r.frame = n
+	return nil
+}
+
+func (r *Reader) readFrameHeader() (*FrameHeader, error) {
+	buf := make([]byte, frameHeaderSize)
+	if _, err := io.ReadFull(r.r, buf); err != nil {
+		if err == io.EOF {
+			r.eof = true
+			return nil, io.EOF
+		} else if err == io.ErrUnexpectedEOF {
+			return nil, ErrInvalidFrameHeader
+		}
+		return nil, err
+	}
+	hdr := new(FrameHeader)
+	hdr.unmarshal(buf)
+	if hdr.Size > maxFrameSize {
+		return nil, ErrInvalidFrameHeader
+	}
+	return hdr, nil
+}
+
+func (r *Reader) advance(size int64) {
+	r.offset += frameHeaderSize + size
+	r.frame++
+	if r.frame == len(r.index) {
+		r.index = append(r.index, r.offset)
+	}
+}
@@ -0,0 +1,115 @@
+package ivf
+
+import (
+	"encoding/binary"
+	"io"
+	"math"
+
+	"github.com/xlab/libvpx-go/vpx"
+)
+
+// Writer writes frames into an IVF stream. The file header is written
+// on creation, if the underlying writer implements io.WriteSeeker the frame
+// count in the header is patched on Close.
+type Writer struct {
+	Header FileHeader
+
+	w      io.Writer
+	frames uint32
+	closed bool
+}
+
+// NewWriter writes the file header to w and returns a Writer ready to accept frames.
+func NewWriter(w io.Writer, header FileHeader) (*Writer, error) {
+	switch header.FourCC {
+	case vpx.Vp8Fourcc, vpx.Vp9Fourcc:
+	default:
+		return nil, ErrUnsupportedFourCC
+	}
+	if _, err := w.Write(header.marshal()); err != nil {
+		return nil, err
+	}
+	writer := &Writer{
+		Header: header,
+		w:      w,
+	}
+	return writer, nil
+}
+
+// NewWriterFromConfig is like NewWriter but takes frame dimensions and timebase
+// from the encoder configuration. The header holds 16-bit dimensions, larger
+// frames are rejected with ErrFrameSizeTooLarge.
+func NewWriterFromConfig(w io.Writer, fourcc uint32, cfg *vpx.CodecEncCfg) (*Writer, error) {
+	if cfg.GW > math.MaxUint16 || cfg.GH > math.MaxUint16 {
+		return nil, ErrFrameSizeTooLarge
+	}
+	return NewWriter(w, FileHeader{
+		FourCC:      fourcc,
+		Width:       uint16(cfg.GW),
+		Height:      uint16(cfg.GH),
+		TimebaseDen: uint32(cfg.GTimebase.Den),
+		TimebaseNum: uint32(cfg.GTimebase.Num),
+	})
+}
+
+// WriteFrame writes a single compressed frame with the given timestamp.
+func (w *Writer) WriteFrame(data []byte, pts int64) error {
+	if w.closed {
+		return ErrWriterClosed
+	}
+	hdr := FrameHeader{
+		Size: uint32(len(data)),
+		Pts:  pts,
+	}
+	if _, err := w.w.Write(hdr.marshal()); err != nil {
+		return err
+	}
+	if _, err := w.w.Write(data); err != nil {
+		return err
+	}
+	w.frames++
+	return nil
+}
+
+// WritePacket writes the compressed frame from an encoder output packet,
+// packets of other kinds are ignored.
+func (w *Writer) WritePacket(pkt *vpx.CodecCxPkt) error {
+	frame := pkt.Frame()
+	if frame == nil {
+		return nil
+	}
+	return w.WriteFrame(frame.Buf, int64(frame.Pts))
+}
+
+// Frames returns the number of frames written so far.
+func (w *Writer) Frames() uint32 {
+	return w.frames
+}
+
+// Close patches the frame count in the file header if the underlying writer
+// is seekable. It does not close the underlying writer.
+func (w *Writer) Close() error {
+	if w.closed {
+		return ErrWriterClosed
+	}
+	w.closed = true
+	w.Header.FrameCount = w.frames
+	seeker, ok := w.w.(io.WriteSeeker)
+	if !ok {
+		return nil
+	}
+	pos, err := seeker.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := seeker.Seek(frameCountOffset, io.SeekStart); err != nil {
+		return err
+	}
+	buf := make([]byte, 4)
+	binary.LittleEndian.PutUint32(buf, w.frames)
+	if _, err := seeker.Write(buf); err != nil {
+		return err
+	}
+	_, err = seeker.Seek(pos, io.SeekStart)
+	return err
+}
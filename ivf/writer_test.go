@@ -0,0 +1,47 @@
+package ivf
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/xlab/libvpx-go/vpx"
+)
+
+func TestNewWriterFromConfigSize(t *testing.T) {
+	tests := []struct {
+		w, h uint32
+		err  error
+	}{
+		{1920, 1080, nil},
+		{65535, 65535, nil},
+		{65536, 1080, ErrFrameSizeTooLarge},
+		{1920, 65536, ErrFrameSizeTooLarge},
+	}
+	for _, tt := range tests {
+		cfg := vpx.CodecEncCfg{
+			GW:        tt.w,
+			GH:        tt.h,
+			GTimebase: vpx.Rational{Num: 1, Den: 30},
+		}
+		var buf bytes.Buffer
+		w, err := NewWriterFromConfig(&buf, vpx.Vp9Fourcc, &cfg)
+		if err != tt.err {
+			t.Errorf("%dx%d: error %v, want %v", tt.w, tt.h, err, tt.err)
+			continue
+		}
+		if err != nil {
+			if buf.Len() != 0 {
+				t.Errorf("%dx%d: header written for a rejected size", tt.w, tt.h)
+			}
+			continue
+		}
+		r, err := NewReader(&buf)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if uint32(r.Header.Width) != tt.w || uint32(r.Header.Height) != tt.h || r.Header.TimebaseDen != 30 {
+			t.Errorf("%dx%d: header %+v", tt.w, tt.h, r.Header)
+		}
+		w.Close()
+	}
+}
@@ -0,0 +1,530 @@
+// Package jitter implements a jitter buffer for VP8 and VP9 RTP streams. It reorders
+// packets, assembles frames, waits for keyframes when references are lost and emits
+// frames in decode order, ready to be passed to vpx.CodecDecode.
+package jitter
+
+import (
+	"errors"
+	"sort"
+	"time"
+
+	"github.com/xlab/libvpx-go/rtpvp8"
+	"github.com/xlab/libvpx-go/rtpvp9"
+	"github.com/xlab/libvpx-go/vp9"
+)
+
+// Codec selects the RTP payload format of the stream.
+type Codec int
+
+const (
+	CodecVP8 Codec = iota
+	CodecVP9
+)
+
+const (
+	// DefaultLatency is the time a frame waits for its missing packets.
+	DefaultLatency = 100 * time.Millisecond
+	// DefaultKeyframeRetry is the minimum interval between keyframe requests.
+	DefaultKeyframeRetry = time.Second
+	// DefaultReorderDelay is the time a gap in sequence numbers waits for
+	// reordered packets before they are NACKed.
+	DefaultReorderDelay = 20 * time.Millisecond
+	// maxNACK limits the number of sequence numbers in a single NACK request.
+	maxNACK = 64
+)
+
+var ErrUnknownCodec = errors.New("jitter: unknown codec")
+
+// Packet is an RTP packet of the stream.
+type Packet struct {
+	SequenceNumber uint16
+	Timestamp      uint32
+	Marker         bool
+	Payload        []byte
+	// Arrival is the time the packet was received, the first packet of
+	// a frame starts its deadline.
+	Arrival time.Time
+}
+
+// RequestKind is the kind of feedback the buffer asks to send.
+type RequestKind int
+
+const (
+	// RequestNACK asks for a retransmission of the Missing packets.
+	RequestNACK RequestKind = iota
+	// RequestKeyframe asks for a keyframe, e.g. with RTCP PLI or FIR.
+	RequestKeyframe
+)
+
+// Request is a feedback message for the sender.
+type Request struct {
+	Kind    RequestKind
+	Missing []uint16
+}
+
+// Config holds the jitter buffer parameters.
+type Config struct {
+	Codec Codec
+	// Latency is how long a frame waits for its missing packets, counted from the
+	// arrival of its first packet, DefaultLatency is used if zero.
+	Latency time.Duration
+	// PartialFrames enables emitting frames with lost packets or missing references
+	// instead of dropping them. For VP8 the decoder must be initialized with
+	// vpx.CodecUseErrorConcealment, VP9 partial pictures only hold the layers
+	// received in full.
+	PartialFrames bool
+	// OnRequest is called synchronously from Push and Pop when the sender should
+	// retransmit packets or send a keyframe.
+	OnRequest func(Request)
+	// KeyframeRetry is the minimum interval between keyframe requests,
+	// DefaultKeyframeRetry is used if zero.
+	KeyframeRetry time.Duration
+	// ReorderDelay is how long missing packets may still arrive out of order before
+	// they are NACKed, counted from the arrival of the packet that revealed the gap,
+	// DefaultReorderDelay is used if zero.
+	ReorderDelay time.Duration
+}
+
+// Frame is a frame in decode order.
+type Frame struct {
+	Data      []byte
+	Timestamp uint32
+	KeyFrame  bool
+	// Partial is set when some packets of the frame were lost.
+	Partial bool
+	// MissingReferences is set when the frame uses references that were lost.
+	MissingReferences bool
+	FirstSeq          uint16
+	LastSeq           uint16
+}
+
+// Stats holds the buffer counters.
+type Stats struct {
+	Frames           int
+	PartialFrames    int
+	DroppedFrames    int
+	LatePackets      int
+	DuplicatePackets int
+	NACKedPackets    int
+	KeyframeRequests int
+}
+
+// unit is a packet with its payload descriptor parsed.
+type unit struct {
+	seq     int64
+	marker  bool
+	start   bool // first packet of the frame
+	layer   bool // first packet of a VP9 layer frame
+	end     bool // last packet of a VP9 layer frame
+	nonRef  bool
+	payload []byte
+}
+
+// pending is a frame being assembled, its packets share the timestamp.
+type pending struct {
+	ts       uint32
+	units    map[int64]*unit
+	first    int64
+	last     int64
+	start    int64
+	hasStart bool
+	end      int64
+	hasEnd   bool
+	nonRef   bool
+	arrival  time.Time
+}
+
+func (p *pending) complete() bool {
+	return p.hasStart && p.hasEnd && int64(len(p.units)) == p.end-p.start+1
+}
+
+// Buffer is a jitter buffer, it is not safe for concurrent use.
+type Buffer struct {
+	cfg    Config
+	refs   refTracker
+	frames map[uint32]*pending
+
+	highest    int64
+	hasHighest bool
+	// last is the sequence number of the last packet of the last frame
+	// emitted or dropped, lastTs is its timestamp and lastEnded is set
+	// if its last packet was received.
+	last      int64
+	lastTs    uint32
+	lastEnded bool
+	started   bool
+
+	// missing holds the sequence numbers not received yet with the
+	// time their gap was found.
+	missing map[int64]time.Time
+
+	keyRequested time.Time
+	stats        Stats
+}
+
+// New returns an empty jitter buffer.
+func New(cfg Config) (*Buffer, error) {
+	if cfg.Codec != CodecVP8 && cfg.Codec != CodecVP9 {
+		return nil, ErrUnknownCodec
+	}
+	if cfg.Latency <= 0 {
+		cfg.Latency = DefaultLatency
+	}
+	if cfg.KeyframeRetry <= 0 {
+		cfg.KeyframeRetry = DefaultKeyframeRetry
+	}
+	if cfg.ReorderDelay <= 0 {
+		cfg.ReorderDelay = DefaultReorderDelay
+	}
+	b := &Buffer{
+		cfg:     cfg,
+		refs:    newRefTracker(cfg.Codec),
+		frames:  make(map[uint32]*pending),
+		missing: make(map[int64]time.Time),
+	}
+	return b, nil
+}
+
+// Push adds a packet to the buffer. Packets of frames already emitted or dropped
+// are discarded. Gaps in sequence numbers are reported with a NACK request by Pop
+// if they are still missing after the reorder delay.
+func (b *Buffer) Push(pkt Packet) error {
+	u, err := b.parse(pkt)
+	if err != nil {
+		return err
+	}
+	delete(b.missing, u.seq)
+	if b.started && (u.seq <= b.last || pkt.Timestamp == b.lastTs) {
+		b.stats.LatePackets++
+		return nil
+	}
+	if !b.hasHighest {
+		b.highest, b.hasHighest = u.seq, true
+	} else if u.seq > b.highest {
+		if u.seq > b.highest+1 {
+			b.addMissing(b.highest+1, u.seq, pkt.Arrival)
+		}
+		b.highest = u.seq
+	}
+	p, ok := b.frames[pkt.Timestamp]
+	if !ok {
+		p = &pending{
+			ts:      pkt.Timestamp,
+			units:   make(map[int64]*unit),
+			first:   u.seq,
+			last:    u.seq,
+			arrival: pkt.Arrival,
+		}
+		b.frames[pkt.Timestamp] = p
+	}
+	if _, ok := p.units[u.seq]; ok {
+		b.stats.DuplicatePackets++
+		return nil
+	}
+	p.units[u.seq] = u
+	if u.seq < p.first {
+		p.first = u.seq
+	}
+	if u.seq > p.last {
+		p.last = u.seq
+	}
+	if u.start {
+		p.start, p.hasStart = u.seq, true
+	}
+	if u.marker {
+		p.end, p.hasEnd = u.seq, true
+	}
+	if u.nonRef {
+		p.nonRef = true
+	}
+	if pkt.Arrival.Before(p.arrival) {
+		p.arrival = pkt.Arrival
+	}
+	return nil
+}
+
+// Pop returns the next frame in decode order or nil if none is ready at the
+// given time. It should be called until it returns nil after every Push and
+// periodically to let the deadlines of incomplete frames expire.
+func (b *Buffer) Pop(now time.Time) *Frame {
+	b.sendNACK(now)
+	for {
+		p := b.earliest()
+		if p == nil {
+			return nil
+		}
+		contiguous := !b.started || (p.hasStart && p.start == b.last+1)
+		if p.complete() && contiguous {
+			if f := b.decide(p, false, now); f != nil {
+				return f
+			}
+			continue
+		}
+		if now.Sub(p.arrival) < b.cfg.Latency {
+			return nil
+		}
+		if b.started && b.lastEnded && p.hasStart && p.start > b.last+1 {
+			// whole frames after the end of the previous one were lost, if its
+			// end is unknown the gap may only be its missing tail
+			b.stats.DroppedFrames++
+			b.refs.lose(nil)
+		}
+		if p.complete() {
+			if f := b.decide(p, false, now); f != nil {
+				return f
+			}
+			continue
+		}
+		if b.cfg.PartialFrames && p.hasStart {
+			if f := b.decide(p, true, now); f != nil {
+				return f
+			}
+			continue
+		}
+		b.drop(p)
+	}
+}
+
+// Stats returns the buffer counters.
+func (b *Buffer) Stats() Stats {
+	return b.stats
+}
+
+// Reset drops all the packets, e.g. after a seek. The next frame must be a keyframe.
+func (b *Buffer) Reset() {
+	b.frames = make(map[uint32]*pending)
+	b.missing = make(map[int64]time.Time)
+	b.hasHighest = false
+	b.started = false
+	b.last, b.lastTs, b.lastEnded = 0, 0, false
+	b.keyRequested = time.Time{}
+	b.refs.reset()
+}
+
+func (b *Buffer) parse(pkt Packet) (*unit, error) {
+	u := &unit{
+		seq:    b.unwrap(pkt.SequenceNumber),
+		marker: pkt.Marker,
+	}
+	switch b.cfg.Codec {
+	case CodecVP8:
+		d, data, err := rtpvp8.ParseDescriptor(pkt.Payload)
+		if err != nil {
+			return nil, err
+		}
+		u.start = d.Start && d.PartID == 0
+		u.nonRef = d.NonReference
+		u.payload = data
+	case CodecVP9:
+		d, data, err := rtpvp9.ParseDescriptor(pkt.Payload)
+		if err != nil {
+			return nil, err
+		}
+		u.start = d.StartOfFrame && d.SID == 0
+		u.layer = d.StartOfFrame
+		u.end = d.EndOfFrame
+		u.payload = data
+	}
+	return u, nil
+}
+
+// unwrap extends a sequence number relative to the highest one received.
+func (b *Buffer) unwrap(seq uint16) int64 {
+	if !b.hasHighest {
+		return int64(seq)
+	}
+	return b.highest + int64(int16(seq-uint16(b.highest)))
+}
+
+func (b *Buffer) earliest() *pending {
+	var first *pending
+	for _, p := range b.frames {
+		if first == nil || p.first < first.first {
+			first = p
+		}
+	}
+	return first
+}
+
+// decide checks the references of an assembled frame and either returns it
+// or drops it and returns nil.
+func (b *Buffer) decide(p *pending, partial bool, now time.Time) *Frame {
+	data, truncated := b.assemble(p)
+	if data == nil {
+		b.drop(p)
+		return nil
+	}
+	keyframe, ok := b.refs.check(data)
+	f := &Frame{
+		Data:      data,
+		Timestamp: p.ts,
+		KeyFrame:  keyframe,
+		Partial:   partial || truncated,
+		FirstSeq:  uint16(p.start),
+		LastSeq:   uint16(p.last),
+	}
+	if !ok {
+		b.requestKeyframe(now)
+		if !b.cfg.PartialFrames {
+			b.drop(p)
+			return nil
+		}
+		f.MissingReferences = true
+	}
+	b.refs.update(data)
+	b.advance(p)
+	b.stats.Frames++
+	if f.Partial {
+		b.stats.PartialFrames++
+	}
+	return f
+}
+
+// assemble concatenates the payloads of the frame from its first packet up to the
+// first gap. For VP9 only complete layer frames are kept and combined into a superframe.
+// It reports whether the frame was truncated.
+func (b *Buffer) assemble(p *pending) ([]byte, bool) {
+	if !p.hasStart {
+		return nil, true
+	}
+	if b.cfg.Codec == CodecVP8 {
+		var data []byte
+		seq := p.start
+		for ; ; seq++ {
+			u, ok := p.units[seq]
+			if !ok {
+				break
+			}
+			data = append(data, u.payload...)
+			if u.marker {
+				return data, false
+			}
+		}
+		return data, true
+	}
+	var layers [][]byte
+	var cur []byte
+	for seq := p.start; ; seq++ {
+		u, ok := p.units[seq]
+		if !ok {
+			break
+		}
+		if u.layer {
+			cur = nil
+		}
+		cur = append(cur, u.payload...)
+		if u.end || u.marker {
+			layers = append(layers, cur)
+			cur = nil
+		}
+		if u.marker {
+			data, err := superframe(layers)
+			if err != nil {
+				return nil, true
+			}
+			return data, false
+		}
+	}
+	if len(layers) == 0 {
+		return nil, true
+	}
+	data, err := superframe(layers)
+	if err != nil {
+		return nil, true
+	}
+	return data, true
+}
+
+func superframe(layers [][]byte) ([]byte, error) {
+	if len(layers) == 1 {
+		return layers[0], nil
+	}
+	return vp9.BuildSuperframe(layers)
+}
+
+// drop discards the frame and invalidates the references it would have updated,
+// a keyframe is only requested once a frame depending on them shows up.
+func (b *Buffer) drop(p *pending) {
+	if !p.nonRef {
+		var head []byte
+		if u, ok := p.units[p.start]; ok && p.hasStart {
+			head = u.payload
+		}
+		b.refs.lose(head)
+	}
+	b.stats.DroppedFrames++
+	b.advance(p)
+}
+
+func (b *Buffer) advance(p *pending) {
+	last := p.last
+	if p.hasEnd && p.end > last {
+		last = p.end
+	}
+	if !b.started || last > b.last {
+		b.last = last
+		b.lastEnded = p.hasEnd
+	}
+	b.lastTs = p.ts
+	b.started = true
+	delete(b.frames, p.ts)
+}
+
+// addMissing records the sequence numbers of a gap, from included and to excluded.
+func (b *Buffer) addMissing(from, to int64, now time.Time) {
+	if to-from > maxNACK {
+		from = to - maxNACK
+	}
+	for seq := from; seq < to; seq++ {
+		b.missing[seq] = now
+	}
+}
+
+// sendNACK requests the packets missing for longer than the reorder delay, the
+// ones whose frame was emitted or dropped meanwhile are forgotten.
+func (b *Buffer) sendNACK(now time.Time) {
+	var seqs []int64
+	for seq, found := range b.missing {
+		switch {
+		case b.started && seq <= b.last:
+			delete(b.missing, seq)
+		case now.Sub(found) >= b.cfg.ReorderDelay:
+			seqs = append(seqs, seq)
+			delete(b.missing, seq)
+		}
+	}
+	if len(seqs) == 0 {
+		return
+	}
+	sort.Slice(seqs, func(i, j int) bool {
+		return seqs[i] < seqs[j]
+	})
+	if len(seqs) > maxNACK {
+		seqs = seqs[len(seqs)-maxNACK:]
+	}
+	missing := make([]uint16, len(seqs))
+	for i, seq := range seqs {
+		missing[i] = uint16(seq)
+	}
+	b.stats.NACKedPackets += len(missing)
+	if b.cfg.OnRequest == nil {
+		return
+	}
+	b.cfg.OnRequest(Request{
+		Kind:    RequestNACK,
+		Missing: missing,
+	})
+}
+
+func (b *Buffer) requestKeyframe(now time.Time) {
+	if !b.keyRequested.IsZero() && now.Sub(b.keyRequested) < b.cfg.KeyframeRetry {
+		return
+	}
+	b.keyRequested = now
+	b.stats.KeyframeRequests++
+	if b.cfg.OnRequest != nil {
+		b.cfg.OnRequest(Request{
+			Kind: RequestKeyframe,
+		})
+	}
+}
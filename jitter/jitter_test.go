@@ -0,0 +1,366 @@
+package jitter
+
+import (
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/xlab/libvpx-go/rtpvp8"
+	"github.com/xlab/libvpx-go/rtpvp9"
+)
+
+// testMTU splits the test frames into three packets.
+const testMTU = 15
+
+var t0 = time.Unix(1000, 0)
+
+// vp8Frame returns a frame of 40 bytes whose first partition is all zeros, so an
+// inter frame neither refreshes nor copies any reference buffer.
+func vp8Frame(key bool) []byte {
+	const partSize = 16
+	tag := uint32(partSize<<5 | 1<<4)
+	if !key {
+		tag |= 1
+	}
+	frame := []byte{byte(tag), byte(tag >> 8), byte(tag >> 16)}
+	if key {
+		frame = append(frame, 0x9d, 0x01, 0x2a, 64, 0, 48, 0)
+	}
+	return append(frame, make([]byte, 40-len(frame))...)
+}
+
+// bitWriter writes MSB-first bit fields.
+type bitWriter struct {
+	buf []byte
+	pos int
+}
+
+func (w *bitWriter) put(v uint32, n int) {
+	for i := n - 1; i >= 0; i-- {
+		if w.pos>>3 >= len(w.buf) {
+			w.buf = append(w.buf, 0)
+		}
+		if v>>uint(i)&1 == 1 {
+			w.buf[w.pos>>3] |= 1 << (7 - uint(w.pos&7))
+		}
+		w.pos++
+	}
+}
+
+// vp9Frame returns a 64x64 profile 0 frame of 60 bytes. A keyframe refreshes all
+// the slots, an inter frame uses the slots of refs and refreshes the ones in refresh.
+func vp9Frame(key bool, refresh uint32, refs [3]uint32) []byte {
+	w := &bitWriter{}
+	w.put(2, 2) // frame_marker
+	w.put(0, 3) // profile 0, show_existing_frame
+	if key {
+		w.put(0, 1)
+	} else {
+		w.put(1, 1)
+	}
+	w.put(2, 2) // show_frame, error_resilient_mode
+	if key {
+		w.put(0x498342, 24)
+		w.put(4, 4) // color_space BT.709, color_range
+		w.put(63, 16)
+		w.put(63, 16)
+		w.put(0, 1) // render_and_frame_size_different
+	} else {
+		w.put(0, 3) // intra_only, reset_frame_context
+		w.put(refresh, 8)
+		for _, idx := range refs {
+			w.put(idx<<1, 4)
+		}
+		w.put(0, 3) // found_ref
+		w.put(63, 16)
+		w.put(63, 16)
+		w.put(3, 3) // render size, allow_high_precision_mv, is_filter_switchable
+	}
+	w.put(8, 4)  // refresh_frame_context, frame_parallel_decoding_mode, frame_context_idx
+	w.put(10, 6) // filter_level
+	w.put(0, 4)  // sharpness_level, mode_ref_delta_enabled
+	w.put(60, 8) // base_q_idx
+	w.put(0, 5)  // delta_q, segmentation_enabled, tile_rows_log2
+	w.put(1, 16) // header_size_in_bytes
+	return append(w.buf, make([]byte, 60-len(w.buf))...)
+}
+
+// vp9Packets packetizes a frame in three packets, in flexible mode an inter
+// frame references the previous picture.
+func vp9Packets(t *testing.T, seq uint16, ts uint32, frame []byte, flexible bool) []Packet {
+	template := rtpvp9.Descriptor{FlexibleMode: flexible}
+	if flexible {
+		template.PDiff = []uint8{1}
+	}
+	payloads, err := rtpvp9.NewPacketizer(22, -1, nil).Packetize(frame, template)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return packets(seq, ts, payloads)
+}
+
+func vp8Packets(t *testing.T, seq uint16, ts uint32, key bool) []Packet {
+	payloads, err := rtpvp8.NewPacketizer(testMTU, -1).Packetize(vp8Frame(key), rtpvp8.Descriptor{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	return packets(seq, ts, payloads)
+}
+
+func packets(seq uint16, ts uint32, payloads [][]byte) []Packet {
+	pkts := make([]Packet, len(payloads))
+	for i, payload := range payloads {
+		pkts[i] = Packet{
+			SequenceNumber: seq + uint16(i),
+			Timestamp:      ts,
+			Marker:         i == len(payloads)-1,
+			Payload:        payload,
+		}
+	}
+	return pkts
+}
+
+// trace drives a buffer with packets and records what comes out.
+type trace struct {
+	t        *testing.T
+	b        *Buffer
+	frames   []*Frame
+	requests []Request
+}
+
+func newTrace(t *testing.T) *trace {
+	return newCodecTrace(t, CodecVP8)
+}
+
+func newCodecTrace(t *testing.T, codec Codec) *trace {
+	tr := &trace{t: t}
+	b, err := New(Config{
+		Codec: codec,
+		OnRequest: func(r Request) {
+			tr.requests = append(tr.requests, r)
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	tr.b = b
+	return tr
+}
+
+// push adds the packets of the given indexes at the given time and pops the frames,
+// as a receiver does after every packet.
+func (tr *trace) push(now time.Time, pkts []Packet, idx ...int) {
+	for _, i := range idx {
+		pkt := pkts[i]
+		pkt.Arrival = now
+		if err := tr.b.Push(pkt); err != nil {
+			tr.t.Fatal(err)
+		}
+		tr.pop(now)
+	}
+}
+
+func (tr *trace) pop(now time.Time) {
+	for f := tr.b.Pop(now); f != nil; f = tr.b.Pop(now) {
+		tr.frames = append(tr.frames, f)
+	}
+}
+
+func (tr *trace) timestamps() []uint32 {
+	var ts []uint32
+	for _, f := range tr.frames {
+		ts = append(ts, f.Timestamp)
+	}
+	return ts
+}
+
+func (tr *trace) count(kind RequestKind) int {
+	var n int
+	for _, r := range tr.requests {
+		if r.Kind == kind {
+			n++
+		}
+	}
+	return n
+}
+
+func (tr *trace) expectFrames(ts ...uint32) {
+	tr.t.Helper()
+	if got := tr.timestamps(); !reflect.DeepEqual(got, ts) {
+		tr.t.Fatalf("frames %v, want %v", got, ts)
+	}
+}
+
+func TestReorder(t *testing.T) {
+	tr := newTrace(t)
+	key := vp8Packets(t, 100, 0, true)
+	inter := vp8Packets(t, 103, 3000, false)
+	tr.push(t0, key, 0, 2)
+	tr.push(t0.Add(5*time.Millisecond), inter, 0)
+	tr.push(t0.Add(10*time.Millisecond), key, 1)
+	tr.push(t0.Add(10*time.Millisecond), inter, 2, 1)
+	tr.pop(t0.Add(time.Second))
+
+	tr.expectFrames(0, 3000)
+	if !tr.frames[0].KeyFrame || tr.frames[1].KeyFrame {
+		t.Errorf("keyframe flags %v %v", tr.frames[0].KeyFrame, tr.frames[1].KeyFrame)
+	}
+	if tr.frames[0].FirstSeq != 100 || tr.frames[1].LastSeq != 105 {
+		t.Errorf("sequence numbers %d-%d", tr.frames[0].FirstSeq, tr.frames[1].LastSeq)
+	}
+	if len(tr.requests) != 0 {
+		t.Errorf("requests %v for packets reordered within the delay", tr.requests)
+	}
+	if s := tr.b.Stats(); s.Frames != 2 || s.DroppedFrames != 0 || s.NACKedPackets != 0 {
+		t.Errorf("stats %+v", s)
+	}
+}
+
+func TestNACKAfterReorderDelay(t *testing.T) {
+	tr := newTrace(t)
+	key := vp8Packets(t, 0, 0, true)
+	tr.push(t0, key, 0, 2)
+	tr.pop(t0.Add(DefaultReorderDelay - time.Millisecond))
+	if len(tr.requests) != 0 {
+		t.Fatalf("requests %v before the reorder delay", tr.requests)
+	}
+	tr.pop(t0.Add(DefaultReorderDelay))
+	want := []Request{{Kind: RequestNACK, Missing: []uint16{1}}}
+	if !reflect.DeepEqual(tr.requests, want) {
+		t.Fatalf("requests %v, want %v", tr.requests, want)
+	}
+	// the retransmission completes the frame, the packet is not requested again
+	tr.push(t0.Add(50*time.Millisecond), key, 1)
+	tr.pop(t0.Add(time.Second))
+	tr.expectFrames(0)
+	if len(tr.requests) != 1 {
+		t.Errorf("requests %v", tr.requests)
+	}
+}
+
+func TestLostTail(t *testing.T) {
+	tr := newTrace(t)
+	tr.push(t0, vp8Packets(t, 0, 0, true), 0, 1, 2)
+	// the marker packet of the second frame is lost
+	tr.push(t0.Add(33*time.Millisecond), vp8Packets(t, 3, 3000, false), 0, 1)
+	tr.push(t0.Add(66*time.Millisecond), vp8Packets(t, 6, 6000, false), 0, 1, 2)
+	tr.pop(t0.Add(time.Second))
+
+	tr.expectFrames(0, 6000)
+	s := tr.b.Stats()
+	if s.DroppedFrames != 1 {
+		t.Errorf("dropped %d frames, want 1", s.DroppedFrames)
+	}
+	if n := tr.count(RequestKeyframe); n != 0 {
+		t.Errorf("%d keyframe requests for a frame that refreshes nothing", n)
+	}
+	if tr.frames[1].MissingReferences {
+		t.Error("references lost with the tail of a frame")
+	}
+}
+
+func TestLostFrameAndKeyframeRecovery(t *testing.T) {
+	tr := newTrace(t)
+	tr.push(t0, vp8Packets(t, 0, 0, true), 0, 1, 2)
+	// the frame of seq 3-5 is lost entirely
+	tr.push(t0.Add(66*time.Millisecond), vp8Packets(t, 6, 6000, false), 0, 1, 2)
+	tr.pop(t0.Add(200 * time.Millisecond))
+
+	tr.expectFrames(0)
+	if s := tr.b.Stats(); s.DroppedFrames != 2 {
+		t.Errorf("dropped %d frames, want the lost one and the one depending on it", s.DroppedFrames)
+	}
+	wantNACK := Request{Kind: RequestNACK, Missing: []uint16{3, 4, 5}}
+	if len(tr.requests) == 0 || !reflect.DeepEqual(tr.requests[0], wantNACK) {
+		t.Errorf("requests %v, want %v first", tr.requests, wantNACK)
+	}
+	if n := tr.count(RequestKeyframe); n != 1 {
+		t.Fatalf("%d keyframe requests, want 1", n)
+	}
+
+	// inter frames are dropped until the keyframe, without requesting it again
+	tr.push(t0.Add(300*time.Millisecond), vp8Packets(t, 9, 9000, false), 0, 1, 2)
+	tr.expectFrames(0)
+	if n := tr.count(RequestKeyframe); n != 1 {
+		t.Errorf("%d keyframe requests within the retry interval", n)
+	}
+	tr.push(t0.Add(333*time.Millisecond), vp8Packets(t, 12, 12000, true), 0, 1, 2)
+	tr.push(t0.Add(366*time.Millisecond), vp8Packets(t, 15, 15000, false), 0, 1, 2)
+	tr.expectFrames(0, 12000, 15000)
+	if f := tr.frames[1]; !f.KeyFrame || f.MissingReferences || f.Partial {
+		t.Errorf("recovery frame %+v", f)
+	}
+}
+
+func TestSequenceWrap(t *testing.T) {
+	tr := newTrace(t)
+	tr.push(t0, vp8Packets(t, 65534, 0, true), 0, 2, 1)
+	tr.push(t0, vp8Packets(t, 1, 3000, false), 0, 1, 2)
+	tr.expectFrames(0, 3000)
+	if f := tr.frames[0]; f.FirstSeq != 65534 || f.LastSeq != 0 {
+		t.Errorf("sequence numbers %d-%d", f.FirstSeq, f.LastSeq)
+	}
+	if len(tr.requests) != 0 {
+		t.Errorf("requests %v", tr.requests)
+	}
+}
+
+func TestReset(t *testing.T) {
+	tr := newTrace(t)
+	tr.push(t0, vp8Packets(t, 0, 0, true), 0, 1, 2)
+	tr.push(t0.Add(66*time.Millisecond), vp8Packets(t, 6, 6000, false), 0, 1, 2)
+	tr.pop(t0.Add(200 * time.Millisecond))
+	if n := tr.count(RequestKeyframe); n != 1 {
+		t.Fatalf("%d keyframe requests, want 1", n)
+	}
+
+	tr.b.Reset()
+	// after a seek the stream restarts, possibly with the timestamp of the last frame
+	tr.push(t0.Add(210*time.Millisecond), vp8Packets(t, 500, 6000, false), 0, 1, 2)
+	tr.pop(t0.Add(400 * time.Millisecond))
+	if n := tr.count(RequestKeyframe); n != 2 {
+		t.Errorf("%d keyframe requests, want a new one after the reset", n)
+	}
+	tr.push(t0.Add(410*time.Millisecond), vp8Packets(t, 503, 9000, true), 0, 1, 2)
+	tr.expectFrames(0, 9000)
+	if !tr.frames[1].KeyFrame {
+		t.Error("frame after reset is not the keyframe")
+	}
+}
+
+func TestVP9LostReference(t *testing.T) {
+	for _, flexible := range []bool{false, true} {
+		tr := newCodecTrace(t, CodecVP9)
+		push := func(now time.Duration, seq uint16, ts uint32, frame []byte, idx ...int) {
+			tr.push(t0.Add(now), vp9Packets(t, seq, ts, frame, flexible), idx...)
+		}
+		push(0, 0, 0, vp9Frame(true, 0, [3]uint32{}), 0, 1, 2)
+		push(33*time.Millisecond, 3, 3000, vp9Frame(false, 0x02, [3]uint32{0, 0, 0}), 0, 1, 2)
+		// the second packet is lost, the header in the first one tells slot 2 is lost with it
+		push(66*time.Millisecond, 6, 6000, vp9Frame(false, 0x04, [3]uint32{0, 1, 1}), 0, 2)
+		// unlike VP8, a frame using the other slots only is still decodable
+		push(100*time.Millisecond, 9, 9000, vp9Frame(false, 0x01, [3]uint32{0, 1, 1}), 0, 1, 2)
+		push(133*time.Millisecond, 12, 12000, vp9Frame(false, 0x01, [3]uint32{0, 2, 1}), 0, 1, 2)
+		tr.pop(t0.Add(time.Second))
+
+		tr.expectFrames(0, 3000, 9000)
+		if s := tr.b.Stats(); s.DroppedFrames != 2 {
+			t.Errorf("flexible %v: dropped %d frames, want the lost one and the one using slot 2", flexible, s.DroppedFrames)
+		}
+		if n := tr.count(RequestKeyframe); n != 1 {
+			t.Fatalf("flexible %v: %d keyframe requests, want 1", flexible, n)
+		}
+
+		// the keyframe refreshes all the slots
+		push(1100*time.Millisecond, 15, 15000, vp9Frame(false, 0x01, [3]uint32{2, 2, 2}), 0, 1, 2)
+		push(1133*time.Millisecond, 18, 18000, vp9Frame(true, 0, [3]uint32{}), 0, 1, 2)
+		push(1166*time.Millisecond, 21, 21000, vp9Frame(false, 0x01, [3]uint32{2, 2, 2}), 0, 1, 2)
+		tr.expectFrames(0, 3000, 9000, 18000, 21000)
+		if f := tr.frames[3]; !f.KeyFrame || f.MissingReferences || f.Partial {
+			t.Errorf("flexible %v: recovery frame %+v", flexible, f)
+		}
+		if n := tr.count(RequestKeyframe); n != 1 {
+			t.Errorf("flexible %v: %d keyframe requests within the retry interval", flexible, n)
+		}
+	}
+}
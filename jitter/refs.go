@@ -0,0 +1,182 @@
+package jitter
+
+import (
+	"github.com/xlab/libvpx-go/vp8"
+	"github.com/xlab/libvpx-go/vp9"
+)
+
+// refTracker follows the state of the decoder reference buffers to tell whether
+// a frame can be decoded after some of the previous frames were lost.
+type refTracker interface {
+	// check reports whether data starts with a keyframe and whether all the
+	// references used by it are available.
+	check(data []byte) (keyframe, ok bool)
+	// update applies the reference updates of a frame passed to the decoder.
+	update(data []byte)
+	// lose invalidates the references a lost frame would have updated, data holds
+	// the beginning of the frame or is nil if none of it was received.
+	lose(data []byte)
+	reset()
+}
+
+func newRefTracker(codec Codec) refTracker {
+	if codec == CodecVP9 {
+		return &vp9Refs{}
+	}
+	return &vp8Refs{}
+}
+
+const (
+	vp8Last = iota
+	vp8Golden
+	vp8AltRef
+)
+
+// vp8Refs tracks the last, golden and altref buffers. Since VP8 signals the references
+// per macroblock, an inter frame is only considered decodable if all of them are valid.
+type vp8Refs struct {
+	valid [3]bool
+}
+
+func (r *vp8Refs) check(data []byte) (bool, bool) {
+	h, err := vp8.ParseFrameHeader(data)
+	if err != nil {
+		return false, false
+	}
+	if h.KeyFrame {
+		return true, true
+	}
+	return false, r.valid[vp8Last] && r.valid[vp8Golden] && r.valid[vp8AltRef]
+}
+
+func (r *vp8Refs) update(data []byte) {
+	if f, err := vp8.ParseFrameRefresh(data); err == nil {
+		r.apply(f, true)
+	}
+}
+
+func (r *vp8Refs) lose(data []byte) {
+	f, err := vp8.ParseFrameRefresh(data)
+	if err != nil {
+		r.reset()
+		return
+	}
+	r.apply(f, false)
+}
+
+func (r *vp8Refs) apply(f *vp8.Frame, decoded bool) {
+	if f.KeyFrame {
+		r.valid = [3]bool{decoded, decoded, decoded}
+		return
+	}
+	prev := r.valid
+	switch f.CopyToGolden {
+	case 1:
+		r.valid[vp8Golden] = prev[vp8Last]
+	case 2:
+		r.valid[vp8Golden] = prev[vp8AltRef]
+	}
+	switch f.CopyToAltRef {
+	case 1:
+		r.valid[vp8AltRef] = prev[vp8Last]
+	case 2:
+		r.valid[vp8AltRef] = prev[vp8Golden]
+	}
+	if f.RefreshGolden {
+		r.valid[vp8Golden] = decoded
+	}
+	if f.RefreshAltRef {
+		r.valid[vp8AltRef] = decoded
+	}
+	if f.RefreshLast {
+		r.valid[vp8Last] = decoded
+	}
+}
+
+func (r *vp8Refs) reset() {
+	r.valid = [3]bool{}
+}
+
+// vp9Refs tracks the eight reference slots, the frames of a superframe
+// are applied in order as the hidden ones may refresh slots used by the next.
+type vp9Refs struct {
+	valid [vp9.NumRefFrames]bool
+}
+
+func (r *vp9Refs) check(data []byte) (bool, bool) {
+	frames, err := vp9.SplitSuperframe(data)
+	if err != nil || len(frames) == 0 {
+		return false, false
+	}
+	valid := r.valid
+	keyframe := false
+	for i, frame := range frames {
+		h, _ := vp9.ParseHeader(frame)
+		if h == nil {
+			return keyframe, false
+		}
+		switch {
+		case h.ShowExistingFrame:
+			if !valid[h.FrameToShowMapIdx] {
+				return keyframe, false
+			}
+			continue
+		case h.IsKeyframe():
+			if i == 0 {
+				keyframe = true
+			}
+		case !h.IntraOnly:
+			for _, idx := range h.RefFrameIdx {
+				if !valid[idx] {
+					return keyframe, false
+				}
+			}
+		}
+		refresh(&valid, h.RefreshFrameFlags, true)
+	}
+	return keyframe, true
+}
+
+func (r *vp9Refs) update(data []byte) {
+	frames, err := vp9.SplitSuperframe(data)
+	if err != nil {
+		return
+	}
+	for _, frame := range frames {
+		if h, _ := vp9.ParseHeader(frame); h != nil && !h.ShowExistingFrame {
+			refresh(&r.valid, h.RefreshFrameFlags, true)
+		}
+	}
+}
+
+func (r *vp9Refs) lose(data []byte) {
+	frames, err := vp9.SplitSuperframe(data)
+	if err != nil {
+		// a truncated frame may end with bytes that look like an index
+		frames = [][]byte{data}
+	}
+	parsed := false
+	for _, frame := range frames {
+		if h, _ := vp9.ParseHeader(frame); h != nil {
+			parsed = true
+			if !h.ShowExistingFrame {
+				refresh(&r.valid, h.RefreshFrameFlags, false)
+			}
+		}
+	}
+	if !parsed {
+		r.reset()
+	}
+}
+
+func (r *vp9Refs) reset() {
+	r.valid = [vp9.NumRefFrames]bool{}
+}
+
+func refresh(valid *[vp9.NumRefFrames]bool, flags uint8, decoded bool) {
+	for i := range valid {
+		if flags&(1<<uint(i)) != 0 {
+			valid[i] = decoded
+		}
+	}
+}
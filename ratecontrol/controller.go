@@ -0,0 +1,322 @@
+// Package ratecontrol implements a bandwidth estimator driven by transport feedback
+// and turns its estimate into encoder settings: the target bitrate, frame dropping,
+// internal scaling and the number of temporal layers to send. It has no clock of
+// its own, the same feedback trace always gives the same decisions.
+package ratecontrol
+
+import (
+	"errors"
+	"time"
+
+	"github.com/xlab/libvpx-go/vpx"
+)
+
+const (
+	// DefaultDropframeThresh is the buffer level in percent below which frames
+	// are dropped while the link is congested.
+	DefaultDropframeThresh = 30
+	// DefaultDownscaleBPP and DefaultUpscaleBPP are the bits per pixel below which
+	// the resolution is lowered and above which it is raised again.
+	DefaultDownscaleBPP = 0.02
+	DefaultUpscaleBPP   = 0.05
+	// DefaultHold is the minimum time between two resolution or layer changes.
+	DefaultHold = 5 * time.Second
+	// DefaultDelayThreshold is the queuing delay over the minimum RTT that
+	// is considered as overuse of the link.
+	DefaultDelayThreshold = 30 * time.Millisecond
+
+	// increaseRate is the relative bitrate increase per second without congestion.
+	increaseRate = 0.08
+	// delayBackoff is the bitrate factor applied on delay overuse.
+	delayBackoff = 0.85
+	// lossLow and lossHigh delimit the loss fractions that hold the bitrate.
+	lossLow  = 0.02
+	lossHigh = 0.10
+	// minRTTWindow is how long an RTT sample is kept for the minimum.
+	minRTTWindow = 10 * time.Second
+	// minBackoffInterval is the minimum time between two decreases if the RTT is unknown.
+	minBackoffInterval = 200 * time.Millisecond
+)
+
+var (
+	ErrNoBitrate   = errors.New("ratecontrol: MaxBitrate must be set")
+	ErrBadBitrates = errors.New("ratecontrol: bitrates must satisfy MinBitrate <= StartBitrate <= MaxBitrate")
+	ErrNoFrameSize = errors.New("ratecontrol: Width, Height and FrameRate must be set")
+	ErrBadBPP      = errors.New("ratecontrol: DownscaleBPP must be lower than UpscaleBPP")
+)
+
+// Config holds the controller parameters, the bitrates are in kbps like RcTargetBitrate.
+type Config struct {
+	MinBitrate uint32
+	MaxBitrate uint32
+	// StartBitrate is the initial estimate, MaxBitrate is used if zero.
+	StartBitrate uint32
+	// Width, Height and FrameRate describe the input of the encoder.
+	Width     int
+	Height    int
+	FrameRate float64
+	// TemporalLayers is the number of temporal layers the encoder produces, each
+	// layer doubles the frame rate of the one below. Zero means one layer.
+	TemporalLayers int
+	// DropframeThresh is the lowest RcDropframeThresh while congested,
+	// DefaultDropframeThresh is used if zero.
+	DropframeThresh uint32
+	// DownscaleBPP and UpscaleBPP override DefaultDownscaleBPP and DefaultUpscaleBPP.
+	DownscaleBPP float64
+	UpscaleBPP   float64
+	// Hold overrides DefaultHold.
+	Hold time.Duration
+	// DelayThreshold overrides DefaultDelayThreshold.
+	DelayThreshold time.Duration
+}
+
+// Feedback is a transport report from the receiver.
+type Feedback struct {
+	// Time is when the report was received.
+	Time time.Time
+	// REMB is the receiver estimated maximum bitrate in bits per second, zero if not reported.
+	REMB uint64
+	// LossFraction is the fraction of packets lost since the previous report,
+	// negative if not reported.
+	LossFraction float64
+	// RTT is a round-trip time sample, zero if not reported.
+	RTT time.Duration
+}
+
+// Decision holds the encoder settings for the current estimate.
+type Decision struct {
+	// Bitrate is the target bitrate in kbps.
+	Bitrate uint32
+	// DropframeThresh is the RcDropframeThresh to use while congested, zero
+	// keeps the threshold the encoder was configured with.
+	DropframeThresh uint32
+	// Scale is the internal scaling of the encoder in both dimensions.
+	Scale vpx.ScalingMode
+	// TemporalLayers is the number of temporal layers to send, the packets of
+	// the layers above are to be dropped by the sender.
+	TemporalLayers int
+	// Congested is set while the link shows delay overuse or high loss.
+	Congested bool
+}
+
+// scales are the scaling steps from the full resolution down, with their area ratio.
+var scales = []struct {
+	mode vpx.ScalingMode
+	area float64
+}{
+	{vpx.ScaleNormal, 1},
+	{vpx.ScaleFourFive, 0.64},
+	{vpx.ScaleThreeFive, 0.36},
+	{vpx.ScaleOneTwo, 0.25},
+}
+
+// Controller estimates the available bandwidth, it is not safe for concurrent use.
+type Controller struct {
+	cfg Config
+
+	estimate   float64 // kbps
+	lastUpdate time.Time
+	lastDrop   time.Time
+	lastSwitch time.Time
+	srtt       time.Duration
+	rtts       []rttSample
+
+	scale     int // index in scales
+	layers    int
+	congested bool
+}
+
+type rttSample struct {
+	at  time.Time
+	rtt time.Duration
+}
+
+// New validates the configuration and returns a controller at the start bitrate.
+func New(cfg Config) (*Controller, error) {
+	if cfg.MaxBitrate == 0 {
+		return nil, ErrNoBitrate
+	}
+	if cfg.StartBitrate == 0 {
+		cfg.StartBitrate = cfg.MaxBitrate
+	}
+	if cfg.MinBitrate > cfg.StartBitrate || cfg.StartBitrate > cfg.MaxBitrate {
+		return nil, ErrBadBitrates
+	}
+	if cfg.Width <= 0 || cfg.Height <= 0 || cfg.FrameRate <= 0 {
+		return nil, ErrNoFrameSize
+	}
+	if cfg.TemporalLayers <= 0 {
+		cfg.TemporalLayers = 1
+	}
+	if cfg.DropframeThresh == 0 {
+		cfg.DropframeThresh = DefaultDropframeThresh
+	}
+	if cfg.DownscaleBPP == 0 {
+		cfg.DownscaleBPP = DefaultDownscaleBPP
+	}
+	if cfg.UpscaleBPP == 0 {
+		cfg.UpscaleBPP = DefaultUpscaleBPP
+	}
+	if cfg.DownscaleBPP >= cfg.UpscaleBPP {
+		return nil, ErrBadBPP
+	}
+	if cfg.Hold == 0 {
+		cfg.Hold = DefaultHold
+	}
+	if cfg.DelayThreshold == 0 {
+		cfg.DelayThreshold = DefaultDelayThreshold
+	}
+	return &Controller{
+		cfg:      cfg,
+		estimate: float64(cfg.StartBitrate),
+		layers:   cfg.TemporalLayers,
+	}, nil
+}
+
+// Update feeds a report to the estimator and returns the resulting decision.
+// Reports must be given in time order.
+func (c *Controller) Update(fb Feedback) Decision {
+	var elapsed time.Duration
+	if !c.lastUpdate.IsZero() && fb.Time.After(c.lastUpdate) {
+		elapsed = fb.Time.Sub(c.lastUpdate)
+		if elapsed > time.Second {
+			// do not ramp up on the silence between sparse reports
+			elapsed = time.Second
+		}
+	}
+	if c.lastUpdate.IsZero() || fb.Time.After(c.lastUpdate) {
+		c.lastUpdate = fb.Time
+	}
+
+	overuse := c.updateDelay(fb)
+	loss := fb.LossFraction
+	highLoss := loss > lossHigh
+	c.congested = overuse || highLoss
+
+	switch {
+	case highLoss:
+		if c.canDecrease(fb.Time) {
+			c.estimate *= 1 - 0.5*loss
+			c.lastDrop = fb.Time
+		}
+	case overuse:
+		if c.canDecrease(fb.Time) {
+			c.estimate *= delayBackoff
+			c.lastDrop = fb.Time
+		}
+	case loss < lossLow:
+		// also when the loss is not reported
+		c.estimate *= 1 + increaseRate*elapsed.Seconds()
+	}
+	if fb.REMB > 0 && c.estimate > float64(fb.REMB)/1000 {
+		c.estimate = float64(fb.REMB) / 1000
+	}
+	if c.estimate < float64(c.cfg.MinBitrate) {
+		c.estimate = float64(c.cfg.MinBitrate)
+	}
+	if c.estimate > float64(c.cfg.MaxBitrate) {
+		c.estimate = float64(c.cfg.MaxBitrate)
+	}
+	c.adapt(fb.Time)
+	return c.Decision()
+}
+
+// Decision returns the settings for the current estimate.
+func (c *Controller) Decision() Decision {
+	d := Decision{
+		Bitrate:        uint32(c.estimate),
+		Scale:          scales[c.scale].mode,
+		TemporalLayers: c.layers,
+		Congested:      c.congested,
+	}
+	if c.congested {
+		d.DropframeThresh = c.cfg.DropframeThresh
+	}
+	return d
+}
+
+// Estimate returns the current bandwidth estimate in kbps.
+func (c *Controller) Estimate() uint32 {
+	return uint32(c.estimate)
+}
+
+// updateDelay tracks the RTT and reports whether the queuing delay, the smoothed
+// RTT over the minimum of the recent samples, exceeds the threshold.
+func (c *Controller) updateDelay(fb Feedback) bool {
+	if fb.RTT > 0 {
+		if c.srtt == 0 {
+			c.srtt = fb.RTT
+		} else {
+			c.srtt += (fb.RTT - c.srtt) / 8
+		}
+		c.rtts = append(c.rtts, rttSample{
+			at:  fb.Time,
+			rtt: fb.RTT,
+		})
+		for len(c.rtts) > 1 && fb.Time.Sub(c.rtts[0].at) > minRTTWindow {
+			c.rtts = c.rtts[1:]
+		}
+	}
+	if c.srtt == 0 {
+		return false
+	}
+	min := c.rtts[0].rtt
+	for _, s := range c.rtts[1:] {
+		if s.rtt < min {
+			min = s.rtt
+		}
+	}
+	return c.srtt-min > c.cfg.DelayThreshold
+}
+
+// canDecrease limits the decreases to one per RTT, so the effect of the previous
+// one is seen before decreasing again.
+func (c *Controller) canDecrease(now time.Time) bool {
+	if c.lastDrop.IsZero() {
+		return true
+	}
+	interval := c.srtt
+	if interval < minBackoffInterval {
+		interval = minBackoffInterval
+	}
+	return now.Sub(c.lastDrop) >= interval
+}
+
+// bpp returns the bits per pixel at the given scale step and number of layers.
+func (c *Controller) bpp(scale, layers int) float64 {
+	fps := c.cfg.FrameRate / float64(uint(1)<<uint(c.cfg.TemporalLayers-layers))
+	pixels := float64(c.cfg.Width*c.cfg.Height) * scales[scale].area
+	return c.estimate * 1000 / (pixels * fps)
+}
+
+// adapt lowers the resolution, then the frame rate, when the bits per pixel fall
+// too low, and restores them in the opposite order. Since the check for going back
+// up uses the higher threshold at the higher setting, the steps do not oscillate.
+func (c *Controller) adapt(now time.Time) {
+	if !c.lastSwitch.IsZero() && now.Sub(c.lastSwitch) < c.cfg.Hold {
+		return
+	}
+	switch {
+	case c.bpp(c.scale, c.layers) < c.cfg.DownscaleBPP:
+		if c.scale < len(scales)-1 {
+			c.scale++
+		} else if c.layers > 1 {
+			c.layers--
+		} else {
+			return
+		}
+	case c.layers < c.cfg.TemporalLayers:
+		if c.bpp(c.scale, c.layers+1) < c.cfg.UpscaleBPP {
+			return
+		}
+		c.layers++
+	case c.scale > 0:
+		if c.bpp(c.scale-1, c.layers) < c.cfg.UpscaleBPP {
+			return
+		}
+		c.scale--
+	default:
+		return
+	}
+	c.lastSwitch = now
+}
@@ -0,0 +1,283 @@
+package ratecontrol
+
+import (
+	"testing"
+	"time"
+
+	"github.com/xlab/libvpx-go/vpx"
+)
+
+var t0 = time.Unix(1000, 0)
+
+func testConfig() Config {
+	return Config{
+		MinBitrate:   100,
+		MaxBitrate:   2000,
+		StartBitrate: 1000,
+		Width:        640,
+		Height:       480,
+		FrameRate:    30,
+	}
+}
+
+// reports returns n reports one interval apart starting at the given offset,
+// fb gives the fields other than the time.
+func reports(at, interval time.Duration, n int, fb Feedback) []Feedback {
+	trace := make([]Feedback, n)
+	for i := range trace {
+		trace[i] = fb
+		trace[i].Time = t0.Add(at + time.Duration(i)*interval)
+	}
+	return trace
+}
+
+func concat(traces ...[]Feedback) []Feedback {
+	var all []Feedback
+	for _, trace := range traces {
+		all = append(all, trace...)
+	}
+	return all
+}
+
+func TestControllerTraces(t *testing.T) {
+	noLoss := Feedback{}
+	tests := []struct {
+		name  string
+		cfg   func(*Config)
+		trace []Feedback
+		want  Decision
+	}{{
+		name:  "ramp up without loss",
+		trace: reports(0, time.Second, 6, noLoss),
+		// 1000 kbps increased by 8% per second for 5 seconds
+		want: Decision{Bitrate: 1469, Scale: vpx.ScaleNormal, TemporalLayers: 1},
+	}, {
+		name:  "ramp up capped at max",
+		trace: reports(0, time.Second, 20, noLoss),
+		want:  Decision{Bitrate: 2000, Scale: vpx.ScaleNormal, TemporalLayers: 1},
+	}, {
+		name:  "ramp up not credited for silence",
+		trace: concat(reports(0, 0, 1, noLoss), reports(10*time.Second, 0, 1, noLoss)),
+		want:  Decision{Bitrate: 1080, Scale: vpx.ScaleNormal, TemporalLayers: 1},
+	}, {
+		name:  "ramp up with unreported loss",
+		trace: reports(0, time.Second, 2, Feedback{LossFraction: -1}),
+		want:  Decision{Bitrate: 1080, Scale: vpx.ScaleNormal, TemporalLayers: 1},
+	}, {
+		name:  "remb clamps the estimate",
+		trace: reports(0, time.Second, 1, Feedback{REMB: 500000}),
+		want:  Decision{Bitrate: 500, Scale: vpx.ScaleNormal, TemporalLayers: 1},
+	}, {
+		name:  "ramp up from the remb",
+		trace: concat(reports(0, 0, 1, Feedback{REMB: 500000}), reports(time.Second, 0, 1, noLoss)),
+		want:  Decision{Bitrate: 540, Scale: vpx.ScaleNormal, TemporalLayers: 1},
+	}, {
+		name:  "remb above the estimate",
+		trace: reports(0, time.Second, 1, Feedback{REMB: 5000000}),
+		want:  Decision{Bitrate: 1000, Scale: vpx.ScaleNormal, TemporalLayers: 1},
+	}, {
+		name: "remb below min",
+		cfg: func(cfg *Config) {
+			cfg.Width, cfg.Height = 160, 120
+		},
+		trace: reports(0, time.Second, 1, Feedback{REMB: 20000}),
+		want:  Decision{Bitrate: 100, Scale: vpx.ScaleNormal, TemporalLayers: 1},
+	}, {
+		name:  "moderate loss holds",
+		trace: reports(0, time.Second, 3, Feedback{LossFraction: 0.05}),
+		want:  Decision{Bitrate: 1000, Scale: vpx.ScaleNormal, TemporalLayers: 1},
+	}, {
+		name:  "high loss backs off",
+		trace: reports(0, time.Second, 1, Feedback{LossFraction: 0.2}),
+		// decreased by half the loss fraction
+		want: Decision{Bitrate: 900, DropframeThresh: DefaultDropframeThresh, Scale: vpx.ScaleNormal, TemporalLayers: 1, Congested: true},
+	}, {
+		name:  "high loss backs off once per interval",
+		trace: reports(0, 100*time.Millisecond, 4, Feedback{LossFraction: 0.2}),
+		// the reports at 0 and 200ms decrease, the ones at 100 and 300ms do not
+		want: Decision{Bitrate: 810, DropframeThresh: DefaultDropframeThresh, Scale: vpx.ScaleNormal, TemporalLayers: 1, Congested: true},
+	}, {
+		name: "high loss with custom drop threshold",
+		cfg: func(cfg *Config) {
+			cfg.DropframeThresh = 60
+		},
+		trace: reports(0, time.Second, 1, Feedback{LossFraction: 0.5}),
+		want:  Decision{Bitrate: 750, DropframeThresh: 60, Scale: vpx.ScaleNormal, TemporalLayers: 1, Congested: true},
+	}, {
+		name: "delay overuse backs off",
+		trace: concat(
+			reports(0, 0, 1, Feedback{RTT: 50 * time.Millisecond}),
+			reports(time.Second, 0, 1, Feedback{RTT: 400 * time.Millisecond}),
+		),
+		// the smoothed RTT is 50+350/8 ms, over the minimum by more than 30ms
+		want: Decision{Bitrate: 850, DropframeThresh: DefaultDropframeThresh, Scale: vpx.ScaleNormal, TemporalLayers: 1, Congested: true},
+	}, {
+		name: "delay below threshold",
+		trace: concat(
+			reports(0, 0, 1, Feedback{RTT: 50 * time.Millisecond}),
+			reports(time.Second, 0, 1, Feedback{RTT: 200 * time.Millisecond}),
+		),
+		want: Decision{Bitrate: 1080, Scale: vpx.ScaleNormal, TemporalLayers: 1},
+	}, {
+		name: "delay overuse clears",
+		trace: concat(
+			reports(0, 0, 1, Feedback{RTT: 50 * time.Millisecond}),
+			reports(time.Second, 0, 1, Feedback{RTT: 400 * time.Millisecond}),
+			reports(2*time.Second, time.Second, 3, Feedback{RTT: 50 * time.Millisecond}),
+		),
+		// 1000*0.85^3 while the smoothed RTT decays, then 8% up once under the threshold
+		want: Decision{Bitrate: 663, Scale: vpx.ScaleNormal, TemporalLayers: 1},
+	}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := testConfig()
+			if tt.cfg != nil {
+				tt.cfg(&cfg)
+			}
+			c, err := New(cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got Decision
+			for _, fb := range tt.trace {
+				got = c.Update(fb)
+			}
+			if got != tt.want {
+				t.Errorf("decision %+v, want %+v", got, tt.want)
+			}
+			if got != c.Decision() {
+				t.Errorf("Decision %+v differs from the result of Update %+v", c.Decision(), got)
+			}
+		})
+	}
+}
+
+type step struct {
+	scale  vpx.ScalingMode
+	layers int
+}
+
+// changes runs the trace and returns the scale and layer changes.
+func changes(t *testing.T, c *Controller, trace []Feedback) []step {
+	prev := c.Decision()
+	var steps []step
+	for _, fb := range trace {
+		d := c.Update(fb)
+		if d.Scale != prev.Scale || d.TemporalLayers != prev.TemporalLayers {
+			steps = append(steps, step{d.Scale, d.TemporalLayers})
+		}
+		prev = d
+	}
+	return steps
+}
+
+func equalSteps(a, b []step) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestScaleHysteresis(t *testing.T) {
+	cfg := testConfig()
+	cfg.MinBitrate = 50
+	cfg.Hold = time.Second
+	c, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// 150 kbps is below 0.02 bits per pixel at full size, 0.025 at 4/5
+	if got, want := changes(t, c, reports(0, time.Second, 1, Feedback{REMB: 150000})), []step{{vpx.ScaleFourFive, 1}}; !equalSteps(got, want) {
+		t.Fatalf("changes %v, want %v", got, want)
+	}
+	// 300 kbps is above the downscale threshold at full size, but below the upscale one
+	if got := changes(t, c, reports(time.Second, time.Second, 30, Feedback{REMB: 300000})); len(got) != 0 {
+		t.Fatalf("changes %v between the thresholds", got)
+	}
+	if got := c.Estimate(); got != 300 {
+		t.Fatalf("estimate %d, want 300", got)
+	}
+	// 0.05 bits per pixel at full size is 461 kbps
+	got := changes(t, c, reports(31*time.Second, time.Second, 30, Feedback{REMB: 600000}))
+	if want := []step{{vpx.ScaleNormal, 1}}; !equalSteps(got, want) {
+		t.Fatalf("changes %v, want %v", got, want)
+	}
+}
+
+func TestLayerHysteresis(t *testing.T) {
+	cfg := testConfig()
+	cfg.MinBitrate = 10
+	cfg.TemporalLayers = 3
+	cfg.Hold = time.Second
+	c, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the resolution goes down first, one step per hold period, then the frame rate
+	// until 20 kbps give 0.02 bits per pixel at 1/2 and 7.5 fps
+	got := changes(t, c, reports(0, time.Second, 8, Feedback{REMB: 20000}))
+	want := []step{
+		{vpx.ScaleFourFive, 3},
+		{vpx.ScaleThreeFive, 3},
+		{vpx.ScaleOneTwo, 3},
+		{vpx.ScaleOneTwo, 2},
+		{vpx.ScaleOneTwo, 1},
+	}
+	if !equalSteps(got, want) {
+		t.Fatalf("changes %v, want %v", got, want)
+	}
+	// two layers need 57.6 kbps to reach the upscale threshold
+	if got := changes(t, c, reports(8*time.Second, time.Second, 20, Feedback{REMB: 40000})); len(got) != 0 {
+		t.Fatalf("changes %v between the thresholds", got)
+	}
+	// the frame rate comes back before the resolution, three layers need 115.2 kbps
+	got = changes(t, c, reports(28*time.Second, time.Second, 20, Feedback{REMB: 100000}))
+	if want := []step{{vpx.ScaleOneTwo, 2}}; !equalSteps(got, want) {
+		t.Fatalf("changes %v, want %v", got, want)
+	}
+	if d := c.Decision(); d.Bitrate != 100 {
+		t.Errorf("bitrate %d, want 100", d.Bitrate)
+	}
+}
+
+func TestHoldLimitsChanges(t *testing.T) {
+	cfg := testConfig()
+	cfg.MinBitrate = 10
+	c, err := New(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// with the default hold only one step is taken per 5 seconds
+	got := changes(t, c, reports(0, time.Second, 6, Feedback{REMB: 20000}))
+	want := []step{{vpx.ScaleFourFive, 1}, {vpx.ScaleThreeFive, 1}}
+	if !equalSteps(got, want) {
+		t.Fatalf("changes %v, want %v", got, want)
+	}
+}
+
+func TestNewValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		cfg  func(*Config)
+		err  error
+	}{
+		{"no max", func(cfg *Config) { cfg.MaxBitrate = 0 }, ErrNoBitrate},
+		{"start above max", func(cfg *Config) { cfg.StartBitrate = 3000 }, ErrBadBitrates},
+		{"min above start", func(cfg *Config) { cfg.MinBitrate = 1500 }, ErrBadBitrates},
+		{"no size", func(cfg *Config) { cfg.Width = 0 }, ErrNoFrameSize},
+		{"no frame rate", func(cfg *Config) { cfg.FrameRate = 0 }, ErrNoFrameSize},
+		{"inverted bpp", func(cfg *Config) { cfg.DownscaleBPP, cfg.UpscaleBPP = 0.1, 0.05 }, ErrBadBPP},
+	}
+	for _, tt := range tests {
+		cfg := testConfig()
+		tt.cfg(&cfg)
+		if _, err := New(cfg); err != tt.err {
+			t.Errorf("%s: error %v, want %v", tt.name, err, tt.err)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package ratecontrol
+
+import "github.com/xlab/libvpx-go/vpx"
+
+// Driver applies the decisions of a controller to an encoder. It must be used
+// from the goroutine that encodes, between two frames.
+type Driver struct {
+	ctrl *Controller
+	enc  *vpx.Encoder
+	// dropframeThresh and layerRates are the settings of the encoder before the
+	// driver changed them, layerRates holds the cumulative temporal layer bitrates.
+	dropframeThresh uint32
+	layerRates      []uint32
+	last            Decision
+	applied         bool
+}
+
+// NewDriver returns a driver that adjusts enc following ctrl. The temporal layers of
+// the controller configuration must be those of the encoder.
+func NewDriver(ctrl *Controller, enc *vpx.Encoder) *Driver {
+	cfg := enc.Config()
+	d := &Driver{
+		ctrl:            ctrl,
+		enc:             enc,
+		dropframeThresh: cfg.RcDropframeThresh,
+	}
+	if n := int(cfg.TsNumberLayers); n > 1 && n <= len(cfg.TsTargetBitrate) && cfg.TsTargetBitrate[0] > 0 {
+		d.layerRates = append([]uint32(nil), cfg.TsTargetBitrate[:n]...)
+	}
+	return d
+}
+
+// Feedback updates the controller with a report and applies the new decision.
+func (d *Driver) Feedback(fb Feedback) (Decision, error) {
+	dec := d.ctrl.Update(fb)
+	return dec, d.Apply(dec)
+}
+
+// Apply changes the settings of the encoder that differ from the last decision:
+// the bitrate and frame dropping through Reconfigure, which applies them live,
+// and the scaling with Vp8eSetScalemode. Frame dropping is raised to the decided
+// threshold while congested and restored to the one of the encoder afterwards.
+// With temporal layers the layer bitrates keep their proportions and are scaled so
+// that the layers sent get the decided bitrate, dropping the packets of the layers
+// above is left to the sender.
+func (d *Driver) Apply(dec Decision) error {
+	if !d.applied || dec.Bitrate != d.last.Bitrate || dec.DropframeThresh != d.last.DropframeThresh ||
+		dec.TemporalLayers != d.last.TemporalLayers {
+		cfg := d.enc.Config()
+		cfg.RcTargetBitrate = d.layerBitrates(&cfg, dec)
+		cfg.RcDropframeThresh = d.dropframeThresh
+		if dec.DropframeThresh > cfg.RcDropframeThresh {
+			cfg.RcDropframeThresh = dec.DropframeThresh
+		}
+		if _, err := d.enc.Reconfigure(&cfg); err != nil {
+			return err
+		}
+	}
+	if !d.applied || dec.Scale != d.last.Scale {
+		if err := d.enc.SetScaleMode(dec.Scale, dec.Scale); err != nil {
+			return err
+		}
+	}
+	d.last = dec
+	d.applied = true
+	return nil
+}
+
+// layerBitrates sets the cumulative temporal layer bitrates so that the layers sent
+// add up to the decided bitrate and returns the bitrate of all the layers.
+func (d *Driver) layerBitrates(cfg *vpx.CodecEncCfg, dec Decision) uint32 {
+	n := len(d.layerRates)
+	if n == 0 {
+		return dec.Bitrate
+	}
+	sent := dec.TemporalLayers
+	if sent < 1 || sent > n {
+		sent = n
+	}
+	base := d.layerRates[sent-1]
+	for i, r := range d.layerRates {
+		rate := uint32(uint64(r) * uint64(dec.Bitrate) / uint64(base))
+		cfg.TsTargetBitrate[i] = rate
+		if cfg.SsNumberLayers <= 1 && i < len(cfg.LayerTargetBitrate) {
+			cfg.LayerTargetBitrate[i] = rate
+		}
+	}
+	return cfg.TsTargetBitrate[n-1]
+}
@@ -0,0 +1,56 @@
+package ratecontrol
+
+import (
+	"testing"
+
+	"github.com/xlab/libvpx-go/vpx"
+)
+
+func TestLayerBitrates(t *testing.T) {
+	d := &Driver{
+		layerRates: []uint32{250, 375, 500},
+	}
+	tests := []struct {
+		bitrate uint32
+		layers  int
+		total   uint32
+		rates   [3]uint32
+	}{
+		{300, 3, 300, [3]uint32{150, 225, 300}},
+		// the layers sent get the bitrate
+		{300, 2, 400, [3]uint32{200, 300, 400}},
+		{300, 1, 600, [3]uint32{300, 450, 600}},
+		// more layers than the encoder has
+		{300, 4, 300, [3]uint32{150, 225, 300}},
+	}
+	for _, tt := range tests {
+		cfg := vpx.CodecEncCfg{
+			TsNumberLayers: 3,
+			SsNumberLayers: 1,
+		}
+		total := d.layerBitrates(&cfg, Decision{
+			Bitrate:        tt.bitrate,
+			TemporalLayers: tt.layers,
+		})
+		if total != tt.total {
+			t.Errorf("%d layers: total %d, want %d", tt.layers, total, tt.total)
+		}
+		var rates, layerRates [3]uint32
+		copy(rates[:], cfg.TsTargetBitrate[:])
+		copy(layerRates[:], cfg.LayerTargetBitrate[:])
+		if rates != tt.rates || layerRates != tt.rates {
+			t.Errorf("%d layers: rates %v and %v, want %v", tt.layers, rates, layerRates, tt.rates)
+		}
+	}
+}
+
+func TestLayerBitratesSingleLayer(t *testing.T) {
+	d := &Driver{}
+	cfg := vpx.CodecEncCfg{}
+	if total := d.layerBitrates(&cfg, Decision{Bitrate: 700, TemporalLayers: 1}); total != 700 {
+		t.Errorf("total %d, want 700", total)
+	}
+	if cfg.TsTargetBitrate != [5]uint32{} {
+		t.Errorf("layer bitrates %v set without layers", cfg.TsTargetBitrate)
+	}
+}
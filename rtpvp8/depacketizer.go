@@ -0,0 +1,93 @@
+package rtpvp8
+
+// Frame is a VP8 frame reassembled from RTP packets.
+type Frame struct {
+	Data      []byte
+	Timestamp uint32
+	KeyFrame  bool
+	// Descriptor is the payload descriptor of the first packet of the frame.
+	Descriptor Descriptor
+	// FirstSeq and LastSeq are the sequence numbers of the packets delimiting the frame.
+	FirstSeq uint16
+	LastSeq  uint16
+}
+
+// Depacketizer reassembles VP8 frames from RTP packets received in order.
+// Reordering is out of its scope, packets should go through a jitter buffer first.
+type Depacketizer struct {
+	frame   Frame
+	active  bool
+	lastSeq uint16
+	dropped int
+}
+
+// NewDepacketizer returns an empty depacketizer.
+func NewDepacketizer() *Depacketizer {
+	return &Depacketizer{}
+}
+
+// Push adds an RTP packet to the frame being assembled and returns the frame once
+// the packet with the marker bit completes it. A frame with a gap in sequence
+// numbers or a timestamp change before the marker is dropped and ErrIncompleteFrame
+// is returned; packets are then ignored with ErrUnexpectedPacket until the next
+// frame begins. If the packet that reveals the loss starts a frame of its own,
+// assembly continues with it and the loss is only reflected by Dropped.
+func (d *Depacketizer) Push(seq uint16, timestamp uint32, marker bool, payload []byte) (*Frame, error) {
+	desc, data, err := ParseDescriptor(payload)
+	if err != nil {
+		return nil, err
+	}
+	frameStart := desc.Start && desc.PartID == 0
+	if d.active {
+		if seq != d.lastSeq+1 || timestamp != d.frame.Timestamp {
+			d.reset()
+			d.dropped++
+			if !frameStart {
+				return nil, ErrIncompleteFrame
+			}
+			// the previous frame lost its tail, keep the new one
+			d.begin(seq, timestamp, desc)
+		}
+	} else {
+		if !frameStart {
+			return nil, ErrUnexpectedPacket
+		}
+		d.begin(seq, timestamp, desc)
+	}
+	d.frame.Data = append(d.frame.Data, data...)
+	d.lastSeq = seq
+	if !marker {
+		return nil, nil
+	}
+	f := d.frame
+	f.LastSeq = seq
+	if len(f.Data) > 0 {
+		f.KeyFrame = f.Data[0]&0x01 == 0
+	}
+	d.reset()
+	return &f, nil
+}
+
+// Dropped returns the number of frames dropped because of lost packets.
+func (d *Depacketizer) Dropped() int {
+	return d.dropped
+}
+
+// Reset drops the frame being assembled, e.g. after a seek.
+func (d *Depacketizer) Reset() {
+	d.reset()
+}
+
+func (d *Depacketizer) begin(seq uint16, timestamp uint32, desc *Descriptor) {
+	d.active = true
+	d.frame = Frame{
+		Timestamp:  timestamp,
+		Descriptor: *desc,
+		FirstSeq:   seq,
+	}
+}
+
+func (d *Depacketizer) reset() {
+	d.active = false
+	d.frame = Frame{}
+}
@@ -0,0 +1,195 @@
+// Package rtpvp8 implements the RTP payload format for VP8 as specified by RFC 7741:
+// the payload descriptor, a packetizer that splits frames to fit the MTU and
+// a depacketizer that reassembles frames for the decoder.
+package rtpvp8
+
+import "errors"
+
+var (
+	ErrShortPayload     = errors.New("rtpvp8: payload is too short")
+	ErrMTUTooSmall      = errors.New("rtpvp8: MTU is too small for the payload descriptor")
+	ErrEmptyFrame       = errors.New("rtpvp8: empty frame")
+	ErrIncompleteFrame  = errors.New("rtpvp8: frame is incomplete due to lost packets")
+	ErrUnexpectedPacket = errors.New("rtpvp8: packet does not start a frame")
+)
+
+// MaxPartID is the largest partition index that fits the descriptor.
+const MaxPartID = 7
+
+// Descriptor is the VP8 payload descriptor, see section 4.2 of RFC 7741.
+// The optional fields are only present when the corresponding Has flag is set.
+type Descriptor struct {
+	// NonReference (N) indicates the frame can be discarded without affecting other frames.
+	NonReference bool
+	// Start (S) is set on the first packet of each partition.
+	Start bool
+	// PartID (PID) is the partition the first payload octet belongs to.
+	PartID uint8
+
+	HasPictureID bool
+	// PictureID is either 7 or 15 bits long, see LongPictureID.
+	PictureID     uint16
+	LongPictureID bool
+
+	HasTL0PicIdx bool
+	TL0PicIdx    uint8
+
+	HasTID bool
+	TID    uint8
+	// LayerSync (Y) indicates the frame only depends on the base layer.
+	LayerSync bool
+
+	HasKeyIdx bool
+	KeyIdx    uint8
+}
+
+// Size returns the size of the marshalled descriptor in bytes.
+func (d *Descriptor) Size() int {
+	if !d.hasExtension() {
+		return 1
+	}
+	size := 2
+	if d.HasPictureID {
+		size++
+		if d.LongPictureID {
+			size++
+		}
+	}
+	if d.HasTL0PicIdx {
+		size++
+	}
+	if d.HasTID || d.HasKeyIdx {
+		size++
+	}
+	return size
+}
+
+func (d *Descriptor) hasExtension() bool {
+	return d.HasPictureID || d.HasTL0PicIdx || d.HasTID || d.HasKeyIdx
+}
+
+// AppendTo appends the marshalled descriptor to buf and returns the extended buffer.
+func (d *Descriptor) AppendTo(buf []byte) []byte {
+	var b byte
+	if d.hasExtension() {
+		b |= 0x80
+	}
+	if d.NonReference {
+		b |= 0x20
+	}
+	if d.Start {
+		b |= 0x10
+	}
+	b |= d.PartID & 0x07
+	buf = append(buf, b)
+	if !d.hasExtension() {
+		return buf
+	}
+	var x byte
+	if d.HasPictureID {
+		x |= 0x80
+	}
+	if d.HasTL0PicIdx {
+		x |= 0x40
+	}
+	if d.HasTID {
+		x |= 0x20
+	}
+	if d.HasKeyIdx {
+		x |= 0x10
+	}
+	buf = append(buf, x)
+	if d.HasPictureID {
+		if d.LongPictureID {
+			buf = append(buf, 0x80|byte(d.PictureID>>8)&0x7F, byte(d.PictureID))
+		} else {
+			buf = append(buf, byte(d.PictureID)&0x7F)
+		}
+	}
+	if d.HasTL0PicIdx {
+		buf = append(buf, d.TL0PicIdx)
+	}
+	if d.HasTID || d.HasKeyIdx {
+		var tk byte
+		if d.HasTID {
+			tk |= (d.TID & 0x03) << 6
+			if d.LayerSync {
+				tk |= 0x20
+			}
+		}
+		if d.HasKeyIdx {
+			tk |= d.KeyIdx & 0x1F
+		}
+		buf = append(buf, tk)
+	}
+	return buf
+}
+
+// Marshal returns the descriptor in the wire format.
+func (d *Descriptor) Marshal() []byte {
+	return d.AppendTo(make([]byte, 0, d.Size()))
+}
+
+// ParseDescriptor parses the payload descriptor at the beginning of an RTP payload
+// and returns it along with the VP8 payload that follows.
+func ParseDescriptor(payload []byte) (*Descriptor, []byte, error) {
+	if len(payload) < 1 {
+		return nil, nil, ErrShortPayload
+	}
+	b := payload[0]
+	d := &Descriptor{
+		NonReference: b&0x20 != 0,
+		Start:        b&0x10 != 0,
+		PartID:       b & 0x07,
+	}
+	pos := 1
+	if b&0x80 != 0 {
+		if len(payload) <= pos {
+			return nil, nil, ErrShortPayload
+		}
+		x := payload[pos]
+		pos++
+		d.HasPictureID = x&0x80 != 0
+		d.HasTL0PicIdx = x&0x40 != 0
+		d.HasTID = x&0x20 != 0
+		d.HasKeyIdx = x&0x10 != 0
+		if d.HasPictureID {
+			if len(payload) <= pos {
+				return nil, nil, ErrShortPayload
+			}
+			if payload[pos]&0x80 != 0 {
+				if len(payload) <= pos+1 {
+					return nil, nil, ErrShortPayload
+				}
+				d.LongPictureID = true
+				d.PictureID = uint16(payload[pos]&0x7F)<<8 | uint16(payload[pos+1])
+				pos += 2
+			} else {
+				d.PictureID = uint16(payload[pos])
+				pos++
+			}
+		}
+		if d.HasTL0PicIdx {
+			if len(payload) <= pos {
+				return nil, nil, ErrShortPayload
+			}
+			d.TL0PicIdx = payload[pos]
+			pos++
+		}
+		if d.HasTID || d.HasKeyIdx {
+			if len(payload) <= pos {
+				return nil, nil, ErrShortPayload
+			}
+			tk := payload[pos]
+			pos++
+			if d.HasTID {
+				d.TID = tk >> 6
+				d.LayerSync = tk&0x20 != 0
+			}
+			if d.HasKeyIdx {
+				d.KeyIdx = tk & 0x1F
+			}
+		}
+	}
+	return d, payload[pos:], nil
+}
@@ -0,0 +1,148 @@
+package rtpvp8
+
+import "github.com/xlab/libvpx-go/vp8"
+
+// DefaultMTU is the default maximum RTP payload size, it leaves room for
+// the IP, UDP and RTP headers and a few header extensions on typical links.
+const DefaultMTU = 1200
+
+// Packetizer splits VP8 frames into RTP payloads. The marker bit must be set on
+// the RTP packet carrying the last payload of every frame.
+type Packetizer struct {
+	// MTU is the maximum size of a payload including the descriptor.
+	MTU int
+	// PictureID enables the 15-bit PictureID field which is incremented for every frame.
+	PictureID bool
+
+	pictureID uint16
+}
+
+// NewPacketizer returns a packetizer for the given MTU. If initialPictureID is
+// not negative, the PictureID field is enabled and starts at that value.
+func NewPacketizer(mtu int, initialPictureID int) *Packetizer {
+	p := &Packetizer{
+		MTU: mtu,
+	}
+	if initialPictureID >= 0 {
+		p.PictureID = true
+		p.pictureID = uint16(initialPictureID) & 0x7FFF
+	}
+	return p
+}
+
+// Packetize splits a frame into payloads without regard to partition boundaries,
+// all packets are labeled with PartID 0. The template supplies the per-frame fields
+// of the descriptor (N, TL0PICIDX, TID, Y, KEYIDX); S, PartID and PictureID are set
+// by the packetizer.
+func (p *Packetizer) Packetize(frame []byte, template Descriptor) ([][]byte, error) {
+	if len(frame) == 0 {
+		return nil, ErrEmptyFrame
+	}
+	d := p.frameDescriptor(template)
+	payloads, err := p.split(nil, frame, d)
+	if err != nil {
+		return nil, err
+	}
+	p.nextPicture()
+	return payloads, nil
+}
+
+// PacketizePartitions splits a frame given as a list of partitions so that every
+// partition starts a new packet, small partitions are aggregated as long as
+// they fit the MTU entirely. Partitions are either collected from the fragments
+// returned by an encoder with vpx.CodecUseOutputPartition, or obtained from a complete
+// frame with vp8.ParseFrame.
+func (p *Packetizer) PacketizePartitions(partitions [][]byte, template Descriptor) ([][]byte, error) {
+	if len(partitions) == 0 {
+		return nil, ErrEmptyFrame
+	}
+	if len(partitions) > MaxPartID+1 {
+		// Trailing partitions share the last index, which is allowed to keep the
+		// descriptor valid when a frame has more partitions than PartID can express.
+		merged := make([][]byte, MaxPartID+1)
+		copy(merged, partitions[:MaxPartID])
+		var tail []byte
+		for _, part := range partitions[MaxPartID:] {
+			tail = append(tail, part...)
+		}
+		merged[MaxPartID] = tail
+		partitions = merged
+	}
+	d := p.frameDescriptor(template)
+	max := p.MTU - d.Size()
+	if max <= 0 {
+		return nil, ErrMTUTooSmall
+	}
+	var payloads [][]byte
+	var err error
+	for i := 0; i < len(partitions); {
+		d.PartID = uint8(i)
+		if len(partitions[i]) > max {
+			if payloads, err = p.split(payloads, partitions[i], d); err != nil {
+				return nil, err
+			}
+			i++
+			continue
+		}
+		// aggregate whole partitions into a single packet
+		payload := d.AppendTo(make([]byte, 0, p.MTU))
+		payload = append(payload, partitions[i]...)
+		for i++; i < len(partitions) && len(payload)+len(partitions[i]) <= p.MTU; i++ {
+			payload = append(payload, partitions[i]...)
+		}
+		payloads = append(payloads, payload)
+	}
+	p.nextPicture()
+	return payloads, nil
+}
+
+// PacketizeFrame splits a complete frame at its partition boundaries, it falls back
+// to Packetize if the frame cannot be parsed.
+func (p *Packetizer) PacketizeFrame(frame []byte, template Descriptor) ([][]byte, error) {
+	f, err := vp8.ParseFrame(frame)
+	if err != nil {
+		return p.Packetize(frame, template)
+	}
+	return p.PacketizePartitions(f.Partitions, template)
+}
+
+// split appends payloads carrying data to the list, the first one has the S bit set.
+func (p *Packetizer) split(payloads [][]byte, data []byte, d Descriptor) ([][]byte, error) {
+	max := p.MTU - d.Size()
+	if max <= 0 {
+		return nil, ErrMTUTooSmall
+	}
+	// spread the data evenly so that the last packet is not tiny
+	n := (len(data) + max - 1) / max
+	size := (len(data) + n - 1) / n
+	d.Start = true
+	for len(data) > 0 {
+		chunk := size
+		if chunk > len(data) {
+			chunk = len(data)
+		}
+		payload := d.AppendTo(make([]byte, 0, d.Size()+chunk))
+		payloads = append(payloads, append(payload, data[:chunk]...))
+		data = data[chunk:]
+		d.Start = false
+	}
+	return payloads, nil
+}
+
+func (p *Packetizer) frameDescriptor(template Descriptor) Descriptor {
+	d := template
+	d.Start = true
+	d.PartID = 0
+	if p.PictureID {
+		d.HasPictureID = true
+		d.LongPictureID = true
+		d.PictureID = p.pictureID
+	}
+	return d
+}
+
+func (p *Packetizer) nextPicture() {
+	if p.PictureID {
+		p.pictureID = (p.pictureID + 1) & 0x7FFF
+	}
+}
@@ -0,0 +1,399 @@
+package rtpvp8
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestDescriptorRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		d    Descriptor
+		size int
+	}{
+		{"minimal", Descriptor{Start: true}, 1},
+		{"non reference partition", Descriptor{NonReference: true, PartID: 5}, 1},
+		{"7-bit picture id", Descriptor{Start: true, HasPictureID: true, PictureID: 0x7F}, 3},
+		{"15-bit picture id", Descriptor{Start: true, HasPictureID: true, LongPictureID: true, PictureID: 0x7FFF}, 4},
+		{"tl0picidx", Descriptor{HasTL0PicIdx: true, TL0PicIdx: 0xFF}, 3},
+		{"tid and layer sync", Descriptor{HasTID: true, TID: 3, LayerSync: true}, 3},
+		{"keyidx", Descriptor{HasKeyIdx: true, KeyIdx: 31}, 3},
+		{"all fields", Descriptor{
+			Start: true, PartID: 7,
+			HasPictureID: true, LongPictureID: true, PictureID: 0x1234,
+			HasTL0PicIdx: true, TL0PicIdx: 9,
+			HasTID: true, TID: 2, LayerSync: true,
+			HasKeyIdx: true, KeyIdx: 17,
+		}, 6},
+	}
+	for _, tt := range tests {
+		b := tt.d.Marshal()
+		if len(b) != tt.size || tt.d.Size() != tt.size {
+			t.Errorf("%s: size %d and Size %d, want %d", tt.name, len(b), tt.d.Size(), tt.size)
+		}
+		got, rest, err := ParseDescriptor(append(b, 0xAA, 0xBB))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if *got != tt.d {
+			t.Errorf("%s: parsed %+v, want %+v", tt.name, *got, tt.d)
+		}
+		if !bytes.Equal(rest, []byte{0xAA, 0xBB}) {
+			t.Errorf("%s: payload %x", tt.name, rest)
+		}
+	}
+}
+
+func TestDescriptorPictureIDWrap(t *testing.T) {
+	tests := []struct {
+		long bool
+		id   uint16
+		want uint16
+	}{
+		{false, 0x7F, 0x7F},
+		{false, 0x80, 0},
+		{false, 0x81, 1},
+		{true, 0x7FFF, 0x7FFF},
+		{true, 0x8000, 0},
+		{true, 0x8001, 1},
+	}
+	for _, tt := range tests {
+		d := Descriptor{HasPictureID: true, LongPictureID: tt.long, PictureID: tt.id}
+		got, _, err := ParseDescriptor(d.Marshal())
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got.PictureID != tt.want || got.LongPictureID != tt.long {
+			t.Errorf("picture id %#x long %v: parsed %#x long %v", tt.id, tt.long, got.PictureID, got.LongPictureID)
+		}
+	}
+}
+
+func TestParseDescriptorShort(t *testing.T) {
+	payloads := [][]byte{
+		{},
+		{0x80},
+		{0x80, 0x80},
+		{0x80, 0x80, 0x80},
+		{0x80, 0x40},
+		{0x80, 0x20},
+		{0x80, 0x10},
+	}
+	for _, payload := range payloads {
+		if _, _, err := ParseDescriptor(payload); err != ErrShortPayload {
+			t.Errorf("%x: error %v, want ErrShortPayload", payload, err)
+		}
+	}
+}
+
+func TestPacketizerPictureIDWrap(t *testing.T) {
+	p := NewPacketizer(DefaultMTU, 0x7FFE)
+	for _, want := range []uint16{0x7FFE, 0x7FFF, 0, 1} {
+		payloads, err := p.Packetize([]byte{0x00, 0x01, 0x02}, Descriptor{})
+		if err != nil {
+			t.Fatal(err)
+		}
+		d, _, err := ParseDescriptor(payloads[0])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !d.HasPictureID || !d.LongPictureID || d.PictureID != want {
+			t.Errorf("picture id %#x long %v, want %#x", d.PictureID, d.LongPictureID, want)
+		}
+	}
+	// without picture id the descriptor is a single byte
+	payloads, err := NewPacketizer(DefaultMTU, -1).Packetize([]byte{0x00}, Descriptor{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(payloads) != 1 || len(payloads[0]) != 2 {
+		t.Errorf("payloads %x", payloads)
+	}
+}
+
+func TestPacketizerTemplateFields(t *testing.T) {
+	p := NewPacketizer(20, 5)
+	template := Descriptor{
+		NonReference: true,
+		HasTL0PicIdx: true, TL0PicIdx: 200,
+		HasTID: true, TID: 1, LayerSync: true,
+		HasKeyIdx: true, KeyIdx: 4,
+		// set by the packetizer
+		Start: false, PartID: 3,
+	}
+	payloads, err := p.Packetize(make([]byte, 50), template)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, payload := range payloads {
+		d, _, err := ParseDescriptor(payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		want := template
+		want.Start = i == 0
+		want.PartID = 0
+		want.HasPictureID, want.LongPictureID, want.PictureID = true, true, 5
+		if *d != want {
+			t.Errorf("packet %d: descriptor %+v, want %+v", i, *d, want)
+		}
+	}
+}
+
+// partitionsOf returns the descriptors of the payloads and their concatenated data.
+func partitionsOf(t *testing.T, payloads [][]byte, mtu int) ([]*Descriptor, []byte) {
+	var ds []*Descriptor
+	var data []byte
+	for _, payload := range payloads {
+		if len(payload) > mtu {
+			t.Errorf("payload of %d bytes over the MTU %d", len(payload), mtu)
+		}
+		d, rest, err := ParseDescriptor(payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ds = append(ds, d)
+		data = append(data, rest...)
+	}
+	return ds, data
+}
+
+func filled(n int, v byte) []byte {
+	return bytes.Repeat([]byte{v}, n)
+}
+
+func TestPacketizePartitions(t *testing.T) {
+	const mtu = 50
+	partitions := [][]byte{filled(30, 0), filled(5, 1), filled(5, 2), filled(200, 3)}
+	payloads, err := NewPacketizer(mtu, 0).PacketizePartitions(partitions, Descriptor{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds, data := partitionsOf(t, payloads, mtu)
+	if !bytes.Equal(data, bytes.Join(partitions, nil)) {
+		t.Fatal("payloads do not hold the partitions")
+	}
+	// the three small partitions share a packet, the large one is split evenly
+	// into 46 bytes at most per packet
+	type desc struct {
+		start  bool
+		partID uint8
+		size   int
+	}
+	want := []desc{{true, 0, 40}, {true, 3, 40}, {false, 3, 40}, {false, 3, 40}, {false, 3, 40}, {false, 3, 40}}
+	if len(ds) != len(want) {
+		t.Fatalf("%d packets, want %d", len(ds), len(want))
+	}
+	for i, d := range ds {
+		got := desc{d.Start, d.PartID, len(payloads[i]) - d.Size()}
+		if got != want[i] {
+			t.Errorf("packet %d: %+v, want %+v", i, got, want[i])
+		}
+	}
+}
+
+func TestPacketizePartitionsAtMTU(t *testing.T) {
+	const mtu = 20
+	// the first and last partitions fill a packet exactly, each starts a new packet
+	partitions := [][]byte{filled(16, 0), filled(1, 1), filled(16, 2)}
+	payloads, err := NewPacketizer(mtu, 0).PacketizePartitions(partitions, Descriptor{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds, data := partitionsOf(t, payloads, mtu)
+	if !bytes.Equal(data, bytes.Join(partitions, nil)) {
+		t.Fatal("payloads do not hold the partitions")
+	}
+	var ids []uint8
+	for _, d := range ds {
+		if !d.Start {
+			t.Errorf("partition %d does not start its packet", d.PartID)
+		}
+		ids = append(ids, d.PartID)
+	}
+	if !bytes.Equal(ids, []uint8{0, 1, 2}) {
+		t.Errorf("partition ids %v", ids)
+	}
+}
+
+func TestPacketizeManyPartitions(t *testing.T) {
+	const mtu = 10
+	var partitions [][]byte
+	for i := 0; i < 10; i++ {
+		partitions = append(partitions, filled(8, byte(i)))
+	}
+	payloads, err := NewPacketizer(mtu, -1).PacketizePartitions(partitions, Descriptor{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	ds, data := partitionsOf(t, payloads, mtu)
+	if !bytes.Equal(data, bytes.Join(partitions, nil)) {
+		t.Fatal("payloads do not hold the partitions")
+	}
+	// the partitions past the last PartID are merged into it
+	last := ds[len(ds)-1]
+	if last.PartID != MaxPartID {
+		t.Errorf("last partition id %d, want %d", last.PartID, MaxPartID)
+	}
+	for _, d := range ds {
+		if d.PartID > MaxPartID {
+			t.Fatalf("partition id %d", d.PartID)
+		}
+	}
+}
+
+func TestPacketizerErrors(t *testing.T) {
+	p := NewPacketizer(4, 0)
+	if _, err := p.Packetize(nil, Descriptor{}); err != ErrEmptyFrame {
+		t.Errorf("empty frame: %v", err)
+	}
+	if _, err := p.PacketizePartitions(nil, Descriptor{}); err != ErrEmptyFrame {
+		t.Errorf("no partitions: %v", err)
+	}
+	// the descriptor with a 15-bit picture id takes the whole MTU
+	if _, err := p.Packetize([]byte{1}, Descriptor{}); err != ErrMTUTooSmall {
+		t.Errorf("small MTU: %v", err)
+	}
+}
+
+// packet is an RTP packet of a test stream.
+type packet struct {
+	seq     uint16
+	ts      uint32
+	marker  bool
+	payload []byte
+}
+
+func testFrame(n int, key bool) []byte {
+	frame := make([]byte, n)
+	for i := range frame {
+		frame[i] = byte(i * 7)
+	}
+	frame[0] = 0x11
+	if key {
+		frame[0] = 0x10
+	}
+	return frame
+}
+
+func packetize(t *testing.T, p *Packetizer, seq uint16, ts uint32, frame []byte) []packet {
+	payloads, err := p.Packetize(frame, Descriptor{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkts := make([]packet, len(payloads))
+	for i, payload := range payloads {
+		pkts[i] = packet{seq + uint16(i), ts, i == len(payloads)-1, payload}
+	}
+	return pkts
+}
+
+func TestRoundTrip(t *testing.T) {
+	p := NewPacketizer(100, 0x7FFE)
+	d := NewDepacketizer()
+	seq := uint16(65530)
+	for n := 0; n < 4; n++ {
+		frame := testFrame(450, n == 0)
+		pkts := packetize(t, p, seq, uint32(n*3000), frame)
+		seq += uint16(len(pkts))
+		for i, pkt := range pkts {
+			f, err := d.Push(pkt.seq, pkt.ts, pkt.marker, pkt.payload)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if i < len(pkts)-1 {
+				if f != nil {
+					t.Fatalf("frame %d returned before its marker", n)
+				}
+				continue
+			}
+			if f == nil || !bytes.Equal(f.Data, frame) {
+				t.Fatalf("frame %d not reassembled", n)
+			}
+			if f.KeyFrame != (n == 0) || f.Timestamp != uint32(n*3000) {
+				t.Errorf("frame %d: keyframe %v timestamp %d", n, f.KeyFrame, f.Timestamp)
+			}
+			if f.FirstSeq != pkts[0].seq || f.LastSeq != pkt.seq {
+				t.Errorf("frame %d: sequence numbers %d-%d", n, f.FirstSeq, f.LastSeq)
+			}
+			if want := uint16(0x7FFE+n) & 0x7FFF; f.Descriptor.PictureID != want {
+				t.Errorf("frame %d: picture id %#x, want %#x", n, f.Descriptor.PictureID, want)
+			}
+		}
+	}
+	if d.Dropped() != 0 {
+		t.Errorf("dropped %d frames", d.Dropped())
+	}
+}
+
+func TestDepacketizerLoss(t *testing.T) {
+	p := NewPacketizer(100, -1)
+	lost := packetize(t, p, 0, 0, testFrame(450, true))
+	next := packetize(t, p, uint16(len(lost)), 3000, testFrame(150, false))
+	if len(lost) < 4 || len(next) < 2 {
+		t.Fatalf("%d and %d packets", len(lost), len(next))
+	}
+
+	tests := []struct {
+		name string
+		// order lists the packets pushed by index in the two frames
+		order   []packet
+		errs    []error
+		dropped int
+	}{{
+		name:    "lost middle packet",
+		order:   []packet{lost[0], lost[2], lost[3], next[0], next[1]},
+		errs:    []error{nil, ErrIncompleteFrame, ErrUnexpectedPacket, nil, nil},
+		dropped: 1,
+	}, {
+		name:    "reordered packets",
+		order:   []packet{lost[0], lost[2], lost[1], next[0], next[1]},
+		errs:    []error{nil, ErrIncompleteFrame, ErrUnexpectedPacket, nil, nil},
+		dropped: 1,
+	}, {
+		name:    "lost first packet",
+		order:   []packet{lost[1], lost[2], next[0], next[1]},
+		errs:    []error{ErrUnexpectedPacket, ErrUnexpectedPacket, nil, nil},
+		dropped: 0,
+	}, {
+		// the next frame starts right away, only the count shows the loss
+		name:    "lost tail",
+		order:   []packet{lost[0], lost[1], next[0], next[1]},
+		errs:    []error{nil, nil, nil, nil},
+		dropped: 1,
+	}}
+	for _, tt := range tests {
+		d := NewDepacketizer()
+		var frames []*Frame
+		for i, pkt := range tt.order {
+			f, err := d.Push(pkt.seq, pkt.ts, pkt.marker, pkt.payload)
+			if err != tt.errs[i] {
+				t.Errorf("%s: packet %d: error %v, want %v", tt.name, i, err, tt.errs[i])
+			}
+			if f != nil {
+				frames = append(frames, f)
+			}
+		}
+		// the frames after the loss are always recovered
+		if len(frames) != 1 || frames[0].Timestamp != 3000 || frames[0].FirstSeq != next[0].seq {
+			t.Errorf("%s: frames %+v", tt.name, frames)
+		}
+		if d.Dropped() != tt.dropped {
+			t.Errorf("%s: dropped %d, want %d", tt.name, d.Dropped(), tt.dropped)
+		}
+	}
+}
+
+func TestDepacketizerReset(t *testing.T) {
+	p := NewPacketizer(100, -1)
+	pkts := packetize(t, p, 10, 0, testFrame(300, true))
+	d := NewDepacketizer()
+	if _, err := d.Push(pkts[0].seq, pkts[0].ts, pkts[0].marker, pkts[0].payload); err != nil {
+		t.Fatal(err)
+	}
+	d.Reset()
+	if _, err := d.Push(pkts[1].seq, pkts[1].ts, pkts[1].marker, pkts[1].payload); err != ErrUnexpectedPacket {
+		t.Errorf("error %v after reset, want ErrUnexpectedPacket", err)
+	}
+}
@@ -0,0 +1,169 @@
+package rtpvp9
+
+import "github.com/xlab/libvpx-go/vp9"
+
+// LayerFrame is a single spatial layer frame of a picture.
+type LayerFrame struct {
+	// Descriptor is the payload descriptor of the first packet of the layer frame.
+	Descriptor Descriptor
+	Data       []byte
+}
+
+// Picture is a VP9 picture reassembled from RTP packets, it holds one layer frame
+// per received spatial layer.
+type Picture struct {
+	Timestamp uint32
+	Frames    []LayerFrame
+	KeyFrame  bool
+	// Partial is set when the upper layers of the picture were lost, the remaining
+	// lower layers are still decodable.
+	Partial bool
+	// FirstSeq and LastSeq are the sequence numbers of the packets delimiting the picture.
+	FirstSeq uint16
+	LastSeq  uint16
+}
+
+// Data returns the picture as a single packet for the decoder, layer frames
+// are combined into a superframe.
+func (p *Picture) Data() ([]byte, error) {
+	if len(p.Frames) == 1 {
+		return p.Frames[0].Data, nil
+	}
+	frames := make([][]byte, 0, len(p.Frames))
+	for _, f := range p.Frames {
+		frames = append(frames, f.Data)
+	}
+	return vp9.BuildSuperframe(frames)
+}
+
+// Depacketizer reassembles VP9 pictures from RTP packets received in order.
+// Reordering is out of its scope, packets should go through a jitter buffer first.
+type Depacketizer struct {
+	pic      Picture
+	cur      *LayerFrame
+	active   bool
+	lastSeq  uint16
+	skipping bool
+	skipTs   uint32
+	dropped  int
+	ss       *ScalabilityStructure
+}
+
+// NewDepacketizer returns an empty depacketizer.
+func NewDepacketizer() *Depacketizer {
+	return &Depacketizer{}
+}
+
+// Push adds an RTP packet to the picture being assembled and returns the pictures
+// completed by it: the current one once the packet with the marker bit arrives, and
+// the previous one if packets were lost. When packets are lost, the layer frames
+// received in full before the gap are returned as a Partial picture along with
+// ErrIncompletePicture, and the rest of the picture is dropped. Packets are ignored
+// with ErrUnexpectedPacket until the base layer of the next picture begins.
+func (d *Depacketizer) Push(seq uint16, timestamp uint32, marker bool, payload []byte) ([]*Picture, error) {
+	desc, data, err := ParseDescriptor(payload)
+	if err != nil {
+		return nil, err
+	}
+	if desc.SS != nil {
+		d.ss = desc.SS
+	}
+	var pictures []*Picture
+	if d.active {
+		if timestamp != d.pic.Timestamp {
+			// the tail of the previous picture, including the marker, was lost
+			pictures, err = d.flush(pictures), ErrIncompletePicture
+		} else if seq != d.lastSeq+1 {
+			pictures, err = d.flush(pictures), ErrIncompletePicture
+			d.skipping, d.skipTs = true, timestamp
+		}
+	}
+	if d.skipping {
+		if timestamp == d.skipTs {
+			d.skipping = !marker
+			return pictures, ErrIncompletePicture
+		}
+		d.skipping = false
+	}
+	if !d.active {
+		if !desc.StartOfFrame || desc.SID != 0 {
+			if err == nil {
+				err = ErrUnexpectedPacket
+			}
+			return pictures, err
+		}
+		d.active = true
+		d.pic = Picture{
+			Timestamp: timestamp,
+			FirstSeq:  seq,
+		}
+	}
+	if desc.StartOfFrame || d.cur == nil {
+		d.endFrame()
+		d.cur = &LayerFrame{
+			Descriptor: *desc,
+		}
+	}
+	d.cur.Data = append(d.cur.Data, data...)
+	d.lastSeq = seq
+	if desc.EndOfFrame {
+		d.endFrame()
+	}
+	if marker {
+		d.endFrame()
+		pictures = append(pictures, d.finish(false))
+	}
+	return pictures, err
+}
+
+// SS returns the most recently received scalability structure or nil.
+func (d *Depacketizer) SS() *ScalabilityStructure {
+	return d.ss
+}
+
+// Dropped returns the number of pictures which lost some of their packets,
+// including the ones returned as Partial.
+func (d *Depacketizer) Dropped() int {
+	return d.dropped
+}
+
+// Reset drops the picture being assembled, e.g. after a seek.
+func (d *Depacketizer) Reset() {
+	d.active = false
+	d.skipping = false
+	d.pic = Picture{}
+	d.cur = nil
+}
+
+func (d *Depacketizer) endFrame() {
+	if d.cur != nil {
+		d.pic.Frames = append(d.pic.Frames, *d.cur)
+		d.cur = nil
+	}
+}
+
+// flush ends the current picture after a loss, the layer frame in progress is incomplete.
+func (d *Depacketizer) flush(pictures []*Picture) []*Picture {
+	d.cur = nil
+	d.dropped++
+	if len(d.pic.Frames) == 0 {
+		d.Reset()
+		return pictures
+	}
+	return append(pictures, d.finish(true))
+}
+
+func (d *Depacketizer) finish(partial bool) *Picture {
+	p := d.pic
+	p.Partial = partial
+	p.LastSeq = d.lastSeq
+	if len(p.Frames) > 0 {
+		if h, _ := vp9.ParseHeader(p.Frames[0].Data); h != nil {
+			p.KeyFrame = h.IsKeyframe()
+		} else {
+			p.KeyFrame = !p.Frames[0].Descriptor.InterPicturePredicted
+		}
+	}
+	d.Reset()
+	return &p
+}
@@ -0,0 +1,248 @@
+// Package rtpvp9 implements the RTP payload format for VP9 as specified by RFC 9628:
+// the payload descriptor with the scalability structure, a packetizer for encoder
+// output including superframes and spatial layers, and a depacketizer that
+// reassembles pictures for the decoder. Both flexible and non-flexible modes are supported.
+package rtpvp9
+
+import "errors"
+
+var (
+	ErrShortPayload        = errors.New("rtpvp9: payload is too short")
+	ErrTooManyReferences   = errors.New("rtpvp9: at most 3 reference indices are allowed")
+	ErrInvalidReference    = errors.New("rtpvp9: reference index must be in range 1..127")
+	ErrMissingReference    = errors.New("rtpvp9: inter-picture predicted frame in flexible mode has no reference index")
+	ErrTooManyLayers       = errors.New("rtpvp9: at most 8 spatial layers are allowed")
+	ErrTooManyPictureGroup = errors.New("rtpvp9: at most 255 pictures are allowed in a picture group")
+	ErrMTUTooSmall         = errors.New("rtpvp9: MTU is too small for the payload descriptor")
+	ErrEmptyFrame          = errors.New("rtpvp9: empty frame")
+	ErrIncompletePicture   = errors.New("rtpvp9: picture is incomplete due to lost packets")
+	ErrUnexpectedPacket    = errors.New("rtpvp9: packet does not start a picture")
+)
+
+const (
+	// MaxReferences is the maximum number of P_DIFF fields in a descriptor.
+	MaxReferences = 3
+	// MaxSpatialLayers is the maximum number of spatial layers the SS can describe.
+	MaxSpatialLayers = 8
+)
+
+// Descriptor is the VP9 payload descriptor, see section 4.2 of RFC 9628.
+type Descriptor struct {
+	// InterPicturePredicted (P) indicates the frame uses references to previous pictures.
+	InterPicturePredicted bool
+	// FlexibleMode (F) indicates references are signalled with PDiff
+	// instead of the TL0PicIdx and the scalability structure.
+	FlexibleMode bool
+	// StartOfFrame (B) and EndOfFrame (E) delimit a layer frame.
+	StartOfFrame bool
+	EndOfFrame   bool
+	// NotUpperLayerReference (Z) indicates the frame is not used by upper spatial layers.
+	NotUpperLayerReference bool
+
+	HasPictureID bool
+	// PictureID is either 7 or 15 bits long, see LongPictureID.
+	PictureID     uint16
+	LongPictureID bool
+
+	// HasLayerIndices (L) enables TID, SwitchingUpPoint, SID, InterLayerDependency
+	// and, in non-flexible mode, TL0PicIdx.
+	HasLayerIndices bool
+	TID             uint8
+	// SwitchingUpPoint (U) indicates that a switch up to a higher temporal layer is possible.
+	SwitchingUpPoint bool
+	SID              uint8
+	// InterLayerDependency (D) indicates the frame depends on the lower spatial layer.
+	InterLayerDependency bool
+	TL0PicIdx            uint8
+
+	// PDiff are the reference indices of a flexible mode inter-picture predicted frame,
+	// the referenced picture ID is PictureID-PDiff[i].
+	PDiff []uint8
+
+	// SS is the scalability structure (V), it is usually sent with the first
+	// packet of a keyframe.
+	SS *ScalabilityStructure
+}
+
+// Size returns the size of the marshalled descriptor in bytes.
+func (d *Descriptor) Size() int {
+	size := 1
+	if d.HasPictureID {
+		size++
+		if d.LongPictureID {
+			size++
+		}
+	}
+	if d.HasLayerIndices {
+		size++
+		if !d.FlexibleMode {
+			size++
+		}
+	}
+	if d.FlexibleMode && d.InterPicturePredicted {
+		size += len(d.PDiff)
+	}
+	if d.SS != nil {
+		size += d.SS.size()
+	}
+	return size
+}
+
+// AppendTo appends the marshalled descriptor to buf and returns the extended buffer.
+// A flexible mode inter-picture predicted frame must have at least one PDiff.
+func (d *Descriptor) AppendTo(buf []byte) ([]byte, error) {
+	var b byte
+	if d.HasPictureID {
+		b |= 0x80
+	}
+	if d.InterPicturePredicted {
+		b |= 0x40
+	}
+	if d.HasLayerIndices {
+		b |= 0x20
+	}
+	if d.FlexibleMode {
+		b |= 0x10
+	}
+	if d.StartOfFrame {
+		b |= 0x08
+	}
+	if d.EndOfFrame {
+		b |= 0x04
+	}
+	if d.SS != nil {
+		b |= 0x02
+	}
+	if d.NotUpperLayerReference {
+		b |= 0x01
+	}
+	buf = append(buf, b)
+	if d.HasPictureID {
+		if d.LongPictureID {
+			buf = append(buf, 0x80|byte(d.PictureID>>8)&0x7F, byte(d.PictureID))
+		} else {
+			buf = append(buf, byte(d.PictureID)&0x7F)
+		}
+	}
+	if d.HasLayerIndices {
+		l := (d.TID&0x07)<<5 | (d.SID&0x07)<<1
+		if d.SwitchingUpPoint {
+			l |= 0x10
+		}
+		if d.InterLayerDependency {
+			l |= 0x01
+		}
+		buf = append(buf, l)
+		if !d.FlexibleMode {
+			buf = append(buf, d.TL0PicIdx)
+		}
+	}
+	if d.FlexibleMode && d.InterPicturePredicted {
+		if len(d.PDiff) == 0 {
+			return nil, ErrMissingReference
+		}
+		if len(d.PDiff) > MaxReferences {
+			return nil, ErrTooManyReferences
+		}
+		for i, diff := range d.PDiff {
+			if diff == 0 || diff > 0x7F {
+				return nil, ErrInvalidReference
+			}
+			n := diff << 1
+			if i < len(d.PDiff)-1 {
+				n |= 0x01
+			}
+			buf = append(buf, n)
+		}
+	}
+	if d.SS != nil {
+		var err error
+		if buf, err = d.SS.appendTo(buf); err != nil {
+			return nil, err
+		}
+	}
+	return buf, nil
+}
+
+// Marshal returns the descriptor in the wire format.
+func (d *Descriptor) Marshal() ([]byte, error) {
+	return d.AppendTo(make([]byte, 0, d.Size()))
+}
+
+// ParseDescriptor parses the payload descriptor at the beginning of an RTP payload
+// and returns it along with the VP9 payload that follows.
+func ParseDescriptor(payload []byte) (*Descriptor, []byte, error) {
+	r := &reader{data: payload}
+	b := r.byte()
+	d := &Descriptor{
+		HasPictureID:           b&0x80 != 0,
+		InterPicturePredicted:  b&0x40 != 0,
+		HasLayerIndices:        b&0x20 != 0,
+		FlexibleMode:           b&0x10 != 0,
+		StartOfFrame:           b&0x08 != 0,
+		EndOfFrame:             b&0x04 != 0,
+		NotUpperLayerReference: b&0x01 != 0,
+	}
+	if d.HasPictureID {
+		pid := r.byte()
+		if pid&0x80 != 0 {
+			d.LongPictureID = true
+			d.PictureID = uint16(pid&0x7F)<<8 | uint16(r.byte())
+		} else {
+			d.PictureID = uint16(pid)
+		}
+	}
+	if d.HasLayerIndices {
+		l := r.byte()
+		d.TID = l >> 5
+		d.SwitchingUpPoint = l&0x10 != 0
+		d.SID = (l >> 1) & 0x07
+		d.InterLayerDependency = l&0x01 != 0
+		if !d.FlexibleMode {
+			d.TL0PicIdx = r.byte()
+		}
+	}
+	if d.FlexibleMode && d.InterPicturePredicted {
+		for {
+			n := r.byte()
+			if r.err != nil {
+				break
+			}
+			if len(d.PDiff) == MaxReferences {
+				return nil, nil, ErrTooManyReferences
+			}
+			d.PDiff = append(d.PDiff, n>>1)
+			if n&0x01 == 0 {
+				break
+			}
+		}
+	}
+	if b&0x02 != 0 {
+		d.SS = r.scalabilityStructure()
+	}
+	if r.err != nil {
+		return nil, nil, r.err
+	}
+	return d, payload[r.pos:], nil
+}
+
+// reader consumes bytes and records the first out of bounds access.
+type reader struct {
+	data []byte
+	pos  int
+	err  error
+}
+
+func (r *reader) byte() byte {
+	if r.pos >= len(r.data) {
+		r.err = ErrShortPayload
+		return 0
+	}
+	b := r.data[r.pos]
+	r.pos++
+	return b
+}
+
+func (r *reader) uint16() uint16 {
+	return uint16(r.byte())<<8 | uint16(r.byte())
+}
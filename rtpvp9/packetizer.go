@@ -0,0 +1,163 @@
+package rtpvp9
+
+import "github.com/xlab/libvpx-go/vp9"
+
+// DefaultMTU is the default maximum RTP payload size, it leaves room for
+// the IP, UDP and RTP headers and a few header extensions on typical links.
+const DefaultMTU = 1200
+
+// Packetizer splits VP9 pictures into RTP payloads. The marker bit must be set on
+// the RTP packet carrying the last payload of every picture.
+type Packetizer struct {
+	// MTU is the maximum size of a payload including the descriptor.
+	MTU int
+	// PictureID enables the 15-bit PictureID field which is incremented for every picture.
+	PictureID bool
+	// SS is sent with the first packet of every keyframe. With more than one
+	// spatial layer the frames of a superframe are sent as separate layer frames,
+	// and the picture group provides the temporal layer of each picture.
+	SS *ScalabilityStructure
+
+	pictureID uint16
+	tl0PicIdx uint8
+	pictures  int
+	started   bool
+}
+
+// NewPacketizer returns a packetizer for the given MTU. If initialPictureID is
+// not negative, the PictureID field is enabled and starts at that value. The
+// scalability structure may be nil for streams without layers.
+func NewPacketizer(mtu int, initialPictureID int, ss *ScalabilityStructure) *Packetizer {
+	p := &Packetizer{
+		MTU: mtu,
+		SS:  ss,
+	}
+	if initialPictureID >= 0 {
+		p.PictureID = true
+		p.pictureID = uint16(initialPictureID) & 0x7FFF
+	}
+	return p
+}
+
+// Packetize splits a picture, that is a packet returned by the encoder which may be
+// a superframe, into payloads. The template supplies the fields the packetizer
+// cannot infer: FlexibleMode and PDiff, NotUpperLayerReference and, if set, the layer
+// indices that otherwise come from SS. B, E, P, D, SID, PictureID, TL0PicIdx and SS are
+// set by the packetizer. In flexible mode the references of inter-picture predicted
+// frames come from the template PDiff or the picture group, ErrMissingReference is
+// returned and nothing is sent if neither has any.
+func (p *Packetizer) Packetize(picture []byte, template Descriptor) ([][]byte, error) {
+	if len(picture) == 0 {
+		return nil, ErrEmptyFrame
+	}
+	frames := [][]byte{picture}
+	if p.SS != nil && p.SS.SpatialLayers > 1 {
+		var err error
+		if frames, err = vp9.SplitSuperframe(picture); err != nil {
+			return nil, err
+		} else if len(frames) == 0 {
+			return nil, ErrEmptyFrame
+		}
+	}
+	keyPicture := false
+	if h, _ := vp9.ParseHeader(frames[0]); h != nil {
+		keyPicture = h.IsKeyframe()
+	}
+	if keyPicture {
+		// the picture group restarts with every keyframe
+		p.pictures = 0
+	}
+	d := template
+	d.SS = nil
+	if p.PictureID {
+		d.HasPictureID = true
+		d.LongPictureID = true
+		d.PictureID = p.pictureID
+	}
+	if p.SS != nil && !template.HasLayerIndices && (p.SS.SpatialLayers > 1 || len(p.SS.PictureGroup) > 0) {
+		d.HasLayerIndices = true
+		d.TID = p.SS.TemporalLayer(p.pictures)
+		if len(p.SS.PictureGroup) > 0 {
+			g := p.SS.PictureGroup[p.pictures%len(p.SS.PictureGroup)]
+			d.SwitchingUpPoint = g.SwitchingUpPoint
+			if d.FlexibleMode && len(d.PDiff) == 0 {
+				d.PDiff = g.PDiff
+			}
+		}
+	}
+	if d.HasLayerIndices && !d.FlexibleMode {
+		if d.TID == 0 && p.started {
+			p.tl0PicIdx++
+		}
+		d.TL0PicIdx = p.tl0PicIdx
+	}
+
+	var payloads [][]byte
+	for i, frame := range frames {
+		fd := d
+		fd.SID = uint8(i)
+		fd.InterLayerDependency = i > 0
+		fd.InterPicturePredicted = !keyPicture
+		if !keyPicture && i > 0 {
+			if h, _ := vp9.ParseHeader(frame); h != nil && h.IsIntra() {
+				fd.InterPicturePredicted = false
+			}
+		}
+		if !fd.InterPicturePredicted {
+			fd.PDiff = nil
+		}
+		if keyPicture && i == 0 {
+			fd.SS = p.SS
+		}
+		var err error
+		if payloads, err = p.split(payloads, frame, fd); err != nil {
+			return nil, err
+		}
+	}
+	p.pictures++
+	p.started = true
+	if p.PictureID {
+		p.pictureID = (p.pictureID + 1) & 0x7FFF
+	}
+	return payloads, nil
+}
+
+// split appends payloads carrying a layer frame to the list, B is set on the first
+// one and E on the last one, SS is only sent with the first packet.
+func (p *Packetizer) split(payloads [][]byte, data []byte, d Descriptor) ([][]byte, error) {
+	first := d
+	first.StartOfFrame = true
+	d.SS = nil
+	max := p.MTU - d.Size()
+	firstMax := p.MTU - first.Size()
+	if max <= 0 || firstMax <= 0 {
+		return nil, ErrMTUTooSmall
+	}
+	// spread the data evenly so that the last packet is not tiny
+	n := 1
+	if len(data) > firstMax {
+		n += (len(data) - firstMax + max - 1) / max
+	}
+	size := (len(data) + n - 1) / n
+	for i := 0; len(data) > 0; i++ {
+		pd, limit := d, max
+		if i == 0 {
+			pd, limit = first, firstMax
+		}
+		chunk := size
+		if chunk > limit {
+			chunk = limit
+		}
+		if chunk > len(data) {
+			chunk = len(data)
+		}
+		pd.EndOfFrame = chunk == len(data)
+		payload, err := pd.AppendTo(make([]byte, 0, pd.Size()+chunk))
+		if err != nil {
+			return nil, err
+		}
+		payloads = append(payloads, append(payload, data[:chunk]...))
+		data = data[chunk:]
+	}
+	return payloads, nil
+}
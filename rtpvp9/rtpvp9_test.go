@@ -0,0 +1,509 @@
+package rtpvp9
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+
+	"github.com/xlab/libvpx-go/vp9"
+	"github.com/xlab/libvpx-go/vpx"
+)
+
+func TestDescriptorRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		d    Descriptor
+		size int
+	}{
+		{"minimal", Descriptor{StartOfFrame: true, EndOfFrame: true}, 1},
+		{"7-bit picture id", Descriptor{HasPictureID: true, PictureID: 0x7F, NotUpperLayerReference: true}, 2},
+		{"15-bit picture id", Descriptor{HasPictureID: true, LongPictureID: true, PictureID: 0x7FFF}, 3},
+		{"non-flexible layer indices", Descriptor{
+			HasPictureID: true, PictureID: 0x45, InterPicturePredicted: true,
+			HasLayerIndices: true, TID: 2, SwitchingUpPoint: true, SID: 1, InterLayerDependency: true, TL0PicIdx: 200,
+		}, 4},
+		{"flexible layer indices", Descriptor{
+			FlexibleMode: true, HasLayerIndices: true, TID: 7, SID: 7,
+		}, 2},
+		{"flexible references", Descriptor{
+			HasPictureID: true, LongPictureID: true, PictureID: 0x7ABC,
+			FlexibleMode: true, InterPicturePredicted: true, PDiff: []uint8{1, 2, 127},
+		}, 6},
+		// P is also set in non-flexible mode, PDiff is not sent then
+		{"non-flexible inter frame", Descriptor{InterPicturePredicted: true, EndOfFrame: true}, 1},
+		{"all fields", Descriptor{
+			StartOfFrame: true, NotUpperLayerReference: true,
+			HasPictureID: true, LongPictureID: true, PictureID: 0x1234,
+			HasLayerIndices: true, TID: 1, SID: 2, InterLayerDependency: true,
+			FlexibleMode: true, InterPicturePredicted: true, PDiff: []uint8{3},
+			SS: &ScalabilityStructure{SpatialLayers: 2, Resolutions: []Resolution{{640, 360}, {1280, 720}}},
+		}, 14},
+	}
+	for _, tt := range tests {
+		b, err := tt.d.Marshal()
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if len(b) != tt.size || tt.d.Size() != tt.size {
+			t.Errorf("%s: size %d and Size %d, want %d", tt.name, len(b), tt.d.Size(), tt.size)
+		}
+		got, rest, err := ParseDescriptor(append(b, 0xAA, 0xBB))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if !reflect.DeepEqual(*got, tt.d) {
+			t.Errorf("%s: parsed %+v, want %+v", tt.name, *got, tt.d)
+		}
+		if !bytes.Equal(rest, []byte{0xAA, 0xBB}) {
+			t.Errorf("%s: payload %x", tt.name, rest)
+		}
+	}
+}
+
+func TestScalabilityStructureRoundTrip(t *testing.T) {
+	tests := []struct {
+		name string
+		ss   ScalabilityStructure
+		size int
+	}{
+		{"single layer", ScalabilityStructure{SpatialLayers: 1}, 1},
+		{"resolutions", ScalabilityStructure{
+			SpatialLayers: 3,
+			Resolutions:   []Resolution{{320, 180}, {640, 360}, {1280, 720}},
+		}, 13},
+		{"picture group", ScalabilityStructure{
+			SpatialLayers: 1,
+			PictureGroup: []PictureGroupEntry{
+				{TID: 0, PDiff: []uint8{4}},
+				{TID: 2, SwitchingUpPoint: true, PDiff: []uint8{1}},
+				{TID: 1, SwitchingUpPoint: true, PDiff: []uint8{2}},
+				{TID: 2, PDiff: []uint8{1, 3, 255}},
+			},
+		}, 12},
+		{"max layers", ScalabilityStructure{
+			SpatialLayers: MaxSpatialLayers,
+			Resolutions:   make([]Resolution, MaxSpatialLayers),
+			PictureGroup:  []PictureGroupEntry{{TID: 0}},
+		}, 35},
+	}
+	for _, tt := range tests {
+		d := Descriptor{StartOfFrame: true, SS: &tt.ss}
+		b, err := d.Marshal()
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if len(b) != 1+tt.size || tt.ss.size() != tt.size {
+			t.Errorf("%s: size %d, want %d", tt.name, len(b)-1, tt.size)
+		}
+		got, rest, err := ParseDescriptor(b)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if len(rest) != 0 || !reflect.DeepEqual(*got.SS, tt.ss) {
+			t.Errorf("%s: parsed %+v, want %+v", tt.name, *got.SS, tt.ss)
+		}
+	}
+}
+
+func TestDescriptorErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		d    Descriptor
+		err  error
+	}{
+		{"missing reference", Descriptor{FlexibleMode: true, InterPicturePredicted: true}, ErrMissingReference},
+		{"too many references", Descriptor{FlexibleMode: true, InterPicturePredicted: true, PDiff: []uint8{1, 2, 3, 4}}, ErrTooManyReferences},
+		{"zero reference", Descriptor{FlexibleMode: true, InterPicturePredicted: true, PDiff: []uint8{0}}, ErrInvalidReference},
+		{"reference out of range", Descriptor{FlexibleMode: true, InterPicturePredicted: true, PDiff: []uint8{128}}, ErrInvalidReference},
+		{"no spatial layers", Descriptor{SS: &ScalabilityStructure{}}, ErrTooManyLayers},
+		{"too many spatial layers", Descriptor{SS: &ScalabilityStructure{SpatialLayers: 9}}, ErrTooManyLayers},
+		{"picture group too long", Descriptor{SS: &ScalabilityStructure{
+			SpatialLayers: 1, PictureGroup: make([]PictureGroupEntry, 256),
+		}}, ErrTooManyPictureGroup},
+		{"picture group references", Descriptor{SS: &ScalabilityStructure{
+			SpatialLayers: 1, PictureGroup: []PictureGroupEntry{{PDiff: []uint8{1, 2, 3, 4}}},
+		}}, ErrTooManyReferences},
+	}
+	for _, tt := range tests {
+		if _, err := tt.d.Marshal(); err != tt.err {
+			t.Errorf("%s: error %v, want %v", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestParseDescriptorErrors(t *testing.T) {
+	tests := []struct {
+		name    string
+		payload []byte
+		err     error
+	}{
+		{"empty", []byte{}, ErrShortPayload},
+		{"picture id", []byte{0x80}, ErrShortPayload},
+		{"15-bit picture id", []byte{0x80, 0x80}, ErrShortPayload},
+		{"layer indices", []byte{0x20}, ErrShortPayload},
+		{"tl0picidx", []byte{0x20, 0x00}, ErrShortPayload},
+		{"references", []byte{0x50}, ErrShortPayload},
+		{"continued references", []byte{0x50, 0x03}, ErrShortPayload},
+		{"four references", []byte{0x50, 0x03, 0x05, 0x07, 0x08}, ErrTooManyReferences},
+		{"scalability structure", []byte{0x02}, ErrShortPayload},
+		{"resolutions", []byte{0x02, 0x30, 0x01, 0x40, 0x00}, ErrShortPayload},
+		{"picture group", []byte{0x02, 0x08, 0x02, 0x04}, ErrShortPayload},
+	}
+	for _, tt := range tests {
+		if _, _, err := ParseDescriptor(tt.payload); err != tt.err {
+			t.Errorf("%s: error %v, want %v", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestNewScalabilityStructure(t *testing.T) {
+	cfg := &vpx.CodecEncCfg{
+		GW: 1280, GH: 720,
+		SsNumberLayers: 2,
+		TsNumberLayers: 3, TsPeriodicity: 4, TsLayerID: [16]uint32{0, 2, 1, 2},
+	}
+	ss, err := NewScalabilityStructure(cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := &ScalabilityStructure{
+		SpatialLayers: 2,
+		Resolutions:   []Resolution{{640, 360}, {1280, 720}},
+		PictureGroup: []PictureGroupEntry{
+			{TID: 0, PDiff: []uint8{4}},
+			{TID: 2, SwitchingUpPoint: true, PDiff: []uint8{1}},
+			{TID: 1, SwitchingUpPoint: true, PDiff: []uint8{2}},
+			{TID: 2, SwitchingUpPoint: true, PDiff: []uint8{1}},
+		},
+	}
+	if !reflect.DeepEqual(ss, want) {
+		t.Errorf("scalability structure %+v, want %+v", ss, want)
+	}
+	for n, tid := range []uint8{0, 2, 1, 2, 0} {
+		if got := ss.TemporalLayer(n); got != tid {
+			t.Errorf("picture %d: temporal layer %d, want %d", n, got, tid)
+		}
+	}
+
+	ss, err = NewScalabilityStructure(cfg, []ScalingFactor{{2, 3}, {1, 1}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ss.Resolutions[0] != (Resolution{854, 480}) {
+		t.Errorf("scaled resolution %+v", ss.Resolutions[0])
+	}
+	cfg.SsNumberLayers = MaxSpatialLayers + 1
+	if _, err := NewScalabilityStructure(cfg, nil); err != ErrTooManyLayers {
+		t.Errorf("error %v, want ErrTooManyLayers", err)
+	}
+}
+
+// keyFrame returns a 64x64 VP9 keyframe of n bytes, the uncompressed header
+// is followed by a 1 byte compressed header.
+func keyFrame(n int) []byte {
+	return frameOf(n, 0x82, 0x49, 0x83, 0x42, 0x00, 0x03, 0xf0, 0x03, 0xf4, 0x14, 0x07, 0x80, 0x00, 0x01)
+}
+
+// interFrame returns a 64x64 VP9 inter frame of n bytes which refreshes the first slot.
+func interFrame(n int) []byte {
+	return frameOf(n, 0x86, 0x00, 0x40, 0x90, 0x00, 0x1f, 0x80, 0x1f, 0xb8, 0x28, 0x0f, 0x00, 0x00, 0x02)
+}
+
+func frameOf(n int, header ...byte) []byte {
+	frame := make([]byte, n)
+	for i := range frame {
+		frame[i] = byte(i * 7)
+	}
+	copy(frame, header)
+	return frame
+}
+
+// packet is an RTP packet of a test stream.
+type packet struct {
+	seq     uint16
+	ts      uint32
+	marker  bool
+	payload []byte
+}
+
+func packetize(t *testing.T, p *Packetizer, seq uint16, ts uint32, picture []byte, template Descriptor) []packet {
+	payloads, err := p.Packetize(picture, template)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pkts := make([]packet, len(payloads))
+	for i, payload := range payloads {
+		if len(payload) > p.MTU {
+			t.Errorf("payload of %d bytes over the MTU %d", len(payload), p.MTU)
+		}
+		pkts[i] = packet{seq + uint16(i), ts, i == len(payloads)-1, payload}
+	}
+	return pkts
+}
+
+func descriptorsOf(t *testing.T, pkts []packet) ([]*Descriptor, []byte) {
+	var ds []*Descriptor
+	var data []byte
+	for _, pkt := range pkts {
+		d, rest, err := ParseDescriptor(pkt.payload)
+		if err != nil {
+			t.Fatal(err)
+		}
+		ds = append(ds, d)
+		data = append(data, rest...)
+	}
+	return ds, data
+}
+
+func TestPacketize(t *testing.T) {
+	const mtu = 100
+	ss := &ScalabilityStructure{SpatialLayers: 1, Resolutions: []Resolution{{640, 360}}}
+	p := NewPacketizer(mtu, 0x7FFF, ss)
+	key := keyFrame(250)
+	pkts := packetize(t, p, 0, 0, key, Descriptor{})
+	ds, data := descriptorsOf(t, pkts)
+	if !bytes.Equal(data, key) {
+		t.Fatal("payloads do not hold the keyframe")
+	}
+	// the data is spread evenly, the first packet carries the scalability structure
+	if len(pkts) != 3 || len(pkts[0].payload)-ds[0].Size() != 84 || len(pkts[1].payload)-ds[1].Size() != 84 {
+		t.Fatalf("%d packets", len(pkts))
+	}
+	for i, d := range ds {
+		if d.StartOfFrame != (i == 0) || d.EndOfFrame != (i == len(ds)-1) {
+			t.Errorf("packet %d: B %v E %v", i, d.StartOfFrame, d.EndOfFrame)
+		}
+		if (d.SS != nil) != (i == 0) {
+			t.Errorf("packet %d: scalability structure %+v", i, d.SS)
+		}
+		if d.InterPicturePredicted || !d.LongPictureID || d.PictureID != 0x7FFF || d.HasLayerIndices {
+			t.Errorf("packet %d: descriptor %+v", i, d)
+		}
+	}
+
+	inter := interFrame(50)
+	pkts = packetize(t, p, 3, 3000, inter, Descriptor{NotUpperLayerReference: true})
+	ds, data = descriptorsOf(t, pkts)
+	if len(pkts) != 1 || !bytes.Equal(data, inter) {
+		t.Fatalf("%d packets", len(pkts))
+	}
+	want := Descriptor{
+		InterPicturePredicted: true, StartOfFrame: true, EndOfFrame: true, NotUpperLayerReference: true,
+		HasPictureID: true, LongPictureID: true, PictureID: 0,
+	}
+	if !reflect.DeepEqual(*ds[0], want) {
+		t.Errorf("descriptor %+v, want %+v", *ds[0], want)
+	}
+}
+
+func TestPacketizeFlexibleMode(t *testing.T) {
+	ss := &ScalabilityStructure{
+		SpatialLayers: 1,
+		PictureGroup: []PictureGroupEntry{
+			{TID: 0, PDiff: []uint8{2}},
+			{TID: 1, SwitchingUpPoint: true, PDiff: []uint8{1}},
+		},
+	}
+	p := NewPacketizer(DefaultMTU, 10, ss)
+	flexible := Descriptor{FlexibleMode: true}
+	pkts := packetize(t, p, 0, 0, keyFrame(20), flexible)
+	ds, _ := descriptorsOf(t, pkts)
+	if ds[0].InterPicturePredicted || ds[0].PDiff != nil || ds[0].SS == nil {
+		t.Errorf("keyframe descriptor %+v", ds[0])
+	}
+	// the references come from the picture group unless the template has them
+	pkts = packetize(t, p, 1, 3000, interFrame(20), flexible)
+	ds, _ = descriptorsOf(t, pkts)
+	if !ds[0].InterPicturePredicted || ds[0].TID != 1 || !ds[0].SwitchingUpPoint || !bytes.Equal(ds[0].PDiff, []uint8{1}) {
+		t.Errorf("inter frame descriptor %+v", ds[0])
+	}
+	pkts = packetize(t, p, 2, 6000, interFrame(20), Descriptor{FlexibleMode: true, PDiff: []uint8{1, 2}})
+	ds, _ = descriptorsOf(t, pkts)
+	if ds[0].TID != 0 || !bytes.Equal(ds[0].PDiff, []uint8{1, 2}) || ds[0].PictureID != 12 {
+		t.Errorf("inter frame descriptor %+v", ds[0])
+	}
+
+	// without a picture group an inter frame has no reference to send
+	p = NewPacketizer(DefaultMTU, 10, nil)
+	if _, err := p.Packetize(interFrame(20), flexible); err != ErrMissingReference {
+		t.Errorf("error %v, want ErrMissingReference", err)
+	}
+	// the failed picture does not use up a picture id
+	pkts = packetize(t, p, 0, 0, interFrame(20), Descriptor{FlexibleMode: true, PDiff: []uint8{1}})
+	ds, _ = descriptorsOf(t, pkts)
+	if ds[0].PictureID != 10 {
+		t.Errorf("picture id %d, want 10", ds[0].PictureID)
+	}
+}
+
+func TestPacketizerErrors(t *testing.T) {
+	p := NewPacketizer(3, 0, nil)
+	if _, err := p.Packetize(nil, Descriptor{}); err != ErrEmptyFrame {
+		t.Errorf("empty picture: %v", err)
+	}
+	// the descriptor with a 15-bit picture id takes the whole MTU
+	if _, err := p.Packetize(interFrame(10), Descriptor{}); err != ErrMTUTooSmall {
+		t.Errorf("small MTU: %v", err)
+	}
+	p = NewPacketizer(DefaultMTU, -1, &ScalabilityStructure{SpatialLayers: 2})
+	if _, err := p.Packetize(interFrame(10)[:1], Descriptor{}); err != nil {
+		t.Errorf("picture that is not a superframe: %v", err)
+	}
+}
+
+func TestSpatialLayersRoundTrip(t *testing.T) {
+	cfg := &vpx.CodecEncCfg{
+		GW: 640, GH: 360,
+		SsNumberLayers: 2,
+		TsNumberLayers: 2, TsPeriodicity: 2, TsLayerID: [16]uint32{0, 1},
+	}
+	ss, err := NewScalabilityStructure(cfg, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := NewPacketizer(100, 10, ss)
+	d := NewDepacketizer()
+	var seq uint16
+	for n := 0; n < 4; n++ {
+		l0, l1 := interFrame(90), interFrame(310)
+		if n == 0 {
+			l0, l1 = keyFrame(150), interFrame(230)
+		}
+		picture, err := vp9.BuildSuperframe([][]byte{l0, l1})
+		if err != nil {
+			t.Fatal(err)
+		}
+		pkts := packetize(t, p, seq, uint32(n*3000), picture, Descriptor{})
+		seq += uint16(len(pkts))
+		for i, pkt := range pkts {
+			pictures, err := d.Push(pkt.seq, pkt.ts, pkt.marker, pkt.payload)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !pkt.marker {
+				if len(pictures) != 0 {
+					t.Fatalf("picture %d returned before its marker", n)
+				}
+				continue
+			}
+			if len(pictures) != 1 || len(pictures[0].Frames) != 2 {
+				t.Fatalf("picture %d: %+v", n, pictures)
+			}
+			pic := pictures[0]
+			if pic.KeyFrame != (n == 0) || pic.Partial || pic.FirstSeq != pkts[0].seq || pic.LastSeq != pkts[i].seq {
+				t.Errorf("picture %d: %+v", n, pic)
+			}
+			for sid, f := range pic.Frames {
+				fd := f.Descriptor
+				if fd.SID != uint8(sid) || fd.InterLayerDependency != (sid > 0) || fd.TID != uint8(n%2) ||
+					fd.PictureID != uint16(10+n) || fd.TL0PicIdx != uint8(n/2) {
+					t.Errorf("picture %d layer %d: descriptor %+v", n, sid, fd)
+				}
+			}
+			data, err := pic.Data()
+			if err != nil || !bytes.Equal(data, picture) {
+				t.Errorf("picture %d: data differs, error %v", n, err)
+			}
+		}
+	}
+	if !reflect.DeepEqual(d.SS(), ss) {
+		t.Errorf("scalability structure %+v, want %+v", d.SS(), ss)
+	}
+	if d.Dropped() != 0 {
+		t.Errorf("dropped %d pictures", d.Dropped())
+	}
+}
+
+func TestDepacketizerLoss(t *testing.T) {
+	ss := &ScalabilityStructure{SpatialLayers: 2}
+	p := NewPacketizer(100, -1, ss)
+	l0 := keyFrame(150)
+	picture, err := vp9.BuildSuperframe([][]byte{l0, interFrame(300)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	lost := packetize(t, p, 0, 0, picture, Descriptor{})
+	picture, err = vp9.BuildSuperframe([][]byte{interFrame(50), interFrame(50)})
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := packetize(t, p, uint16(len(lost)), 3000, picture, Descriptor{})
+	// two packets for the base layer, four for the upper layer
+	if len(lost) != 6 || len(next) != 2 {
+		t.Fatalf("%d and %d packets", len(lost), len(next))
+	}
+
+	tests := []struct {
+		name    string
+		order   []packet
+		errs    []error
+		partial bool
+		dropped int
+	}{{
+		name:    "lost upper layer packet",
+		order:   []packet{lost[0], lost[1], lost[2], lost[4], lost[5], next[0], next[1]},
+		errs:    []error{nil, nil, nil, ErrIncompletePicture, ErrIncompletePicture, nil, nil},
+		partial: true,
+		dropped: 1,
+	}, {
+		name:    "lost base layer packet",
+		order:   []packet{lost[0], lost[2], lost[3], next[0], next[1]},
+		errs:    []error{nil, ErrIncompletePicture, ErrIncompletePicture, nil, nil},
+		dropped: 1,
+	}, {
+		name:    "lost first packet",
+		order:   []packet{lost[1], lost[2], next[0], next[1]},
+		errs:    []error{ErrUnexpectedPacket, ErrUnexpectedPacket, nil, nil},
+		dropped: 0,
+	}, {
+		name:    "lost tail",
+		order:   []packet{lost[0], lost[1], lost[2], next[0], next[1]},
+		errs:    []error{nil, nil, nil, ErrIncompletePicture, nil},
+		partial: true,
+		dropped: 1,
+	}}
+	for _, tt := range tests {
+		d := NewDepacketizer()
+		var pictures []*Picture
+		for i, pkt := range tt.order {
+			pics, err := d.Push(pkt.seq, pkt.ts, pkt.marker, pkt.payload)
+			if err != tt.errs[i] {
+				t.Errorf("%s: packet %d: error %v, want %v", tt.name, i, err, tt.errs[i])
+			}
+			pictures = append(pictures, pics...)
+		}
+		// the base layer received in full is still returned
+		if tt.partial {
+			if len(pictures) != 2 || !pictures[0].Partial || len(pictures[0].Frames) != 1 ||
+				!pictures[0].KeyFrame || !bytes.Equal(pictures[0].Frames[0].Data, l0) {
+				t.Errorf("%s: pictures %+v", tt.name, pictures)
+				continue
+			}
+			pictures = pictures[1:]
+		}
+		// the picture after the loss is always recovered
+		if len(pictures) != 1 || pictures[0].Partial || pictures[0].Timestamp != 3000 || pictures[0].FirstSeq != next[0].seq {
+			t.Errorf("%s: pictures %+v", tt.name, pictures)
+		}
+		if d.Dropped() != tt.dropped {
+			t.Errorf("%s: dropped %d, want %d", tt.name, d.Dropped(), tt.dropped)
+		}
+	}
+}
+
+func TestDepacketizerReset(t *testing.T) {
+	p := NewPacketizer(100, -1, nil)
+	pkts := packetize(t, p, 10, 0, keyFrame(300), Descriptor{})
+	d := NewDepacketizer()
+	if _, err := d.Push(pkts[0].seq, pkts[0].ts, pkts[0].marker, pkts[0].payload); err != nil {
+		t.Fatal(err)
+	}
+	d.Reset()
+	if _, err := d.Push(pkts[1].seq, pkts[1].ts, pkts[1].marker, pkts[1].payload); err != ErrUnexpectedPacket {
+		t.Errorf("error %v after reset, want ErrUnexpectedPacket", err)
+	}
+}
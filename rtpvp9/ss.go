@@ -0,0 +1,187 @@
+package rtpvp9
+
+import "github.com/xlab/libvpx-go/vpx"
+
+// ScalabilityStructure describes the spatial layers and the picture group
+// of a scalable stream, see section 4.2.1 of RFC 9628.
+type ScalabilityStructure struct {
+	// SpatialLayers is the number of spatial layers, from 1 to 8.
+	SpatialLayers int
+	// Resolutions are the frame sizes of the spatial layers, the Y flag is set when present.
+	Resolutions []Resolution
+	// PictureGroup describes the temporal structure, the G flag is set when present.
+	PictureGroup []PictureGroupEntry
+}
+
+// Resolution is the size of a spatial layer frame.
+type Resolution struct {
+	Width  uint16
+	Height uint16
+}
+
+// PictureGroupEntry describes a picture in the picture group.
+type PictureGroupEntry struct {
+	TID              uint8
+	SwitchingUpPoint bool
+	// PDiff are the distances in pictures to the referenced pictures.
+	PDiff []uint8
+}
+
+// ScalingFactor is the size of a spatial layer relative to the full resolution,
+// as set with the VP9E_SET_SVC_PARAMETERS control.
+type ScalingFactor struct {
+	Num int
+	Den int
+}
+
+// NewScalabilityStructure fills the scalability structure from the encoder
+// configuration: the resolutions are derived from GW, GH and the spatial layer
+// scaling factors, the picture group from TsPeriodicity and TsLayerID. If scaling
+// is nil each spatial layer is half the size of the one above, as libvpx
+// does by default. Only the Go side fields of cfg are used, call cfg.Deref
+// first if it was filled by libvpx.
+func NewScalabilityStructure(cfg *vpx.CodecEncCfg, scaling []ScalingFactor) (*ScalabilityStructure, error) {
+	layers := int(cfg.SsNumberLayers)
+	if layers < 1 {
+		layers = 1
+	}
+	if layers > MaxSpatialLayers {
+		return nil, ErrTooManyLayers
+	}
+	ss := &ScalabilityStructure{
+		SpatialLayers: layers,
+		Resolutions:   make([]Resolution, layers),
+	}
+	for i := range ss.Resolutions {
+		num, den := 1, 1<<uint(layers-1-i)
+		if i < len(scaling) && scaling[i].Num > 0 && scaling[i].Den > 0 {
+			num, den = scaling[i].Num, scaling[i].Den
+		}
+		ss.Resolutions[i] = Resolution{
+			Width:  uint16((int(cfg.GW)*num + den - 1) / den),
+			Height: uint16((int(cfg.GH)*num + den - 1) / den),
+		}
+	}
+	if cfg.TsNumberLayers > 1 && cfg.TsPeriodicity > 0 {
+		period := int(cfg.TsPeriodicity)
+		if period > len(cfg.TsLayerID) {
+			period = len(cfg.TsLayerID)
+		}
+		ss.PictureGroup = make([]PictureGroupEntry, period)
+		for i := range ss.PictureGroup {
+			tid := cfg.TsLayerID[i]
+			entry := PictureGroupEntry{
+				TID:              uint8(tid),
+				SwitchingUpPoint: tid > 0,
+			}
+			// reference the closest previous picture of the same or a lower layer
+			for diff := 1; diff <= period; diff++ {
+				ref := cfg.TsLayerID[(i-diff+period)%period]
+				if ref <= tid {
+					if ref == tid {
+						entry.SwitchingUpPoint = false
+					}
+					entry.PDiff = []uint8{uint8(diff)}
+					break
+				}
+			}
+			ss.PictureGroup[i] = entry
+		}
+	}
+	return ss, nil
+}
+
+// TemporalLayer returns the temporal layer of the n-th picture of the stream
+// according to the picture group.
+func (ss *ScalabilityStructure) TemporalLayer(n int) uint8 {
+	if len(ss.PictureGroup) == 0 {
+		return 0
+	}
+	return ss.PictureGroup[n%len(ss.PictureGroup)].TID
+}
+
+func (ss *ScalabilityStructure) size() int {
+	size := 1
+	if len(ss.Resolutions) > 0 {
+		size += 4 * ss.SpatialLayers
+	}
+	if len(ss.PictureGroup) > 0 {
+		size++
+		for _, g := range ss.PictureGroup {
+			size += 1 + len(g.PDiff)
+		}
+	}
+	return size
+}
+
+func (ss *ScalabilityStructure) appendTo(buf []byte) ([]byte, error) {
+	if ss.SpatialLayers < 1 || ss.SpatialLayers > MaxSpatialLayers {
+		return nil, ErrTooManyLayers
+	}
+	if len(ss.PictureGroup) > 255 {
+		return nil, ErrTooManyPictureGroup
+	}
+	v := byte(ss.SpatialLayers-1) << 5
+	if len(ss.Resolutions) > 0 {
+		v |= 0x10
+	}
+	if len(ss.PictureGroup) > 0 {
+		v |= 0x08
+	}
+	buf = append(buf, v)
+	if len(ss.Resolutions) > 0 {
+		for i := 0; i < ss.SpatialLayers; i++ {
+			var r Resolution
+			if i < len(ss.Resolutions) {
+				r = ss.Resolutions[i]
+			}
+			buf = append(buf, byte(r.Width>>8), byte(r.Width), byte(r.Height>>8), byte(r.Height))
+		}
+	}
+	if len(ss.PictureGroup) > 0 {
+		buf = append(buf, byte(len(ss.PictureGroup)))
+		for _, g := range ss.PictureGroup {
+			if len(g.PDiff) > MaxReferences {
+				return nil, ErrTooManyReferences
+			}
+			e := (g.TID&0x07)<<5 | byte(len(g.PDiff))<<2
+			if g.SwitchingUpPoint {
+				e |= 0x10
+			}
+			buf = append(buf, e)
+			buf = append(buf, g.PDiff...)
+		}
+	}
+	return buf, nil
+}
+
+func (r *reader) scalabilityStructure() *ScalabilityStructure {
+	v := r.byte()
+	ss := &ScalabilityStructure{
+		SpatialLayers: int(v>>5) + 1,
+	}
+	if v&0x10 != 0 {
+		ss.Resolutions = make([]Resolution, ss.SpatialLayers)
+		for i := range ss.Resolutions {
+			ss.Resolutions[i].Width = r.uint16()
+			ss.Resolutions[i].Height = r.uint16()
+		}
+	}
+	if v&0x08 != 0 {
+		n := int(r.byte())
+		ss.PictureGroup = make([]PictureGroupEntry, 0, n)
+		for i := 0; i < n && r.err == nil; i++ {
+			e := r.byte()
+			g := PictureGroupEntry{
+				TID:              e >> 5,
+				SwitchingUpPoint: e&0x10 != 0,
+			}
+			refs := int(e>>2) & 0x03
+			for j := 0; j < refs; j++ {
+				g.PDiff = append(g.PDiff, r.byte())
+			}
+			ss.PictureGroup = append(ss.PictureGroup, g)
+		}
+	}
+	return ss
+}
@@ -0,0 +1,71 @@
+package vp8
+
+// boolDecoder is the boolean entropy decoder described in section 7 of RFC 6386.
+type boolDecoder struct {
+	data     []byte
+	pos      int
+	value    uint32
+	rng      uint32
+	bitCount int
+	// overrun is set once the decoder needed bytes past the end of data.
+	overrun bool
+}
+
+func newBoolDecoder(data []byte) *boolDecoder {
+	d := &boolDecoder{
+		data: data,
+		rng:  255,
+	}
+	for i := 0; i < 2; i++ {
+		d.value <<= 8
+		d.fill()
+	}
+	return d
+}
+
+func (d *boolDecoder) readBool(prob uint8) bool {
+	split := 1 + (((d.rng - 1) * uint32(prob)) >> 8)
+	bigSplit := split << 8
+	var bit bool
+	if d.value >= bigSplit {
+		bit = true
+		d.rng -= split
+		d.value -= bigSplit
+	} else {
+		d.rng = split
+	}
+	for d.rng < 128 {
+		d.value <<= 1
+		d.rng <<= 1
+		if d.bitCount++; d.bitCount == 8 {
+			d.bitCount = 0
+			d.fill()
+		}
+	}
+	return bit
+}
+
+func (d *boolDecoder) fill() {
+	if d.pos < len(d.data) {
+		d.value |= uint32(d.data[d.pos])
+		d.pos++
+	} else {
+		d.overrun = true
+	}
+}
+
+// literal reads an n-bit unsigned value, most significant bit first.
+func (d *boolDecoder) literal(n int) uint32 {
+	var v uint32
+	for i := 0; i < n; i++ {
+		v <<= 1
+		if d.readBool(128) {
+			v |= 1
+		}
+	}
+	return v
+}
+
+func (d *boolDecoder) flag() bool {
+	return d.readBool(128)
+}
@@ -0,0 +1,259 @@
+// Package vp8 implements parsing of the VP8 frame header and partition layout
+// as described in RFC 6386. It is pure Go and does not depend on libvpx.
+package vp8
+
+import "errors"
+
+const (
+	frameTagSize       = 3
+	keyFrameHeaderSize = 10
+	partitionSizeLen   = 3
+
+	startCode0 = 0x9d
+	startCode1 = 0x01
+	startCode2 = 0x2a
+
+	// MaxPartitions is the maximum number of DCT token partitions.
+	MaxPartitions = 8
+)
+
+var (
+	ErrShortFrame         = errors.New("vp8: frame is too short")
+	ErrInvalidStartCode   = errors.New("vp8: invalid keyframe start code")
+	ErrInvalidVersion     = errors.New("vp8: invalid version")
+	ErrInvalidPartition   = errors.New("vp8: first partition size exceeds frame size")
+	ErrTruncatedPartition = errors.New("vp8: token partition exceeds frame size")
+)
+
+// FrameHeader holds the uncompressed data chunk at the beginning of a VP8 frame:
+// the frame tag and, for keyframes, the start code and frame dimensions.
+type FrameHeader struct {
+	KeyFrame      bool
+	Version       uint8
+	ShowFrame     bool
+	FirstPartSize uint32
+
+	// Keyframe only fields.
+	Width      uint16
+	Height     uint16
+	HorizScale uint8
+	VertScale  uint8
+
+	// Size is the size of the uncompressed data chunk in bytes, 10 for
+	// keyframes and 3 for interframes.
+	Size int
+}
+
+// Frame is a VP8 frame split into its partitions.
+type Frame struct {
+	FrameHeader
+
+	// ColorSpace and ClampingType are only coded in keyframes.
+	ColorSpace          uint8
+	ClampingType        uint8
+	SegmentationEnabled bool
+	FilterType          uint8
+	LoopFilterLevel     uint8
+	SharpnessLevel      uint8
+	// QIndex is the base quantizer index of the frame (y_ac_qi).
+	QIndex uint8
+
+	// Reference buffer updates, see section 9.7 of RFC 6386. Keyframes refresh all
+	// buffers. CopyToGolden is 1 for the last frame and 2 for the altref frame,
+	// CopyToAltRef is 1 for the last frame and 2 for the golden frame.
+	RefreshGolden       bool
+	RefreshAltRef       bool
+	CopyToGolden        uint8
+	CopyToAltRef        uint8
+	SignBiasGolden      bool
+	SignBiasAltRef      bool
+	RefreshEntropyProbs bool
+	RefreshLast         bool
+
+	// FirstPartition is the bool-coded first partition holding the modes and motion vectors.
+	FirstPartition []byte
+	// TokenPartitions are the DCT token partitions, there are 1, 2, 4 or 8 of them.
+	TokenPartitions [][]byte
+	// Partitions split the whole frame at partition boundaries: the first one
+	// contains the uncompressed chunk, the first partition and the partition
+	// size table, the rest are the token partitions. This is the layout
+	// RTP packetizers use for the PartID field.
+	Partitions [][]byte
+}
+
+// ParseFrameHeader parses the frame tag and, for keyframes, the start code and dimensions.
+func ParseFrameHeader(data []byte) (*FrameHeader, error) {
+	if len(data) < frameTagSize {
+		return nil, ErrShortFrame
+	}
+	tag := uint32(data[0]) | uint32(data[1])<<8 | uint32(data[2])<<16
+	h := &FrameHeader{
+		KeyFrame:      tag&1 == 0,
+		Version:       uint8((tag >> 1) & 7),
+		ShowFrame:     (tag>>4)&1 == 1,
+		FirstPartSize: (tag >> 5) & 0x7FFFF,
+		Size:          frameTagSize,
+	}
+	if h.Version > 3 {
+		return nil, ErrInvalidVersion
+	}
+	if !h.KeyFrame {
+		return h, nil
+	}
+	if len(data) < keyFrameHeaderSize {
+		return nil, ErrShortFrame
+	}
+	if data[3] != startCode0 || data[4] != startCode1 || data[5] != startCode2 {
+		return nil, ErrInvalidStartCode
+	}
+	w := uint16(data[6]) | uint16(data[7])<<8
+	hh := uint16(data[8]) | uint16(data[9])<<8
+	h.Width, h.HorizScale = w&0x3FFF, uint8(w>>14)
+	h.Height, h.VertScale = hh&0x3FFF, uint8(hh>>14)
+	h.Size = keyFrameHeaderSize
+	return h, nil
+}
+
+// ParseFrame parses the frame header and the beginning of the first partition
+// up to the number of token partitions, and splits the frame into partitions.
+// The returned slices share memory with data.
+func ParseFrame(data []byte) (*Frame, error) {
+	h, err := ParseFrameHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	f := &Frame{
+		FrameHeader: *h,
+	}
+	firstEnd := h.Size + int(h.FirstPartSize)
+	if firstEnd > len(data) {
+		return nil, ErrInvalidPartition
+	}
+	f.FirstPartition = data[h.Size:firstEnd:firstEnd]
+	numPartitions := f.parseFirstPartition(newBoolDecoder(f.FirstPartition))
+
+	tableEnd := firstEnd + partitionSizeLen*(numPartitions-1)
+	if tableEnd > len(data) {
+		return nil, ErrTruncatedPartition
+	}
+	table := data[firstEnd:tableEnd]
+	f.TokenPartitions = make([][]byte, numPartitions)
+	f.Partitions = make([][]byte, 0, numPartitions+1)
+	f.Partitions = append(f.Partitions, data[:tableEnd:tableEnd])
+	offset := tableEnd
+	for i := 0; i < numPartitions; i++ {
+		end := len(data)
+		if i < numPartitions-1 {
+			size := int(table[0]) | int(table[1])<<8 | int(table[2])<<16
+			table = table[partitionSizeLen:]
+			end = offset + size
+			if end > len(data) {
+				return nil, ErrTruncatedPartition
+			}
+		}
+		f.TokenPartitions[i] = data[offset:end:end]
+		f.Partitions = append(f.Partitions, f.TokenPartitions[i])
+		offset = end
+	}
+	return f, nil
+}
+
+// ParseFrameRefresh parses the frame header and the first partition fields up to
+// the reference buffer updates. Unlike ParseFrame it does not need the whole frame,
+// the beginning of the first partition is enough, so it can be used on the first
+// packet of a frame whose other packets were lost. Partitions are not set.
+func ParseFrameRefresh(data []byte) (*Frame, error) {
+	h, err := ParseFrameHeader(data)
+	if err != nil {
+		return nil, err
+	}
+	f := &Frame{
+		FrameHeader: *h,
+	}
+	firstEnd := h.Size + int(h.FirstPartSize)
+	truncated := firstEnd > len(data)
+	if truncated {
+		firstEnd = len(data)
+	}
+	f.FirstPartition = data[h.Size:firstEnd:firstEnd]
+	d := newBoolDecoder(f.FirstPartition)
+	f.parseFirstPartition(d)
+	if d.overrun && truncated {
+		return nil, ErrShortFrame
+	}
+	return f, nil
+}
+
+// parseFirstPartition reads the frame header fields coded in the first partition
+// (RFC 6386 section 19.2) up to refresh_last and returns the number of token partitions.
+func (f *Frame) parseFirstPartition(d *boolDecoder) int {
+	if f.KeyFrame {
+		f.ColorSpace = uint8(d.literal(1))
+		f.ClampingType = uint8(d.literal(1))
+	}
+	if f.SegmentationEnabled = d.flag(); f.SegmentationEnabled {
+		updateMap := d.flag()
+		if d.flag() { // update_segment_feature_data
+			d.flag() // segment_feature_mode
+			for i := 0; i < 4; i++ {
+				if d.flag() {
+					d.literal(7) // quantizer_update_value
+					d.flag()     // quantizer_update_sign
+				}
+			}
+			for i := 0; i < 4; i++ {
+				if d.flag() {
+					d.literal(6) // loop_filter_update_value
+					d.flag()     // loop_filter_update_sign
+				}
+			}
+		}
+		if updateMap {
+			for i := 0; i < 3; i++ {
+				if d.flag() {
+					d.literal(8) // segment_prob
+				}
+			}
+		}
+	}
+	f.FilterType = uint8(d.literal(1))
+	f.LoopFilterLevel = uint8(d.literal(6))
+	f.SharpnessLevel = uint8(d.literal(3))
+	if d.flag() { // loop_filter_adj_enable
+		if d.flag() { // mode_ref_lf_delta_update
+			for i := 0; i < 8; i++ {
+				if d.flag() {
+					d.literal(6) // delta_magnitude
+					d.flag()     // delta_sign
+				}
+			}
+		}
+	}
+	numPartitions := 1 << d.literal(2)
+
+	f.QIndex = uint8(d.literal(7))
+	for i := 0; i < 5; i++ { // y_dc, y2_dc, y2_ac, uv_dc, uv_ac deltas
+		if d.flag() {
+			d.literal(4) // delta magnitude
+			d.flag()     // delta sign
+		}
+	}
+	if f.KeyFrame {
+		f.RefreshGolden, f.RefreshAltRef, f.RefreshLast = true, true, true
+		f.RefreshEntropyProbs = d.flag()
+		return numPartitions
+	}
+	f.RefreshGolden = d.flag()
+	f.RefreshAltRef = d.flag()
+	if !f.RefreshGolden {
+		f.CopyToGolden = uint8(d.literal(2))
+	}
+	if !f.RefreshAltRef {
+		f.CopyToAltRef = uint8(d.literal(2))
+	}
+	f.SignBiasGolden = d.flag()
+	f.SignBiasAltRef = d.flag()
+	f.RefreshEntropyProbs = d.flag()
+	f.RefreshLast = d.flag()
+	return numPartitions
+}
@@ -0,0 +1,393 @@
+package vp8
+
+import (
+	"bytes"
+	"testing"
+)
+
+// boolEncoder is the boolean entropy encoder of RFC 6386 section 7.3.
+type boolEncoder struct {
+	out      []byte
+	rng      uint32
+	bottom   uint32
+	bitCount int
+}
+
+func newBoolEncoder() *boolEncoder {
+	return &boolEncoder{rng: 255, bitCount: 24}
+}
+
+func (e *boolEncoder) addOne() {
+	i := len(e.out) - 1
+	for i >= 0 && e.out[i] == 255 {
+		e.out[i] = 0
+		i--
+	}
+	e.out[i]++
+}
+
+func (e *boolEncoder) put(prob uint8, v bool) {
+	split := 1 + (((e.rng - 1) * uint32(prob)) >> 8)
+	if v {
+		e.bottom += split
+		e.rng -= split
+	} else {
+		e.rng = split
+	}
+	for e.rng < 128 {
+		e.rng <<= 1
+		if e.bottom&(1<<31) != 0 {
+			e.addOne()
+		}
+		e.bottom <<= 1
+		if e.bitCount--; e.bitCount == 0 {
+			e.out = append(e.out, byte(e.bottom>>24))
+			e.bottom &= 1<<24 - 1
+			e.bitCount = 8
+		}
+	}
+}
+
+func (e *boolEncoder) literal(v uint32, n int) {
+	for i := n - 1; i >= 0; i-- {
+		e.put(128, v>>uint(i)&1 == 1)
+	}
+}
+
+func (e *boolEncoder) flag(v bool) {
+	e.put(128, v)
+}
+
+func (e *boolEncoder) flush() []byte {
+	c := e.bitCount
+	v := e.bottom
+	if v&(1<<uint(32-c)) != 0 {
+		e.addOne()
+	}
+	v <<= uint(c & 7)
+	for c >>= 3; c > 0; c-- {
+		v <<= 8
+	}
+	for i := 0; i < 4; i++ {
+		e.out = append(e.out, byte(v>>24))
+		v <<= 8
+	}
+	return e.out
+}
+
+// testFrame describes a frame to build, the zero value is a shown inter frame
+// with a single token partition.
+type testFrame struct {
+	key     bool
+	version uint32
+	hidden  bool
+
+	width, height  uint16
+	hscale, vscale uint8
+
+	colorSpace, clamping uint32
+	segmentation         bool
+	filterType           uint32
+	level, sharpness     uint32
+	lfDeltas             bool
+	qIndex               uint32
+
+	refreshGolden, refreshAltRef   bool
+	copyToGolden, copyToAltRef     uint32
+	signBiasGolden, signBiasAltRef bool
+	refreshProbs, refreshLast      bool
+
+	// partitions are the token partitions, 1, 2, 4 or 8 of them
+	partitions [][]byte
+}
+
+func (f testFrame) firstPartition() []byte {
+	e := newBoolEncoder()
+	if f.key {
+		e.literal(f.colorSpace, 1)
+		e.literal(f.clamping, 1)
+	}
+	e.flag(f.segmentation)
+	if f.segmentation {
+		e.flag(true) // update_mb_segmentation_map
+		e.flag(true) // update_segment_feature_data
+		e.flag(false)
+		for i := 0; i < 4; i++ {
+			e.flag(true)
+			e.literal(uint32(i*10), 7)
+			e.flag(i%2 == 1)
+		}
+		for i := 0; i < 4; i++ {
+			e.flag(false)
+		}
+		for i := 0; i < 3; i++ {
+			e.flag(true)
+			e.literal(200, 8)
+		}
+	}
+	e.literal(f.filterType, 1)
+	e.literal(f.level, 6)
+	e.literal(f.sharpness, 3)
+	e.flag(f.lfDeltas)
+	if f.lfDeltas {
+		e.flag(true)
+		for i := 0; i < 8; i++ {
+			e.flag(i != 4)
+			if i != 4 {
+				e.literal(uint32(i), 6)
+				e.flag(true)
+			}
+		}
+	}
+	var log2 uint32
+	for 1<<log2 < len(f.partitions) {
+		log2++
+	}
+	e.literal(log2, 2)
+	e.literal(f.qIndex, 7)
+	for i := 0; i < 5; i++ {
+		e.flag(i == 1)
+		if i == 1 {
+			e.literal(3, 4)
+			e.flag(true)
+		}
+	}
+	if f.key {
+		e.flag(f.refreshProbs)
+	} else {
+		e.flag(f.refreshGolden)
+		e.flag(f.refreshAltRef)
+		if !f.refreshGolden {
+			e.literal(f.copyToGolden, 2)
+		}
+		if !f.refreshAltRef {
+			e.literal(f.copyToAltRef, 2)
+		}
+		e.flag(f.signBiasGolden)
+		e.flag(f.signBiasAltRef)
+		e.flag(f.refreshProbs)
+		e.flag(f.refreshLast)
+	}
+	// the token probability updates and the modes follow
+	for i := 0; i < 200; i++ {
+		e.flag(i%3 == 0)
+	}
+	return e.flush()
+}
+
+func (f testFrame) bytes() []byte {
+	first := f.firstPartition()
+	tag := f.version<<1 | uint32(len(first))<<5
+	if !f.key {
+		tag |= 1
+	}
+	if !f.hidden {
+		tag |= 1 << 4
+	}
+	data := []byte{byte(tag), byte(tag >> 8), byte(tag >> 16)}
+	if f.key {
+		w := f.width | uint16(f.hscale)<<14
+		h := f.height | uint16(f.vscale)<<14
+		data = append(data, startCode0, startCode1, startCode2, byte(w), byte(w>>8), byte(h), byte(h>>8))
+	}
+	data = append(data, first...)
+	for _, p := range f.partitions[:len(f.partitions)-1] {
+		data = append(data, byte(len(p)), byte(len(p)>>8), byte(len(p)>>16))
+	}
+	for _, p := range f.partitions {
+		data = append(data, p...)
+	}
+	return data
+}
+
+func TestParseFrameHeader(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		want FrameHeader
+	}{{
+		name: "keyframe",
+		data: []byte{0x50, 0x02, 0x00, 0x9d, 0x01, 0x2a, 0x80, 0x02, 0xe0, 0x01},
+		want: FrameHeader{KeyFrame: true, ShowFrame: true, FirstPartSize: 18, Width: 640, Height: 480, Size: 10},
+	}, {
+		name: "keyframe with scaling",
+		data: []byte{0x52, 0x02, 0x00, 0x9d, 0x01, 0x2a, 0x80, 0x42, 0xe0, 0xc1},
+		want: FrameHeader{KeyFrame: true, Version: 1, ShowFrame: true, FirstPartSize: 18,
+			Width: 640, HorizScale: 1, Height: 480, VertScale: 3, Size: 10},
+	}, {
+		name: "hidden inter frame",
+		data: []byte{0x07, 0x10, 0x00},
+		want: FrameHeader{Version: 3, FirstPartSize: 128, Size: 3},
+	}, {
+		// the largest first partition size is 19 bits
+		name: "inter frame",
+		data: []byte{0xf1, 0xff, 0xff, 0x00},
+		want: FrameHeader{ShowFrame: true, FirstPartSize: 0x7FFFF, Size: 3},
+	}}
+	for _, tt := range tests {
+		h, err := ParseFrameHeader(tt.data)
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if *h != tt.want {
+			t.Errorf("%s: header %+v, want %+v", tt.name, *h, tt.want)
+		}
+	}
+}
+
+func TestParseFrameHeaderErrors(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{"empty", nil, ErrShortFrame},
+		{"short tag", []byte{0x51, 0x02}, ErrShortFrame},
+		{"short keyframe", []byte{0x50, 0x02, 0x00, 0x9d, 0x01, 0x2a, 0x80}, ErrShortFrame},
+		{"start code", []byte{0x50, 0x02, 0x00, 0x9d, 0x01, 0x2b, 0x80, 0x02, 0xe0, 0x01}, ErrInvalidStartCode},
+		{"version", []byte{0x09, 0x02, 0x00}, ErrInvalidVersion},
+	}
+	for _, tt := range tests {
+		if _, err := ParseFrameHeader(tt.data); err != tt.err {
+			t.Errorf("%s: error %v, want %v", tt.name, err, tt.err)
+		}
+	}
+}
+
+func TestParseKeyframe(t *testing.T) {
+	partitions := [][]byte{{1}, {2, 2}, {3, 3, 3}, {4, 4, 4, 4, 4}}
+	frame := testFrame{
+		key:   true,
+		width: 1280, height: 720,
+		hscale:       2,
+		colorSpace:   1,
+		clamping:     1,
+		segmentation: true,
+		filterType:   1,
+		level:        33, sharpness: 5,
+		lfDeltas:     true,
+		qIndex:       100,
+		refreshProbs: true,
+		partitions:   partitions,
+	}
+	data := frame.bytes()
+	f, err := ParseFrame(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !f.KeyFrame || !f.ShowFrame || f.Width != 1280 || f.Height != 720 || f.HorizScale != 2 {
+		t.Errorf("header %+v", f.FrameHeader)
+	}
+	if f.ColorSpace != 1 || f.ClampingType != 1 || !f.SegmentationEnabled || f.FilterType != 1 ||
+		f.LoopFilterLevel != 33 || f.SharpnessLevel != 5 || f.QIndex != 100 {
+		t.Errorf("frame fields %+v", f)
+	}
+	// keyframes refresh all the buffers
+	if !f.RefreshGolden || !f.RefreshAltRef || !f.RefreshLast || !f.RefreshEntropyProbs {
+		t.Errorf("refresh golden %v altref %v last %v probs %v",
+			f.RefreshGolden, f.RefreshAltRef, f.RefreshLast, f.RefreshEntropyProbs)
+	}
+	first := frame.firstPartition()
+	if !bytes.Equal(f.FirstPartition, first) {
+		t.Errorf("first partition of %d bytes, want %d", len(f.FirstPartition), len(first))
+	}
+	if len(f.TokenPartitions) != len(partitions) {
+		t.Fatalf("%d token partitions, want %d", len(f.TokenPartitions), len(partitions))
+	}
+	for i, p := range f.TokenPartitions {
+		if !bytes.Equal(p, partitions[i]) {
+			t.Errorf("token partition %d: %x, want %x", i, p, partitions[i])
+		}
+	}
+	// the first of the partitions runs up to the end of the size table
+	if len(f.Partitions) != 5 || len(f.Partitions[0]) != 10+len(first)+9 {
+		t.Fatalf("%d partitions, the first of %d bytes", len(f.Partitions), len(f.Partitions[0]))
+	}
+	if !bytes.Equal(bytes.Join(f.Partitions, nil), data) {
+		t.Error("partitions do not cover the frame")
+	}
+}
+
+func TestParseInterFrame(t *testing.T) {
+	tests := []struct {
+		name  string
+		frame testFrame
+	}{
+		{"refresh last", testFrame{refreshLast: true}},
+		{"refresh golden and altref", testFrame{refreshGolden: true, refreshAltRef: true, refreshProbs: true}},
+		{"copy last to golden", testFrame{copyToGolden: 1, copyToAltRef: 2, refreshLast: true}},
+		{"copy altref to golden", testFrame{copyToGolden: 2, signBiasGolden: true}},
+		{"copy golden to altref", testFrame{refreshGolden: true, copyToAltRef: 2, signBiasAltRef: true}},
+		{"hidden", testFrame{hidden: true, refreshAltRef: true, copyToGolden: 1}},
+	}
+	for _, tt := range tests {
+		f := tt.frame
+		f.level, f.sharpness, f.qIndex = 10, 2, 45
+		f.partitions = [][]byte{{7, 7, 7}}
+		got, err := ParseFrame(f.bytes())
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if got.KeyFrame || got.ShowFrame == f.hidden || got.QIndex != 45 || got.LoopFilterLevel != 10 {
+			t.Errorf("%s: frame %+v", tt.name, got)
+		}
+		if got.RefreshGolden != f.refreshGolden || got.RefreshAltRef != f.refreshAltRef ||
+			uint32(got.CopyToGolden) != f.copyToGolden || uint32(got.CopyToAltRef) != f.copyToAltRef ||
+			got.SignBiasGolden != f.signBiasGolden || got.SignBiasAltRef != f.signBiasAltRef ||
+			got.RefreshEntropyProbs != f.refreshProbs || got.RefreshLast != f.refreshLast {
+			t.Errorf("%s: references golden %v/%d altref %v/%d bias %v/%v probs %v last %v", tt.name,
+				got.RefreshGolden, got.CopyToGolden, got.RefreshAltRef, got.CopyToAltRef,
+				got.SignBiasGolden, got.SignBiasAltRef, got.RefreshEntropyProbs, got.RefreshLast)
+		}
+		if len(got.TokenPartitions) != 1 || !bytes.Equal(got.TokenPartitions[0], []byte{7, 7, 7}) {
+			t.Errorf("%s: token partitions %x", tt.name, got.TokenPartitions)
+		}
+	}
+}
+
+func TestParseFrameRefresh(t *testing.T) {
+	frame := testFrame{copyToGolden: 2, refreshAltRef: true, refreshLast: true, qIndex: 45, partitions: [][]byte{{7}}}
+	data := frame.bytes()
+	// the reference updates are coded in the first bytes of the first partition
+	f, err := ParseFrameRefresh(data[:12])
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.CopyToGolden != 2 || !f.RefreshAltRef || !f.RefreshLast || f.QIndex != 45 {
+		t.Errorf("frame %+v", f)
+	}
+	if f.Partitions != nil || f.TokenPartitions != nil {
+		t.Error("partitions set from a truncated frame")
+	}
+	if _, err := ParseFrameRefresh(data[:5]); err != ErrShortFrame {
+		t.Errorf("error %v, want ErrShortFrame", err)
+	}
+	if _, err := ParseFrame(data[:12]); err != ErrInvalidPartition {
+		t.Errorf("ParseFrame of a truncated frame: error %v, want ErrInvalidPartition", err)
+	}
+}
+
+func TestParseFrameTruncatedPartitions(t *testing.T) {
+	frame := testFrame{qIndex: 45, partitions: [][]byte{{1, 1}, {2, 2}}}
+	data := frame.bytes()
+	first := frame.firstPartition()
+	tableEnd := 3 + len(first) + 3
+	tests := []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{"whole frame", data, nil},
+		{"partial size table", data[:tableEnd-1], ErrTruncatedPartition},
+		{"partition beyond the frame", data[:tableEnd+1], ErrTruncatedPartition},
+		// the last partition takes the rest of the frame
+		{"short last partition", data[:len(data)-1], nil},
+	}
+	for _, tt := range tests {
+		if _, err := ParseFrame(tt.data); err != tt.err {
+			t.Errorf("%s: error %v, want %v", tt.name, err, tt.err)
+		}
+	}
+}
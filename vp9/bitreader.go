@@ -0,0 +1,52 @@
+package vp9
+
+import "errors"
+
+var errShortBuffer = errors.New("vp9: unexpected end of header")
+
+// bitReader reads MSB-first bit fields as used by the uncompressed header.
+type bitReader struct {
+	data []byte
+	pos  int // in bits
+	err  error
+}
+
+func (b *bitReader) readBit() uint32 {
+	if b.err != nil {
+		return 0
+	}
+	if b.pos >= len(b.data)*8 {
+		b.err = errShortBuffer
+		return 0
+	}
+	bit := (b.data[b.pos>>3] >> (7 - uint(b.pos&7))) & 1
+	b.pos++
+	return uint32(bit)
+}
+
+// f reads an unsigned n-bit number.
+func (b *bitReader) f(n int) uint32 {
+	var v uint32
+	for i := 0; i < n; i++ {
+		v = v<<1 | b.readBit()
+	}
+	return v
+}
+
+// su reads a signed n-bit number followed by the sign bit.
+func (b *bitReader) su(n int) int32 {
+	v := int32(b.f(n))
+	if b.readBit() == 1 {
+		return -v
+	}
+	return v
+}
+
+func (b *bitReader) flag() bool {
+	return b.readBit() == 1
+}
+
+// bytesRead returns the number of bytes consumed, counting a partial byte.
+func (b *bitReader) bytesRead() int {
+	return (b.pos + 7) >> 3
+}
@@ -0,0 +1,486 @@
+package vp9
+
+import "errors"
+
+var (
+	ErrInvalidFrameMarker = errors.New("vp9: invalid frame marker")
+	ErrInvalidSyncCode    = errors.New("vp9: invalid frame sync code")
+	ErrReservedBitSet     = errors.New("vp9: reserved bit is set")
+	ErrUnknownRefSize     = errors.New("vp9: frame size depends on an unknown reference frame")
+)
+
+// FrameType is the type of a VP9 frame.
+type FrameType uint8
+
+const (
+	KeyFrame    FrameType = 0
+	NonKeyFrame FrameType = 1
+)
+
+// ColorSpace is the color_space syntax element, the values match vpx.ColorSpace.
+type ColorSpace uint8
+
+const (
+	ColorSpaceUnknown  ColorSpace = 0
+	ColorSpaceBt601    ColorSpace = 1
+	ColorSpaceBt709    ColorSpace = 2
+	ColorSpaceSmpte170 ColorSpace = 3
+	ColorSpaceSmpte240 ColorSpace = 4
+	ColorSpaceBt2020   ColorSpace = 5
+	ColorSpaceReserved ColorSpace = 6
+	ColorSpaceSrgb     ColorSpace = 7
+)
+
+// ColorRange is the color_range syntax element, the values match vpx.ColorRange.
+type ColorRange uint8
+
+const (
+	ColorRangeStudio ColorRange = 0
+	ColorRangeFull   ColorRange = 1
+)
+
+// NumRefFrames is the number of reference frame slots.
+const NumRefFrames = 8
+
+const (
+	syncCode0 = 0x49
+	syncCode1 = 0x83
+	syncCode2 = 0x42
+
+	minTileWidthB64 = 4
+	maxTileWidthB64 = 64
+)
+
+var (
+	segmentationFeatureBits   = [4]int{8, 6, 2, 0}
+	segmentationFeatureSigned = [4]bool{true, true, false, false}
+)
+
+// Header is the VP9 uncompressed frame header, see section 6.2 of the VP9 bitstream specification.
+type Header struct {
+	Profile uint8
+
+	ShowExistingFrame bool
+	FrameToShowMapIdx uint8
+
+	FrameType          FrameType
+	ShowFrame          bool
+	ErrorResilientMode bool
+	IntraOnly          bool
+	ResetFrameContext  uint8
+
+	BitDepth     uint8
+	ColorSpace   ColorSpace
+	ColorRange   ColorRange
+	SubsamplingX uint8
+	SubsamplingY uint8
+
+	Width        uint16
+	Height       uint16
+	RenderWidth  uint16
+	RenderHeight uint16
+	// SizeFromRef is the index into RefFrameIdx of the reference frame
+	// the frame size was copied from, or -1 if the size was coded explicitly.
+	SizeFromRef int
+
+	RefreshFrameFlags    uint8
+	RefFrameIdx          [3]uint8
+	RefFrameSignBias     [3]bool
+	AllowHighPrecisionMv bool
+	InterpFilter         uint8
+	SwitchableInterp     bool
+
+	RefreshFrameContext       bool
+	FrameParallelDecodingMode bool
+	FrameContextIdx           uint8
+
+	LoopFilterLevel     uint8
+	LoopFilterSharpness uint8
+	BaseQIdx            uint8
+	Lossless            bool
+	SegmentationEnabled bool
+
+	TileColsLog2 uint8
+	TileRowsLog2 uint8
+
+	// CompressedHeaderSize is the size of the compressed header following this one.
+	CompressedHeaderSize uint16
+	// Size is the size of the uncompressed header in bytes.
+	Size int
+}
+
+// IsKeyframe reports whether the frame is a keyframe.
+func (h *Header) IsKeyframe() bool {
+	return !h.ShowExistingFrame && h.FrameType == KeyFrame
+}
+
+// IsIntra reports whether the frame can be decoded without reference frames.
+func (h *Header) IsIntra() bool {
+	return !h.ShowExistingFrame && (h.FrameType == KeyFrame || h.IntraOnly)
+}
+
+type refFrame struct {
+	valid        bool
+	width        uint16
+	height       uint16
+	bitDepth     uint8
+	subsamplingX uint8
+	subsamplingY uint8
+	colorSpace   ColorSpace
+	colorRange   ColorRange
+}
+
+// Parser parses uncompressed headers of consecutive frames of a stream, keeping
+// track of the reference frame slots so that the sizes of inter frames that are
+// copied from references, as well as the bit depth and subsampling that are only
+// coded in intra frames, can be resolved.
+type Parser struct {
+	refs [NumRefFrames]refFrame
+	last refFrame
+}
+
+// NewParser returns a new Parser with empty reference frame slots.
+func NewParser() *Parser {
+	return &Parser{}
+}
+
+// ParseHeader parses a single frame header without any knowledge of the previous
+// frames. For inter frames that copy their size from a reference frame it returns
+// ErrUnknownRefSize along with the header whose fields are valid up to and including
+// RefFrameIdx and SizeFromRef. Use a Parser to handle such frames.
+func ParseHeader(data []byte) (*Header, error) {
+	return NewParser().parse(data, false)
+}
+
+// Parse parses the header of the next frame of the stream and updates the reference slots.
+// Data must hold a single frame, see SplitSuperframe and ParsePacket.
+func (p *Parser) Parse(data []byte) (*Header, error) {
+	return p.parse(data, true)
+}
+
+// ParsePacket splits the packet if it is a superframe and parses all the frames in it.
+func (p *Parser) ParsePacket(data []byte) ([]*Header, error) {
+	frames, err := SplitSuperframe(data)
+	if err != nil {
+		return nil, err
+	}
+	headers := make([]*Header, 0, len(frames))
+	for _, frame := range frames {
+		h, err := p.Parse(frame)
+		if err != nil {
+			return headers, err
+		}
+		headers = append(headers, h)
+	}
+	return headers, nil
+}
+
+// Reset forgets all the reference frames, e.g. after a seek.
+func (p *Parser) Reset() {
+	*p = Parser{}
+}
+
+func (p *Parser) parse(data []byte, update bool) (*Header, error) {
+	b := &bitReader{data: data}
+	h := &Header{
+		SizeFromRef: -1,
+	}
+	if b.f(2) != 2 {
+		if b.err != nil {
+			return nil, b.err
+		}
+		return nil, ErrInvalidFrameMarker
+	}
+	profileLow := b.f(1)
+	profileHigh := b.f(1)
+	h.Profile = uint8(profileHigh<<1 | profileLow)
+	if h.Profile == 3 && b.flag() {
+		return nil, ErrReservedBitSet
+	}
+	if h.ShowExistingFrame = b.flag(); h.ShowExistingFrame {
+		h.FrameToShowMapIdx = uint8(b.f(3))
+		h.Size = b.bytesRead()
+		if b.err != nil {
+			return nil, b.err
+		}
+		ref := p.refs[h.FrameToShowMapIdx]
+		h.Width, h.Height = ref.width, ref.height
+		h.RenderWidth, h.RenderHeight = ref.width, ref.height
+		h.BitDepth = ref.bitDepth
+		h.SubsamplingX, h.SubsamplingY = ref.subsamplingX, ref.subsamplingY
+		h.ColorSpace, h.ColorRange = ref.colorSpace, ref.colorRange
+		return h, nil
+	}
+	h.FrameType = FrameType(b.f(1))
+	h.ShowFrame = b.flag()
+	h.ErrorResilientMode = b.flag()
+	if h.FrameType == KeyFrame {
+		if err := readSyncCode(b); err != nil {
+			return nil, err
+		}
+		if err := h.readColorConfig(b); err != nil {
+			return nil, err
+		}
+		h.readFrameSize(b)
+		h.readRenderSize(b)
+		h.RefreshFrameFlags = 0xFF
+	} else {
+		if !h.ShowFrame {
+			h.IntraOnly = b.flag()
+		}
+		if !h.ErrorResilientMode {
+			h.ResetFrameContext = uint8(b.f(2))
+		}
+		if h.IntraOnly {
+			if err := readSyncCode(b); err != nil {
+				return nil, err
+			}
+			if h.Profile > 0 {
+				if err := h.readColorConfig(b); err != nil {
+					return nil, err
+				}
+			} else {
+				h.BitDepth = 8
+				h.ColorSpace = ColorSpaceBt601
+				h.SubsamplingX, h.SubsamplingY = 1, 1
+			}
+			h.RefreshFrameFlags = uint8(b.f(8))
+			h.readFrameSize(b)
+			h.readRenderSize(b)
+		} else {
+			h.RefreshFrameFlags = uint8(b.f(8))
+			for i := 0; i < 3; i++ {
+				h.RefFrameIdx[i] = uint8(b.f(3))
+				h.RefFrameSignBias[i] = b.flag()
+			}
+			h.inheritColorConfig(p.last)
+			for i := 0; i < 3; i++ {
+				if b.flag() {
+					h.SizeFromRef = i
+					break
+				}
+			}
+			if h.SizeFromRef < 0 {
+				h.readFrameSize(b)
+			} else {
+				ref := p.refs[h.RefFrameIdx[h.SizeFromRef]]
+				if !ref.valid {
+					if b.err != nil {
+						return nil, b.err
+					}
+					return h, ErrUnknownRefSize
+				}
+				h.Width, h.Height = ref.width, ref.height
+			}
+			h.readRenderSize(b)
+			h.AllowHighPrecisionMv = b.flag()
+			if h.SwitchableInterp = b.flag(); !h.SwitchableInterp {
+				h.InterpFilter = uint8(b.f(2))
+			}
+		}
+	}
+	if !h.ErrorResilientMode {
+		h.RefreshFrameContext = b.flag()
+		h.FrameParallelDecodingMode = b.flag()
+	} else {
+		h.FrameParallelDecodingMode = true
+	}
+	h.FrameContextIdx = uint8(b.f(2))
+	h.readLoopFilterParams(b)
+	h.readQuantizationParams(b)
+	h.readSegmentationParams(b)
+	h.readTileInfo(b)
+	h.CompressedHeaderSize = uint16(b.f(16))
+	h.Size = b.bytesRead()
+	if b.err != nil {
+		return nil, b.err
+	}
+	if update {
+		p.refresh(h)
+	}
+	return h, nil
+}
+
+func (p *Parser) refresh(h *Header) {
+	ref := refFrame{
+		valid:        true,
+		width:        h.Width,
+		height:       h.Height,
+		bitDepth:     h.BitDepth,
+		subsamplingX: h.SubsamplingX,
+		subsamplingY: h.SubsamplingY,
+		colorSpace:   h.ColorSpace,
+		colorRange:   h.ColorRange,
+	}
+	for i := 0; i < NumRefFrames; i++ {
+		if h.RefreshFrameFlags&(1<<uint(i)) != 0 {
+			p.refs[i] = ref
+		}
+	}
+	p.last = ref
+}
+
+func readSyncCode(b *bitReader) error {
+	if b.f(8) != syncCode0 || b.f(8) != syncCode1 || b.f(8) != syncCode2 {
+		if b.err != nil {
+			return b.err
+		}
+		return ErrInvalidSyncCode
+	}
+	return nil
+}
+
+func (h *Header) readColorConfig(b *bitReader) error {
+	h.BitDepth = 8
+	if h.Profile >= 2 {
+		h.BitDepth = 10
+		if b.flag() {
+			h.BitDepth = 12
+		}
+	}
+	h.ColorSpace = ColorSpace(b.f(3))
+	if h.ColorSpace != ColorSpaceSrgb {
+		h.ColorRange = ColorRange(b.f(1))
+		if h.Profile == 1 || h.Profile == 3 {
+			h.SubsamplingX = uint8(b.f(1))
+			h.SubsamplingY = uint8(b.f(1))
+			if b.flag() {
+				return ErrReservedBitSet
+			}
+		} else {
+			h.SubsamplingX, h.SubsamplingY = 1, 1
+		}
+	} else {
+		h.ColorRange = ColorRangeFull
+		if h.Profile == 1 || h.Profile == 3 {
+			if b.flag() {
+				return ErrReservedBitSet
+			}
+		}
+	}
+	return b.err
+}
+
+// inheritColorConfig sets the color config of an inter frame, which is not coded
+// in the bitstream, from the previous frame or from the profile defaults.
+func (h *Header) inheritColorConfig(last refFrame) {
+	if last.valid {
+		h.BitDepth = last.bitDepth
+		h.SubsamplingX, h.SubsamplingY = last.subsamplingX, last.subsamplingY
+		h.ColorSpace, h.ColorRange = last.colorSpace, last.colorRange
+		return
+	}
+	switch h.Profile {
+	case 0:
+		h.BitDepth = 8
+		h.SubsamplingX, h.SubsamplingY = 1, 1
+	case 2:
+		h.SubsamplingX, h.SubsamplingY = 1, 1
+	}
+}
+
+func (h *Header) readFrameSize(b *bitReader) {
+	h.Width = uint16(b.f(16) + 1)
+	h.Height = uint16(b.f(16) + 1)
+}
+
+func (h *Header) readRenderSize(b *bitReader) {
+	if b.flag() {
+		h.RenderWidth = uint16(b.f(16) + 1)
+		h.RenderHeight = uint16(b.f(16) + 1)
+		return
+	}
+	h.RenderWidth, h.RenderHeight = h.Width, h.Height
+}
+
+func (h *Header) readLoopFilterParams(b *bitReader) {
+	h.LoopFilterLevel = uint8(b.f(6))
+	h.LoopFilterSharpness = uint8(b.f(3))
+	if b.flag() { // loop_filter_delta_enabled
+		if b.flag() { // loop_filter_delta_update
+			for i := 0; i < 4; i++ {
+				if b.flag() {
+					b.su(6)
+				}
+			}
+			for i := 0; i < 2; i++ {
+				if b.flag() {
+					b.su(6)
+				}
+			}
+		}
+	}
+}
+
+func (h *Header) readQuantizationParams(b *bitReader) {
+	h.BaseQIdx = uint8(b.f(8))
+	lossless := h.BaseQIdx == 0
+	for i := 0; i < 3; i++ { // delta_q_y_dc, delta_q_uv_dc, delta_q_uv_ac
+		if b.flag() && b.su(4) != 0 {
+			lossless = false
+		}
+	}
+	h.Lossless = lossless
+}
+
+func (h *Header) readSegmentationParams(b *bitReader) {
+	if h.SegmentationEnabled = b.flag(); !h.SegmentationEnabled {
+		return
+	}
+	if b.flag() { // segmentation_update_map
+		for i := 0; i < 7; i++ {
+			readProb(b)
+		}
+		if b.flag() { // segmentation_temporal_update
+			for i := 0; i < 3; i++ {
+				readProb(b)
+			}
+		}
+	}
+	if b.flag() { // segmentation_update_data
+		b.f(1) // segmentation_abs_or_delta_update
+		for i := 0; i < 8; i++ {
+			for j := 0; j < 4; j++ {
+				if b.flag() {
+					b.f(segmentationFeatureBits[j])
+					if segmentationFeatureSigned[j] {
+						b.f(1)
+					}
+				}
+			}
+		}
+	}
+}
+
+func readProb(b *bitReader) {
+	if b.flag() {
+		b.f(8)
+	}
+}
+
+func (h *Header) readTileInfo(b *bitReader) {
+	miCols := (int(h.Width) + 7) >> 3
+	sb64Cols := (miCols + 7) >> 3
+	minLog2 := 0
+	for (maxTileWidthB64 << uint(minLog2)) < sb64Cols {
+		minLog2++
+	}
+	maxLog2 := 1
+	for (sb64Cols >> uint(maxLog2)) >= minTileWidthB64 {
+		maxLog2++
+	}
+	maxLog2--
+	h.TileColsLog2 = uint8(minLog2)
+	for int(h.TileColsLog2) < maxLog2 {
+		if !b.flag() {
+			break
+		}
+		h.TileColsLog2++
+	}
+	if b.flag() {
+		h.TileRowsLog2 = 1
+		if b.flag() {
+			h.TileRowsLog2++
+		}
+	}
+}
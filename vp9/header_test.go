@@ -0,0 +1,516 @@
+package vp9
+
+import (
+	"testing"
+)
+
+// bitWriter writes MSB-first bit fields.
+type bitWriter struct {
+	buf []byte
+	pos int
+}
+
+func (w *bitWriter) put(v uint32, n int) {
+	for i := n - 1; i >= 0; i-- {
+		if w.pos>>3 >= len(w.buf) {
+			w.buf = append(w.buf, 0)
+		}
+		if v>>uint(i)&1 == 1 {
+			w.buf[w.pos>>3] |= 1 << (7 - uint(w.pos&7))
+		}
+		w.pos++
+	}
+}
+
+func (w *bitWriter) flag(v bool) {
+	if v {
+		w.put(1, 1)
+	} else {
+		w.put(0, 1)
+	}
+}
+
+// testFrame describes an uncompressed header to build, the zero value is a shown
+// profile 0 keyframe. Loop filter, quantizer deltas and segmentation are not coded.
+type testFrame struct {
+	profile uint32
+
+	showExisting bool
+	showIdx      uint32
+
+	inter     bool
+	hidden    bool
+	errorRes  bool
+	intraOnly bool
+
+	twelveBit  bool
+	colorSpace ColorSpace
+	fullRange  bool
+	// ssx and ssy are only coded in profiles 1 and 3
+	ssx, ssy uint32
+
+	width, height uint32
+	// sizeFromRef makes an inter frame copy the size of its first reference,
+	// width must still be set to the size of the reference for the tile info
+	sizeFromRef      bool
+	renderW, renderH uint32
+
+	refresh uint32
+	refIdx  [3]uint32
+
+	baseQ        uint32
+	tileColsLog2 int
+	tileRowsLog2 int
+	compressed   uint32
+}
+
+func (f testFrame) bytes() []byte {
+	w := &bitWriter{}
+	w.put(2, 2)
+	w.put(f.profile&1, 1)
+	w.put(f.profile>>1, 1)
+	if f.profile == 3 {
+		w.put(0, 1)
+	}
+	w.flag(f.showExisting)
+	if f.showExisting {
+		w.put(f.showIdx, 3)
+		return w.buf
+	}
+	w.flag(f.inter)
+	w.flag(!f.hidden)
+	w.flag(f.errorRes)
+	switch {
+	case !f.inter:
+		f.putSyncCode(w)
+		f.putColorConfig(w)
+		f.putFrameSize(w)
+		f.putRenderSize(w)
+	case f.intraOnly:
+		w.flag(true)
+		if !f.errorRes {
+			w.put(0, 2)
+		}
+		f.putSyncCode(w)
+		if f.profile > 0 {
+			f.putColorConfig(w)
+		}
+		w.put(f.refresh, 8)
+		f.putFrameSize(w)
+		f.putRenderSize(w)
+	default:
+		if f.hidden {
+			w.flag(false)
+		}
+		if !f.errorRes {
+			w.put(0, 2)
+		}
+		w.put(f.refresh, 8)
+		for _, idx := range f.refIdx {
+			w.put(idx, 3)
+			w.flag(false)
+		}
+		if f.sizeFromRef {
+			w.flag(true)
+		} else {
+			w.put(0, 3)
+			f.putFrameSize(w)
+		}
+		f.putRenderSize(w)
+		w.flag(true) // allow_high_precision_mv
+		w.flag(true) // is_filter_switchable
+	}
+	if !f.errorRes {
+		w.flag(true)  // refresh_frame_context
+		w.flag(false) // frame_parallel_decoding_mode
+	}
+	w.put(0, 2)  // frame_context_idx
+	w.put(10, 6) // filter_level
+	w.put(0, 3)  // sharpness_level
+	w.flag(false)
+	w.put(f.baseQ, 8)
+	w.put(0, 3) // no delta_q
+	w.flag(false)
+	maxLog2 := testMaxTileColsLog2(f.width)
+	for i := 0; i < f.tileColsLog2; i++ {
+		w.flag(true)
+	}
+	if f.tileColsLog2 < maxLog2 {
+		w.flag(false)
+	}
+	switch f.tileRowsLog2 {
+	case 0:
+		w.flag(false)
+	case 1:
+		w.put(2, 2)
+	default:
+		w.put(3, 2)
+	}
+	w.put(f.compressed, 16)
+	return w.buf
+}
+
+func (f testFrame) putSyncCode(w *bitWriter) {
+	w.put(0x49, 8)
+	w.put(0x83, 8)
+	w.put(0x42, 8)
+}
+
+func (f testFrame) putColorConfig(w *bitWriter) {
+	if f.profile >= 2 {
+		w.flag(f.twelveBit)
+	}
+	w.put(uint32(f.colorSpace), 3)
+	if f.colorSpace != ColorSpaceSrgb {
+		w.flag(f.fullRange)
+		if f.profile == 1 || f.profile == 3 {
+			w.put(f.ssx, 1)
+			w.put(f.ssy, 1)
+			w.flag(false)
+		}
+	} else if f.profile == 1 || f.profile == 3 {
+		w.flag(false)
+	}
+}
+
+func (f testFrame) putFrameSize(w *bitWriter) {
+	w.put(f.width-1, 16)
+	w.put(f.height-1, 16)
+}
+
+func (f testFrame) putRenderSize(w *bitWriter) {
+	w.flag(f.renderW != 0)
+	if f.renderW != 0 {
+		w.put(f.renderW-1, 16)
+		w.put(f.renderH-1, 16)
+	}
+}
+
+// testMaxTileColsLog2 is the largest tile_cols_log2 of the width, the minimum is
+// zero for widths up to 4096.
+func testMaxTileColsLog2(width uint32) int {
+	sb64Cols := (int(width) + 63) >> 6
+	maxLog2 := 0
+	for sb64Cols>>uint(maxLog2+1) >= minTileWidthB64 {
+		maxLog2++
+	}
+	return maxLog2
+}
+
+// keyframeHeader returns the header of a shown profile 0 keyframe as built by testFrame.
+func keyframeHeader(width, height uint16) Header {
+	return Header{
+		ShowFrame:           true,
+		BitDepth:            8,
+		SubsamplingX:        1,
+		SubsamplingY:        1,
+		Width:               width,
+		Height:              height,
+		RenderWidth:         width,
+		RenderHeight:        height,
+		SizeFromRef:         -1,
+		RefreshFrameFlags:   0xFF,
+		RefreshFrameContext: true,
+		LoopFilterLevel:     10,
+		Lossless:            true,
+	}
+}
+
+func TestParseKeyframe(t *testing.T) {
+	tests := []struct {
+		name  string
+		frame testFrame
+		want  func(h *Header)
+	}{{
+		name: "profile 0",
+		frame: testFrame{
+			colorSpace: ColorSpaceBt709,
+			width:      1920, height: 1080,
+			renderW: 1440, renderH: 1080,
+			baseQ:        60,
+			tileColsLog2: 1, tileRowsLog2: 2,
+			compressed: 123,
+		},
+		want: func(h *Header) {
+			h.ColorSpace = ColorSpaceBt709
+			h.RenderWidth = 1440
+			h.BaseQIdx, h.Lossless = 60, false
+			h.TileColsLog2, h.TileRowsLog2 = 1, 2
+			h.CompressedHeaderSize = 123
+		},
+	}, {
+		name: "profile 0 lossless",
+		frame: testFrame{
+			colorSpace: ColorSpaceBt601,
+			width:      352, height: 288,
+			tileRowsLog2: 1,
+		},
+		want: func(h *Header) {
+			h.ColorSpace = ColorSpaceBt601
+			h.TileRowsLog2 = 1
+		},
+	}, {
+		name: "profile 1 4:4:4",
+		frame: testFrame{
+			profile:    1,
+			colorSpace: ColorSpaceBt709,
+			width:      640, height: 480,
+			baseQ: 100,
+		},
+		want: func(h *Header) {
+			h.Profile = 1
+			h.ColorSpace = ColorSpaceBt709
+			h.SubsamplingX, h.SubsamplingY = 0, 0
+			h.BaseQIdx, h.Lossless = 100, false
+		},
+	}, {
+		name: "profile 1 4:4:0",
+		frame: testFrame{
+			profile:    1,
+			colorSpace: ColorSpaceBt601,
+			ssy:        1,
+			width:      640, height: 480,
+			baseQ: 100,
+		},
+		want: func(h *Header) {
+			h.Profile = 1
+			h.ColorSpace = ColorSpaceBt601
+			h.SubsamplingX, h.SubsamplingY = 0, 1
+			h.BaseQIdx, h.Lossless = 100, false
+		},
+	}, {
+		name: "profile 2 12-bit full range",
+		frame: testFrame{
+			profile:    2,
+			twelveBit:  true,
+			colorSpace: ColorSpaceBt2020,
+			fullRange:  true,
+			width:      3840, height: 2160,
+			baseQ:        20,
+			tileColsLog2: 2,
+		},
+		want: func(h *Header) {
+			h.Profile = 2
+			h.BitDepth = 12
+			h.ColorSpace, h.ColorRange = ColorSpaceBt2020, ColorRangeFull
+			h.BaseQIdx, h.Lossless = 20, false
+			h.TileColsLog2 = 2
+		},
+	}, {
+		name: "profile 3 sRGB",
+		frame: testFrame{
+			profile:    3,
+			colorSpace: ColorSpaceSrgb,
+			width:      1280, height: 720,
+			baseQ: 1,
+		},
+		want: func(h *Header) {
+			h.Profile = 3
+			h.BitDepth = 10
+			h.ColorSpace, h.ColorRange = ColorSpaceSrgb, ColorRangeFull
+			h.SubsamplingX, h.SubsamplingY = 0, 0
+			h.BaseQIdx, h.Lossless = 1, false
+		},
+	}}
+	for _, tt := range tests {
+		data := tt.frame.bytes()
+		want := keyframeHeader(uint16(tt.frame.width), uint16(tt.frame.height))
+		tt.want(&want)
+		want.Size = len(data)
+		// the compressed header follows
+		h, err := ParseHeader(append(data, 0xAA, 0xBB, 0xCC))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if *h != want {
+			t.Errorf("%s: header\n%+v, want\n%+v", tt.name, *h, want)
+		}
+		if !h.IsKeyframe() || !h.IsIntra() {
+			t.Errorf("%s: keyframe %v intra %v", tt.name, h.IsKeyframe(), h.IsIntra())
+		}
+	}
+}
+
+func TestParseTileColumns(t *testing.T) {
+	tests := []struct {
+		width uint32
+		cols  int
+	}{
+		// 6 superblocks allow a single tile column
+		{352, 0},
+		{1920, 1},
+		{1920, 2},
+		{4096, 4},
+		{4096, 3},
+	}
+	for _, tt := range tests {
+		data := testFrame{width: tt.width, height: 256, tileColsLog2: tt.cols, baseQ: 1}.bytes()
+		h, err := ParseHeader(data)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if int(h.TileColsLog2) != tt.cols || h.Size != len(data) {
+			t.Errorf("width %d: tile_cols_log2 %d size %d, want %d and %d", tt.width, h.TileColsLog2, h.Size, tt.cols, len(data))
+		}
+	}
+}
+
+func TestParseStream(t *testing.T) {
+	p := NewParser()
+	frames := []struct {
+		name  string
+		frame testFrame
+		check func(h *Header) bool
+	}{{
+		name:  "keyframe",
+		frame: testFrame{colorSpace: ColorSpaceBt709, width: 1280, height: 720, baseQ: 40},
+		check: func(h *Header) bool {
+			return h.IsKeyframe() && h.Width == 1280 && h.RefreshFrameFlags == 0xFF
+		},
+	}, {
+		name: "hidden intra-only frame",
+		frame: testFrame{
+			inter: true, hidden: true, intraOnly: true,
+			refresh: 0x04,
+			width:   640, height: 360,
+			baseQ: 40,
+		},
+		check: func(h *Header) bool {
+			// profile 0 intra-only frames do not code the colour config
+			return !h.IsKeyframe() && h.IsIntra() && !h.ShowFrame &&
+				h.Width == 640 && h.Height == 360 && h.RefreshFrameFlags == 0x04 &&
+				h.BitDepth == 8 && h.ColorSpace == ColorSpaceBt601 && h.SubsamplingX == 1
+		},
+	}, {
+		name: "inter frame sized from a reference",
+		frame: testFrame{
+			inter:       true,
+			refresh:     0x01,
+			refIdx:      [3]uint32{2, 0, 1},
+			width:       640,
+			height:      360,
+			sizeFromRef: true,
+			baseQ:       80,
+		},
+		check: func(h *Header) bool {
+			// the size comes from slot 2, the colour config from the last frame
+			return !h.IsIntra() && h.SizeFromRef == 0 && h.RefFrameIdx == [3]uint8{2, 0, 1} &&
+				h.Width == 640 && h.Height == 360 && h.RenderWidth == 640 &&
+				h.ColorSpace == ColorSpaceBt601 && h.SwitchableInterp && h.AllowHighPrecisionMv
+		},
+	}, {
+		name: "error resilient inter frame",
+		frame: testFrame{
+			inter:    true,
+			errorRes: true,
+			refresh:  0x02,
+			refIdx:   [3]uint32{0, 1, 3},
+			width:    1280, height: 720,
+			baseQ: 80,
+		},
+		check: func(h *Header) bool {
+			return h.SizeFromRef == -1 && h.Width == 1280 &&
+				h.ErrorResilientMode && h.FrameParallelDecodingMode && !h.RefreshFrameContext
+		},
+	}, {
+		name:  "show existing frame",
+		frame: testFrame{showExisting: true, showIdx: 2},
+		check: func(h *Header) bool {
+			return h.ShowExistingFrame && h.FrameToShowMapIdx == 2 && h.Size == 1 &&
+				!h.IsKeyframe() && !h.IsIntra() &&
+				h.Width == 640 && h.Height == 360 && h.BitDepth == 8
+		},
+	}}
+	for _, f := range frames {
+		h, err := p.Parse(f.frame.bytes())
+		if err != nil {
+			t.Fatalf("%s: %v", f.name, err)
+		}
+		if !f.check(h) {
+			t.Errorf("%s: header %+v", f.name, *h)
+		}
+	}
+
+	// without the previous frames the size of the reference is unknown
+	inter := frames[2].frame.bytes()
+	h, err := ParseHeader(inter)
+	if err != ErrUnknownRefSize {
+		t.Fatalf("error %v, want ErrUnknownRefSize", err)
+	}
+	if h.SizeFromRef != 0 || h.RefFrameIdx != [3]uint8{2, 0, 1} || h.RefreshFrameFlags != 0x01 {
+		t.Errorf("partial header %+v", *h)
+	}
+	p.Reset()
+	if _, err := p.Parse(inter); err != ErrUnknownRefSize {
+		t.Errorf("error %v after reset, want ErrUnknownRefSize", err)
+	}
+}
+
+func TestParsePacket(t *testing.T) {
+	p := NewParser()
+	if _, err := p.Parse(testFrame{width: 320, height: 240, baseQ: 1}.bytes()); err != nil {
+		t.Fatal(err)
+	}
+	// a hidden alt-ref frame followed by a shown inter frame, then the alt-ref is shown
+	altRef := testFrame{inter: true, hidden: true, refresh: 0x40, width: 160, height: 120, baseQ: 1}
+	shown := testFrame{inter: true, refIdx: [3]uint32{0, 6, 6}, width: 320, height: 240, sizeFromRef: true, baseQ: 1}
+	packet, err := BuildSuperframe([][]byte{altRef.bytes(), shown.bytes()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	headers, err := p.ParsePacket(packet)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(headers) != 2 || headers[0].ShowFrame || !headers[1].ShowFrame {
+		t.Fatalf("headers %+v", headers)
+	}
+	if headers[1].Width != 320 {
+		t.Errorf("inter frame width %d, want the 320 of slot 0", headers[1].Width)
+	}
+	headers, err = p.ParsePacket(testFrame{showExisting: true, showIdx: 6}.bytes())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(headers) != 1 || headers[0].Width != 160 || headers[0].Height != 120 {
+		t.Errorf("shown alt-ref %+v", headers)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	key := testFrame{width: 320, height: 240}.bytes()
+	badSync := append([]byte{}, key...)
+	badSync[2] ^= 0xFF
+	// profile 3 codes a reserved zero bit after the profile
+	reserved := testFrame{profile: 3, width: 320, height: 240}.bytes()
+	reserved[0] |= 0x08
+	// profile 1 codes a reserved zero bit after the subsampling
+	w := &bitWriter{}
+	w.put(2, 2)
+	w.put(1, 1)
+	w.put(0, 1)
+	w.put(0, 4) // show_existing_frame, frame_type, show_frame, error_resilient_mode
+	w.put(0x498342, 24)
+	w.put(uint32(ColorSpaceBt709), 3)
+	w.put(0x3, 4) // color_range, subsampling_x, subsampling_y, reserved_zero
+	colorReserved := w.buf
+
+	tests := []struct {
+		name string
+		data []byte
+		err  error
+	}{
+		{"empty", nil, errShortBuffer},
+		{"frame marker", []byte{0x00, 0x00}, ErrInvalidFrameMarker},
+		{"sync code", badSync, ErrInvalidSyncCode},
+		{"truncated", key[:6], errShortBuffer},
+		{"profile reserved bit", reserved, ErrReservedBitSet},
+		{"color config reserved bit", colorReserved, ErrReservedBitSet},
+	}
+	for _, tt := range tests {
+		if _, err := ParseHeader(tt.data); err != tt.err {
+			t.Errorf("%s: error %v, want %v", tt.name, err, tt.err)
+		}
+	}
+}
@@ -0,0 +1,329 @@
+package vp9
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+)
+
+// Level is a VP9 level, the level number times ten. The values match vpx.Level.
+type Level uint8
+
+const (
+	LevelUnknown Level = 0
+
+	Level1  Level = 10
+	Level11 Level = 11
+	Level2  Level = 20
+	Level21 Level = 21
+	Level3  Level = 30
+	Level31 Level = 31
+	Level4  Level = 40
+	Level41 Level = 41
+	Level5  Level = 50
+	Level51 Level = 51
+	Level52 Level = 52
+	Level6  Level = 60
+	Level61 Level = 61
+	Level62 Level = 62
+)
+
+// Levels lists the defined levels in increasing order.
+var Levels = []Level{
+	Level1, Level11, Level2, Level21, Level3, Level31, Level4,
+	Level41, Level5, Level51, Level52, Level6, Level61, Level62,
+}
+
+// String returns the level number, such as 4.1.
+func (l Level) String() string {
+	if l == LevelUnknown {
+		return "unknown"
+	}
+	return strconv.Itoa(int(l)/10) + "." + strconv.Itoa(int(l)%10)
+}
+
+// LevelLimits holds the constraints of a level, see the VP9 levels and decoder testing
+// document of the WebM project.
+type LevelLimits struct {
+	// MaxLumaSampleRate is the number of luma samples coded per second.
+	MaxLumaSampleRate uint64
+	// MaxLumaPictureSize and MaxLumaPictureBreadth bound the area and
+	// the largest dimension of a frame.
+	MaxLumaPictureSize    uint32
+	MaxLumaPictureBreadth uint32
+	// AverageBitrate in kbps over the whole stream.
+	AverageBitrate float64
+	// MaxCPBSize in kbits is the largest size of four consecutive frames.
+	MaxCPBSize float64
+	// MinCompressionRatio is the minimum ratio of the uncompressed to the compressed size of a frame.
+	MinCompressionRatio float64
+	MaxColTiles         int
+	// MinAltRefDistance is the minimum number of shown frames between two hidden frames.
+	MinAltRefDistance int
+	// MaxRefFrameBuffers is the number of reference slots the stream may use.
+	MaxRefFrameBuffers int
+}
+
+var levelLimits = map[Level]LevelLimits{
+	Level1:  {829440, 36864, 512, 200, 400, 2, 1, 4, 8},
+	Level11: {2764800, 73728, 768, 800, 1000, 2, 1, 4, 8},
+	Level2:  {4608000, 122880, 960, 1800, 1500, 2, 1, 4, 8},
+	Level21: {9216000, 245760, 1344, 3600, 2800, 2, 2, 4, 8},
+	Level3:  {20736000, 552960, 2048, 7200, 6000, 2, 4, 4, 8},
+	Level31: {36864000, 983040, 2752, 12000, 10000, 2, 4, 4, 8},
+	Level4:  {83558400, 2228224, 4160, 18000, 16000, 4, 4, 4, 8},
+	Level41: {160432128, 2228224, 4160, 30000, 18000, 4, 4, 5, 6},
+	Level5:  {311951360, 8912896, 8384, 60000, 36000, 6, 8, 6, 4},
+	Level51: {588251136, 8912896, 8384, 120000, 46000, 8, 8, 10, 4},
+	Level52: {1176502272, 8912896, 8384, 180000, 90000, 8, 8, 10, 4},
+	Level6:  {1176502272, 35651584, 16832, 180000, 90000, 8, 16, 10, 4},
+	Level61: {2353004544, 35651584, 16832, 240000, 180000, 8, 16, 10, 4},
+	Level62: {4706009088, 35651584, 16832, 480000, 360000, 8, 16, 10, 4},
+}
+
+// Limits returns the constraints of the level, false if the level is not defined.
+func (l Level) Limits() (LevelLimits, bool) {
+	limits, ok := levelLimits[l]
+	return limits, ok
+}
+
+// LevelStats holds the measures of a stream that are constrained by the levels,
+// with the same units as LevelLimits.
+type LevelStats struct {
+	// Frames is the number of coded frames, hidden frames included.
+	Frames                int
+	Duration              time.Duration
+	MaxLumaSampleRate     uint64
+	MaxLumaPictureSize    uint32
+	MaxLumaPictureBreadth uint32
+	AverageBitrate        float64
+	MaxCPBSize            float64
+	// MinCompressionRatio is zero if no frame was coded.
+	MinCompressionRatio float64
+	MaxColTiles         int
+	// MinAltRefDistance is zero if the stream has less than two hidden frames.
+	MinAltRefDistance int
+	RefFrameBuffers   int
+}
+
+// Violation is a level limit exceeded by a stream.
+type Violation struct {
+	Level Level
+	// Limit is the name of the LevelLimits field.
+	Limit string
+	Value float64
+	Bound float64
+}
+
+func (v Violation) String() string {
+	return fmt.Sprintf("level %v: %s is %g, limit %g", v.Level, v.Limit, v.Value, v.Bound)
+}
+
+// cpbWindow is the number of consecutive frames whose sizes make the CPB size.
+const cpbWindow = 4
+
+type levelFrame struct {
+	pts         time.Duration
+	lumaSamples uint64
+}
+
+// LevelChecker measures a VP9 stream packet by packet and checks it against the level
+// limits, like the statistics the encoder keeps for Vp9eGetLevel.
+type LevelChecker struct {
+	parser *Parser
+	stats  LevelStats
+
+	started     bool
+	first, last time.Duration
+	bytes       uint64
+	window      []levelFrame // frames of the last second
+	sizes       [cpbWindow]int
+	sized       int
+	packets     int
+	usedRefs    uint8 // reference slots refreshed or referenced by inter frames
+	shown       int   // shown frames since the last hidden frame
+	seenAltRef  bool
+}
+
+// NewLevelChecker returns a checker for a new stream.
+func NewLevelChecker() *LevelChecker {
+	return &LevelChecker{
+		parser: NewParser(),
+	}
+}
+
+// Add measures the next packet of the stream, a frame or a superframe, with its
+// presentation time. Packets must be added in decoding order.
+func (c *LevelChecker) Add(packet []byte, pts time.Duration) error {
+	frames, err := SplitSuperframe(packet)
+	if err != nil {
+		return err
+	}
+	if !c.started {
+		c.first = pts
+		c.started = true
+	}
+	c.last = pts
+	c.packets++
+	for _, frame := range frames {
+		h, err := c.parser.Parse(frame)
+		if err != nil {
+			return err
+		}
+		c.bytes += uint64(len(frame))
+		if h.ShowExistingFrame {
+			continue
+		}
+		c.addFrame(h, len(frame), pts)
+	}
+	return nil
+}
+
+func (c *LevelChecker) addFrame(h *Header, size int, pts time.Duration) {
+	s := &c.stats
+	s.Frames++
+
+	luma := uint64(h.Width) * uint64(h.Height)
+	if uint32(luma) > s.MaxLumaPictureSize {
+		s.MaxLumaPictureSize = uint32(luma)
+	}
+	breadth := uint32(h.Width)
+	if uint32(h.Height) > breadth {
+		breadth = uint32(h.Height)
+	}
+	if breadth > s.MaxLumaPictureBreadth {
+		s.MaxLumaPictureBreadth = breadth
+	}
+
+	// luma sample rate over the frames of the last second
+	c.window = append(c.window, levelFrame{pts: pts, lumaSamples: luma})
+	for len(c.window) > 1 && pts-c.window[0].pts >= time.Second {
+		c.window = c.window[1:]
+	}
+	var samples uint64
+	for _, f := range c.window {
+		samples += f.lumaSamples
+	}
+	if samples > s.MaxLumaSampleRate {
+		s.MaxLumaSampleRate = samples
+	}
+
+	copy(c.sizes[:], c.sizes[1:])
+	c.sizes[cpbWindow-1] = size
+	c.sized++
+	if c.sized >= cpbWindow {
+		var bits int
+		for _, sz := range c.sizes {
+			bits += sz * 8
+		}
+		if cpb := float64(bits) / 1000; cpb > s.MaxCPBSize {
+			s.MaxCPBSize = cpb
+		}
+	}
+
+	if size > 0 {
+		// uncompressed size of the frame with its subsampling and bit depth
+		chroma := 2 * luma >> (h.SubsamplingX + h.SubsamplingY)
+		raw := float64((luma+chroma)*uint64(h.BitDepth)) / 8
+		if ratio := raw / float64(size); s.MinCompressionRatio == 0 || ratio < s.MinCompressionRatio {
+			s.MinCompressionRatio = ratio
+		}
+	}
+
+	if tiles := 1 << h.TileColsLog2; tiles > s.MaxColTiles {
+		s.MaxColTiles = tiles
+	}
+
+	// keyframes refresh all the slots, only those used afterwards count
+	if !h.IsKeyframe() {
+		c.usedRefs |= h.RefreshFrameFlags
+	}
+	if !h.IsIntra() {
+		for _, idx := range h.RefFrameIdx {
+			c.usedRefs |= 1 << idx
+		}
+	}
+	s.RefFrameBuffers = popcount(c.usedRefs)
+
+	if h.ShowFrame {
+		c.shown++
+	} else {
+		if c.seenAltRef && (s.MinAltRefDistance == 0 || c.shown < s.MinAltRefDistance) {
+			s.MinAltRefDistance = c.shown
+		}
+		c.seenAltRef = true
+		c.shown = 0
+	}
+}
+
+// Stats returns the measures of the packets added so far. The duration and the
+// average bitrate extend the time span of the packets by one frame interval.
+func (c *LevelChecker) Stats() LevelStats {
+	s := c.stats
+	if c.packets > 1 {
+		span := c.last - c.first
+		s.Duration = span + span/time.Duration(c.packets-1)
+	}
+	if s.Duration > 0 {
+		s.AverageBitrate = float64(c.bytes*8) / 1000 / s.Duration.Seconds()
+	}
+	return s
+}
+
+// Check returns the limits of the level exceeded by the stream so far.
+func (c *LevelChecker) Check(l Level) []Violation {
+	limits, ok := l.Limits()
+	if !ok {
+		return nil
+	}
+	s := c.Stats()
+	var violations []Violation
+	check := func(name string, exceeded bool, value, bound float64) {
+		if exceeded {
+			violations = append(violations, Violation{
+				Level: l,
+				Limit: name,
+				Value: value,
+				Bound: bound,
+			})
+		}
+	}
+	check("MaxLumaSampleRate", s.MaxLumaSampleRate > limits.MaxLumaSampleRate,
+		float64(s.MaxLumaSampleRate), float64(limits.MaxLumaSampleRate))
+	check("MaxLumaPictureSize", s.MaxLumaPictureSize > limits.MaxLumaPictureSize,
+		float64(s.MaxLumaPictureSize), float64(limits.MaxLumaPictureSize))
+	check("MaxLumaPictureBreadth", s.MaxLumaPictureBreadth > limits.MaxLumaPictureBreadth,
+		float64(s.MaxLumaPictureBreadth), float64(limits.MaxLumaPictureBreadth))
+	check("AverageBitrate", s.AverageBitrate > limits.AverageBitrate,
+		s.AverageBitrate, limits.AverageBitrate)
+	check("MaxCPBSize", s.MaxCPBSize > limits.MaxCPBSize,
+		s.MaxCPBSize, limits.MaxCPBSize)
+	check("MinCompressionRatio", s.MinCompressionRatio > 0 && s.MinCompressionRatio < limits.MinCompressionRatio,
+		s.MinCompressionRatio, limits.MinCompressionRatio)
+	check("MaxColTiles", s.MaxColTiles > limits.MaxColTiles,
+		float64(s.MaxColTiles), float64(limits.MaxColTiles))
+	check("MinAltRefDistance", s.MinAltRefDistance > 0 && s.MinAltRefDistance < limits.MinAltRefDistance,
+		float64(s.MinAltRefDistance), float64(limits.MinAltRefDistance))
+	check("MaxRefFrameBuffers", s.RefFrameBuffers > limits.MaxRefFrameBuffers,
+		float64(s.RefFrameBuffers), float64(limits.MaxRefFrameBuffers))
+	return violations
+}
+
+// Level returns the lowest level whose limits the stream meets so far,
+// LevelUnknown if it exceeds them all.
+func (c *LevelChecker) Level() Level {
+	for _, l := range Levels {
+		if len(c.Check(l)) == 0 {
+			return l
+		}
+	}
+	return LevelUnknown
+}
+
+func popcount(x uint8) int {
+	var n int
+	for ; x != 0; x &= x - 1 {
+		n++
+	}
+	return n
+}
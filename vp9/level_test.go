@@ -0,0 +1,231 @@
+package vp9
+
+import (
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// levelStream adds packets to a LevelChecker at a constant frame rate.
+type levelStream struct {
+	t   *testing.T
+	c   *LevelChecker
+	fps int
+	n   int
+}
+
+// sized returns the frame header padded with zeros to size bytes.
+func sized(f testFrame, size int) []byte {
+	b := f.bytes()
+	return append(b, make([]byte, size-len(b))...)
+}
+
+// add adds a packet of the frames, a superframe if there are several.
+func (s *levelStream) add(frames ...[]byte) {
+	packet := frames[0]
+	if len(frames) > 1 {
+		var err error
+		if packet, err = BuildSuperframe(frames); err != nil {
+			s.t.Fatal(err)
+		}
+	}
+	pts := time.Duration(s.n) * time.Second / time.Duration(s.fps)
+	if err := s.c.Add(packet, pts); err != nil {
+		s.t.Fatalf("packet %d: %v", s.n, err)
+	}
+	s.n++
+}
+
+// frames adds n packets of the frame padded to size bytes.
+func (s *levelStream) frames(n int, f testFrame, size int) {
+	for i := 0; i < n; i++ {
+		s.add(sized(f, size))
+	}
+}
+
+// interFrame returns a shown inter frame predicted from the first three slots
+// that refreshes the first one.
+func interFrame(width, height uint32) testFrame {
+	return testFrame{
+		inter:   true,
+		width:   width,
+		height:  height,
+		refresh: 1,
+		refIdx:  [3]uint32{0, 1, 2},
+	}
+}
+
+// stream1080p adds a 1080p keyframe of 100000 bytes and n-1 inter frames of 20000 bytes.
+func stream1080p(s *levelStream, n int) {
+	s.frames(1, testFrame{width: 1920, height: 1080}, 100000)
+	s.frames(n-1, interFrame(1920, 1080), 20000)
+}
+
+func TestLevelStats(t *testing.T) {
+	s := &levelStream{t: t, c: NewLevelChecker(), fps: 30}
+	stream1080p(s, 30)
+	got := s.c.Stats()
+	want := LevelStats{
+		Frames:                30,
+		Duration:              got.Duration,
+		MaxLumaSampleRate:     30 * 1920 * 1080,
+		MaxLumaPictureSize:    1920 * 1080,
+		MaxLumaPictureBreadth: 1920,
+		AverageBitrate:        got.AverageBitrate,
+		MaxCPBSize:            (100000 + 3*20000) * 8 / 1000,
+		MinCompressionRatio:   1920 * 1080 * 3 / 2 / 100000.0,
+		MaxColTiles:           1,
+		RefFrameBuffers:       3,
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("stats %+v, want %+v", got, want)
+	}
+	if d := got.Duration - time.Second; d < -time.Microsecond || d > time.Microsecond {
+		t.Errorf("duration %v, want 1s", got.Duration)
+	}
+	if math.Abs(got.AverageBitrate-(100000+29*20000)*8/1000) > 0.01 {
+		t.Errorf("average bitrate %g, want 5440", got.AverageBitrate)
+	}
+}
+
+func TestLevelCheck(t *testing.T) {
+	tests := []struct {
+		name  string
+		fps   int
+		build func(s *levelStream)
+		// violations lists the Level41 limits exceeded
+		violations []string
+		level      Level
+	}{{
+		name:  "1080p30",
+		fps:   30,
+		build: func(s *levelStream) { stream1080p(s, 30) },
+		level: Level4,
+	}, {
+		name: "picture size",
+		fps:  30,
+		build: func(s *levelStream) {
+			s.frames(1, testFrame{width: 2560, height: 1440}, 100000)
+			s.frames(29, interFrame(2560, 1440), 20000)
+		},
+		violations: []string{"MaxLumaPictureSize"},
+		level:      Level5,
+	}, {
+		name: "picture breadth",
+		fps:  30,
+		build: func(s *levelStream) {
+			s.frames(1, testFrame{width: 4224, height: 256}, 100000)
+			s.frames(29, interFrame(4224, 256), 20000)
+		},
+		violations: []string{"MaxLumaPictureBreadth"},
+		level:      Level5,
+	}, {
+		name:       "sample rate",
+		fps:        90,
+		build:      func(s *levelStream) { stream1080p(s, 90) },
+		violations: []string{"MaxLumaSampleRate"},
+		level:      Level5,
+	}, {
+		name: "average bitrate",
+		fps:  30,
+		build: func(s *levelStream) {
+			s.frames(1, testFrame{width: 1920, height: 1080}, 100000)
+			s.frames(59, interFrame(1920, 1080), 130000)
+		},
+		violations: []string{"AverageBitrate"},
+		level:      Level5,
+	}, {
+		// the compression ratio of the large frames exceeds the higher levels
+		name: "CPB size",
+		fps:  30,
+		build: func(s *levelStream) {
+			stream1080p(s, 30)
+			s.frames(4, interFrame(1920, 1080), 600000)
+			s.frames(266, interFrame(1920, 1080), 20000)
+		},
+		violations: []string{"MaxCPBSize"},
+		level:      LevelUnknown,
+	}, {
+		name: "compression ratio",
+		fps:  30,
+		build: func(s *levelStream) {
+			stream1080p(s, 15)
+			s.frames(1, interFrame(1920, 1080), 800000)
+			s.frames(14, interFrame(1920, 1080), 20000)
+		},
+		violations: []string{"MinCompressionRatio"},
+		level:      LevelUnknown,
+	}, {
+		name: "column tiles",
+		fps:  30,
+		build: func(s *levelStream) {
+			key := testFrame{width: 2048, height: 1080, tileColsLog2: 3}
+			inter := interFrame(2048, 1080)
+			inter.tileColsLog2 = 3
+			s.frames(1, key, 100000)
+			s.frames(29, inter, 20000)
+		},
+		violations: []string{"MaxColTiles"},
+		level:      Level5,
+	}, {
+		name: "alt-ref distance",
+		fps:  30,
+		build: func(s *levelStream) {
+			inter := interFrame(1920, 1080)
+			altRef := inter
+			altRef.hidden = true
+			altRef.refresh = 4
+			stream1080p(s, 1)
+			// a hidden frame every fourth shown frame
+			for i := 0; i < 8; i++ {
+				s.add(sized(altRef, 30000), sized(inter, 20000))
+				s.frames(3, inter, 20000)
+			}
+		},
+		violations: []string{"MinAltRefDistance"},
+		level:      Level4,
+	}, {
+		name: "reference buffers",
+		fps:  30,
+		build: func(s *levelStream) {
+			stream1080p(s, 1)
+			for i := uint32(0); i < 29; i++ {
+				f := interFrame(1920, 1080)
+				f.refresh = 1 << (i % 7)
+				f.refIdx = [3]uint32{0, i % 7, 1}
+				s.frames(1, f, 20000)
+			}
+		},
+		violations: []string{"MaxRefFrameBuffers"},
+		level:      Level4,
+	}}
+	for _, tt := range tests {
+		s := &levelStream{t: t, c: NewLevelChecker(), fps: tt.fps}
+		tt.build(s)
+		var names []string
+		for _, v := range s.c.Check(Level41) {
+			if v.Level != Level41 {
+				t.Errorf("%s: violation %v of level %v", tt.name, v, v.Level)
+			}
+			names = append(names, v.Limit)
+		}
+		if !reflect.DeepEqual(names, tt.violations) {
+			t.Errorf("%s: violations %v, want %v (%+v)", tt.name, names, tt.violations, s.c.Stats())
+		}
+		if l := s.c.Level(); l != tt.level {
+			t.Errorf("%s: level %v, want %v", tt.name, l, tt.level)
+		}
+	}
+}
+
+func TestLevelCheckUnknownLevel(t *testing.T) {
+	s := &levelStream{t: t, c: NewLevelChecker(), fps: 30}
+	stream1080p(s, 2)
+	if v := s.c.Check(Level(42)); v != nil {
+		t.Errorf("violations %v of an undefined level", v)
+	}
+	if v := s.c.Check(Level1); len(v) == 0 {
+		t.Error("1080p within level 1")
+	}
+}
@@ -0,0 +1,135 @@
+// Package vp9 implements parsing of the VP9 bitstream structures that are useful
+// outside of the decoder, such as the superframe index. It is pure Go and does
+// not depend on libvpx.
+package vp9
+
+import "errors"
+
+const (
+	superframeMarkerMask = 0xe0
+	superframeMarker     = 0xc0
+
+	// MaxSuperframeFrames is the maximum number of frames a superframe can hold.
+	MaxSuperframeFrames = 8
+)
+
+var (
+	ErrInvalidSuperframe = errors.New("vp9: invalid superframe index")
+	ErrTooManyFrames     = errors.New("vp9: too many frames for a superframe")
+	ErrNoFrames          = errors.New("vp9: no frames to build a superframe from")
+	ErrFrameTooLarge     = errors.New("vp9: frame too large for a superframe")
+)
+
+// SuperframeIndex describes the index found at the end of a superframe.
+type SuperframeIndex struct {
+	// Sizes holds the size in bytes of each frame, in decoding order.
+	Sizes []uint32
+	// Size is the size of the index itself in bytes.
+	Size int
+}
+
+// ParseSuperframeIndex parses the superframe index at the end of data.
+// It returns nil and no error if data is a single frame without an index.
+func ParseSuperframeIndex(data []byte) (*SuperframeIndex, error) {
+	if len(data) == 0 {
+		return nil, nil
+	}
+	marker := data[len(data)-1]
+	if marker&superframeMarkerMask != superframeMarker {
+		return nil, nil
+	}
+	frames := int(marker&0x7) + 1
+	mag := int((marker>>3)&0x3) + 1
+	indexSize := 2 + mag*frames
+	if len(data) < indexSize || data[len(data)-indexSize] != marker {
+		// the last byte only looks like a marker
+		return nil, nil
+	}
+	index := &SuperframeIndex{
+		Sizes: make([]uint32, frames),
+		Size:  indexSize,
+	}
+	var total uint64
+	p := data[len(data)-indexSize+1:]
+	for i := 0; i < frames; i++ {
+		var size uint32
+		for j := 0; j < mag; j++ {
+			size |= uint32(p[j]) << uint(8*j)
+		}
+		p = p[mag:]
+		index.Sizes[i] = size
+		total += uint64(size)
+	}
+	if total > uint64(len(data)-indexSize) {
+		return nil, ErrInvalidSuperframe
+	}
+	return index, nil
+}
+
+// IsSuperframe reports whether data ends with a valid superframe index.
+func IsSuperframe(data []byte) bool {
+	index, err := ParseSuperframeIndex(data)
+	return err == nil && index != nil
+}
+
+// SplitSuperframe returns the frames contained in data in decoding order,
+// the slices share memory with data. Data without a superframe index is
+// returned as a single frame. Zero-sized frames are skipped.
+func SplitSuperframe(data []byte) ([][]byte, error) {
+	index, err := ParseSuperframeIndex(data)
+	if err != nil {
+		return nil, err
+	} else if index == nil {
+		return [][]byte{data}, nil
+	}
+	frames := make([][]byte, 0, len(index.Sizes))
+	var offset int
+	for _, size := range index.Sizes {
+		if size == 0 {
+			continue
+		}
+		end := offset + int(size)
+		frames = append(frames, data[offset:end:end])
+		offset = end
+	}
+	return frames, nil
+}
+
+// BuildSuperframe concatenates the frames and appends a superframe index
+// using the smallest size field width that fits the largest frame.
+func BuildSuperframe(frames [][]byte) ([]byte, error) {
+	if len(frames) == 0 {
+		return nil, ErrNoFrames
+	} else if len(frames) > MaxSuperframeFrames {
+		return nil, ErrTooManyFrames
+	}
+	var total, largest int
+	for _, frame := range frames {
+		total += len(frame)
+		if len(frame) > largest {
+			largest = len(frame)
+		}
+	}
+	mag := 1
+	for mag < 4 && uint64(largest) >= 1<<uint(8*mag) {
+		mag++
+	}
+	if uint64(largest) >= 1<<32 {
+		return nil, ErrFrameTooLarge
+	}
+	marker := byte(superframeMarker | (mag-1)<<3 | (len(frames) - 1))
+	indexSize := 2 + mag*len(frames)
+	buf := make([]byte, 0, total+indexSize)
+	for _, frame := range frames {
+		buf = append(buf, frame...)
+	}
+	buf = append(buf, marker)
+	for _, frame := range frames {
+		size := len(frame)
+		for j := 0; j < mag; j++ {
+			buf = append(buf, byte(size>>uint(8*j)))
+		}
+	}
+	buf = append(buf, marker)
+	return buf, nil
+}
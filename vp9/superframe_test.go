@@ -0,0 +1,122 @@
+package vp9
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestSuperframeRoundTrip(t *testing.T) {
+	tests := []struct {
+		name   string
+		sizes  []int
+		mag    int
+		marker byte
+	}{
+		{"one byte sizes", []int{10, 255}, 1, 0xc1},
+		{"two byte sizes", []int{300, 5}, 2, 0xc9},
+		{"three byte sizes", []int{70000, 1, 2}, 3, 0xd2},
+		{"max frames", []int{1, 2, 3, 4, 5, 6, 7, 8}, 1, 0xc7},
+	}
+	for _, tt := range tests {
+		var frames [][]byte
+		for i, size := range tt.sizes {
+			frames = append(frames, bytes.Repeat([]byte{byte(i + 1)}, size))
+		}
+		data, err := BuildSuperframe(frames)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		indexSize := 2 + tt.mag*len(frames)
+		if data[len(data)-1] != tt.marker || data[len(data)-indexSize] != tt.marker {
+			t.Errorf("%s: index % x, want marker %#x", tt.name, data[len(data)-indexSize:], tt.marker)
+		}
+		if !IsSuperframe(data) {
+			t.Errorf("%s: not a superframe", tt.name)
+		}
+		index, err := ParseSuperframeIndex(data)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if index.Size != indexSize || len(index.Sizes) != len(frames) {
+			t.Fatalf("%s: index %+v", tt.name, index)
+		}
+		for i, size := range index.Sizes {
+			if int(size) != tt.sizes[i] {
+				t.Errorf("%s: frame %d size %d, want %d", tt.name, i, size, tt.sizes[i])
+			}
+		}
+		split, err := SplitSuperframe(data)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if len(split) != len(frames) {
+			t.Fatalf("%s: %d frames, want %d", tt.name, len(split), len(frames))
+		}
+		for i := range split {
+			if !bytes.Equal(split[i], frames[i]) {
+				t.Errorf("%s: frame %d differs", tt.name, i)
+			}
+		}
+	}
+}
+
+func TestSplitSingleFrame(t *testing.T) {
+	tests := []struct {
+		name string
+		data []byte
+	}{
+		{"no marker", []byte{0x82, 0x49, 0x83, 0x42, 0x00}},
+		// the last byte looks like a marker but the first byte of the index does not match
+		{"marker without index", []byte{0x82, 0x49, 0x00, 0x05, 0xc1}},
+	}
+	for _, tt := range tests {
+		if IsSuperframe(tt.data) {
+			t.Errorf("%s: reported as a superframe", tt.name)
+		}
+		frames, err := SplitSuperframe(tt.data)
+		if err != nil {
+			t.Fatalf("%s: %v", tt.name, err)
+		}
+		if len(frames) != 1 || !bytes.Equal(frames[0], tt.data) {
+			t.Errorf("%s: frames %x", tt.name, frames)
+		}
+	}
+	if frames, err := SplitSuperframe(nil); err != nil || len(frames) != 1 || len(frames[0]) != 0 {
+		t.Errorf("empty data: frames %x error %v", frames, err)
+	}
+}
+
+func TestSplitSkipsEmptyFrames(t *testing.T) {
+	data, err := BuildSuperframe([][]byte{{1, 2, 3}, {}, {4}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	frames, err := SplitSuperframe(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(frames) != 2 || !bytes.Equal(frames[0], []byte{1, 2, 3}) || !bytes.Equal(frames[1], []byte{4}) {
+		t.Errorf("frames %x", frames)
+	}
+	// the frames share memory with the data but cannot grow into the next one
+	if cap(frames[0]) != 3 {
+		t.Errorf("capacity %d of the first frame", cap(frames[0]))
+	}
+}
+
+func TestSuperframeErrors(t *testing.T) {
+	data, err := BuildSuperframe([][]byte{bytes.Repeat([]byte{1}, 300), {2, 2}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the sizes in the index exceed the data once frame bytes are cut
+	if _, err := SplitSuperframe(data[5:]); err != ErrInvalidSuperframe {
+		t.Errorf("truncated data: error %v", err)
+	}
+	if _, err := BuildSuperframe(nil); err != ErrNoFrames {
+		t.Errorf("no frames: error %v", err)
+	}
+	if _, err := BuildSuperframe(make([][]byte, MaxSuperframeFrames+1)); err != ErrTooManyFrames {
+		t.Errorf("too many frames: error %v", err)
+	}
+}
@@ -0,0 +1,290 @@
+package vpx
+
+import (
+	"context"
+	"runtime"
+	"sync"
+	"time"
+)
+
+// QueuePolicy selects what AsyncEncoder does with a new frame when its queue is full.
+type QueuePolicy int
+
+const (
+	// DropOldest drops the oldest queued frame to make room, so the latency stays bounded.
+	DropOldest QueuePolicy = iota
+	// Block makes the sender wait until the encoder takes a frame from the queue.
+	Block
+)
+
+// DefaultQueueSize is the queue size used when AsyncConfig.QueueSize is zero.
+const DefaultQueueSize = 4
+
+// AsyncConfig holds the options of an AsyncEncoder.
+type AsyncConfig struct {
+	// QueueSize is the number of frames waiting for the encoder, DefaultQueueSize if zero.
+	QueueSize int
+	// Policy is applied when a frame arrives with a full queue.
+	Policy QueuePolicy
+	// OutputSize is the capacity of the output channel.
+	OutputSize int
+}
+
+// AsyncFrame is a frame sent to an AsyncEncoder.
+type AsyncFrame struct {
+	// Image must be allocated by libvpx and stay unchanged until Done is called.
+	Image    *Image
+	Pts      CodecPts
+	Duration uint
+	Flags    EncFrameFlags
+	// Meta is returned with the frame encoded from the image, see Encoder.EncodeMeta.
+	Meta interface{}
+	// Done is called, if set, once the encoder no longer needs the image,
+	// after it was encoded or dropped, so the image can be reused.
+	Done func()
+}
+
+func (f *AsyncFrame) done() {
+	if f.Done != nil {
+		f.Done()
+	}
+}
+
+// AsyncStats holds the metrics of an AsyncEncoder.
+type AsyncStats struct {
+	// QueueDepth is the number of frames currently waiting, MaxQueueDepth the highest seen.
+	QueueDepth    int
+	MaxQueueDepth int
+	// Encoded, Dropped and Packets count the frames passed to the encoder,
+	// the frames dropped from a full queue and the packets emitted.
+	Encoded uint64
+	Dropped uint64
+	Packets uint64
+	// LastLatency, MaxLatency and TotalLatency measure the time spent in
+	// CodecEncode, divide TotalLatency by Encoded for the mean.
+	LastLatency  time.Duration
+	MaxLatency   time.Duration
+	TotalLatency time.Duration
+}
+
+// AsyncEncoder runs an Encoder on a dedicated OS thread. Frames are sent on the
+// Input channel and queued, the compressed frames are received from Output.
+// Close the input channel to finish: the queued frames are encoded, the lagged
+// frames flushed, then Output is closed and the encoder destroyed. Cancelling
+// the context stops the encoder without flushing, the queued frames are dropped.
+type AsyncEncoder struct {
+	enc    *Encoder
+	cfg    AsyncConfig
+	ctx    context.Context
+	input  chan AsyncFrame
+	output chan *EncodedFrame
+	done   chan struct{}
+
+	mux    sync.Mutex
+	cond   *sync.Cond
+	queue  []AsyncFrame
+	closed bool
+	err    error
+	stats  AsyncStats
+}
+
+// NewAsyncEncoder starts encoding with the given encoder, which is then owned by the
+// AsyncEncoder and must not be used directly anymore.
+func NewAsyncEncoder(ctx context.Context, enc *Encoder, cfg AsyncConfig) *AsyncEncoder {
+	if cfg.QueueSize <= 0 {
+		cfg.QueueSize = DefaultQueueSize
+	}
+	a := &AsyncEncoder{
+		enc:    enc,
+		cfg:    cfg,
+		ctx:    ctx,
+		input:  make(chan AsyncFrame),
+		output: make(chan *EncodedFrame, cfg.OutputSize),
+		done:   make(chan struct{}),
+	}
+	a.cond = sync.NewCond(&a.mux)
+	go a.receive()
+	go a.watch()
+	go a.run()
+	return a
+}
+
+// Input returns the channel to send frames on, close it to finish the stream.
+func (a *AsyncEncoder) Input() chan<- AsyncFrame {
+	return a.input
+}
+
+// Output returns the channel of compressed frames, it is closed when the encoder stops.
+func (a *AsyncEncoder) Output() <-chan *EncodedFrame {
+	return a.output
+}
+
+// Wait blocks until the encoder stops and returns the error that stopped it,
+// the context error if it was cancelled or nil after a clean finish.
+func (a *AsyncEncoder) Wait() error {
+	<-a.done
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	return a.err
+}
+
+// Stats returns the current metrics.
+func (a *AsyncEncoder) Stats() AsyncStats {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	stats := a.stats
+	stats.QueueDepth = len(a.queue)
+	return stats
+}
+
+// receive moves the frames from the input channel to the queue. Once the encoder
+// stopped, the frames sent until the input is closed are released right away.
+func (a *AsyncEncoder) receive() {
+	for frame := range a.input {
+		if !a.push(frame) {
+			frame.done()
+		}
+	}
+	a.mux.Lock()
+	a.closed = true
+	a.cond.Broadcast()
+	a.mux.Unlock()
+}
+
+// watch stops the encoder when the context is cancelled.
+func (a *AsyncEncoder) watch() {
+	select {
+	case <-a.ctx.Done():
+		a.stop(a.ctx.Err())
+	case <-a.done:
+	}
+}
+
+// push queues a frame, with the Block policy it waits for room in the queue.
+func (a *AsyncEncoder) push(frame AsyncFrame) bool {
+	var dropped *AsyncFrame
+	defer func() {
+		if dropped != nil {
+			dropped.done()
+		}
+	}()
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	for a.cfg.Policy == Block && len(a.queue) >= a.cfg.QueueSize && a.err == nil {
+		a.cond.Wait()
+	}
+	if a.err != nil {
+		return false
+	}
+	if len(a.queue) >= a.cfg.QueueSize {
+		oldest := a.queue[0]
+		dropped = &oldest
+		a.queue[0] = AsyncFrame{}
+		a.queue = a.queue[1:]
+		a.stats.Dropped++
+	}
+	a.queue = append(a.queue, frame)
+	if len(a.queue) > a.stats.MaxQueueDepth {
+		a.stats.MaxQueueDepth = len(a.queue)
+	}
+	a.cond.Broadcast()
+	return true
+}
+
+// pop waits for a frame, it returns false once the input is closed and the queue
+// is empty or the encoder is stopping.
+func (a *AsyncEncoder) pop() (AsyncFrame, bool) {
+	a.mux.Lock()
+	defer a.mux.Unlock()
+	for len(a.queue) == 0 && !a.closed && a.err == nil {
+		a.cond.Wait()
+	}
+	if a.err != nil || len(a.queue) == 0 {
+		return AsyncFrame{}, false
+	}
+	frame := a.queue[0]
+	a.queue[0] = AsyncFrame{}
+	a.queue = a.queue[1:]
+	a.cond.Broadcast()
+	return frame, true
+}
+
+// stop records the first error and drops the queued frames.
+func (a *AsyncEncoder) stop(err error) {
+	a.mux.Lock()
+	if a.err == nil {
+		a.err = err
+	}
+	queue := a.queue
+	a.queue = nil
+	a.cond.Broadcast()
+	a.mux.Unlock()
+	for i := range queue {
+		queue[i].done()
+	}
+}
+
+func (a *AsyncEncoder) run() {
+	// libvpx is called from a single thread for the whole lifetime of the encoder
+	runtime.LockOSThread()
+	defer runtime.UnlockOSThread()
+	defer close(a.done)
+	defer close(a.output)
+	defer a.enc.Close()
+
+	for {
+		frame, ok := a.pop()
+		if !ok {
+			break
+		}
+		start := time.Now()
+		packets, err := a.enc.EncodeMeta(frame.Image, frame.Pts, frame.Duration, frame.Flags, frame.Meta)
+		a.observe(time.Since(start))
+		frame.done()
+		if err != nil {
+			a.stop(err)
+			return
+		}
+		if !a.emit(packets) {
+			return
+		}
+	}
+	a.mux.Lock()
+	stopped := a.err != nil
+	a.mux.Unlock()
+	if stopped {
+		return
+	}
+	packets, err := a.enc.Flush()
+	if err != nil {
+		a.stop(err)
+	}
+	a.emit(packets)
+}
+
+func (a *AsyncEncoder) observe(latency time.Duration) {
+	a.mux.Lock()
+	a.stats.Encoded++
+	a.stats.LastLatency = latency
+	a.stats.TotalLatency += latency
+	if latency > a.stats.MaxLatency {
+		a.stats.MaxLatency = latency
+	}
+	a.mux.Unlock()
+}
+
+// emit sends the packets unless the context is cancelled meanwhile.
+func (a *AsyncEncoder) emit(packets []*EncodedFrame) bool {
+	for _, pkt := range packets {
+		select {
+		case a.output <- pkt:
+			a.mux.Lock()
+			a.stats.Packets++
+			a.mux.Unlock()
+		case <-a.ctx.Done():
+			a.stop(a.ctx.Err())
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,181 @@
+package vpx
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+)
+
+// newTestAsync returns an AsyncEncoder without an encoder, so its queue can be
+// driven with push and pop directly.
+func newTestAsync(ctx context.Context, cfg AsyncConfig) *AsyncEncoder {
+	a := &AsyncEncoder{
+		cfg:   cfg,
+		ctx:   ctx,
+		input: make(chan AsyncFrame),
+		done:  make(chan struct{}),
+	}
+	a.cond = sync.NewCond(&a.mux)
+	return a
+}
+
+// releases records the frames whose Done was called.
+type releases struct {
+	mux  sync.Mutex
+	pts  []CodecPts
+	seen chan CodecPts
+}
+
+func newReleases() *releases {
+	return &releases{seen: make(chan CodecPts, 16)}
+}
+
+func (r *releases) frame(pts CodecPts) AsyncFrame {
+	return AsyncFrame{
+		Pts: pts,
+		Done: func() {
+			r.mux.Lock()
+			r.pts = append(r.pts, pts)
+			r.mux.Unlock()
+			r.seen <- pts
+		},
+	}
+}
+
+func (r *releases) released() []CodecPts {
+	r.mux.Lock()
+	defer r.mux.Unlock()
+	return append([]CodecPts(nil), r.pts...)
+}
+
+func popAll(a *AsyncEncoder) []CodecPts {
+	var pts []CodecPts
+	for {
+		frame, ok := a.pop()
+		if !ok {
+			return pts
+		}
+		pts = append(pts, frame.Pts)
+	}
+}
+
+func equalPts(a, b []CodecPts) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func TestAsyncDropOldest(t *testing.T) {
+	a := newTestAsync(context.Background(), AsyncConfig{QueueSize: 2, Policy: DropOldest})
+	r := newReleases()
+	for pts := CodecPts(1); pts <= 4; pts++ {
+		if !a.push(r.frame(pts)) {
+			t.Fatalf("frame %d not queued", pts)
+		}
+	}
+	// the dropped frames are released right away, the queued ones are not
+	if got := r.released(); !equalPts(got, []CodecPts{1, 2}) {
+		t.Errorf("released %v, want [1 2]", got)
+	}
+	s := a.Stats()
+	if s.Dropped != 2 || s.QueueDepth != 2 || s.MaxQueueDepth != 2 {
+		t.Errorf("stats %+v", s)
+	}
+	a.closed = true
+	if got := popAll(a); !equalPts(got, []CodecPts{3, 4}) {
+		t.Errorf("popped %v, want [3 4]", got)
+	}
+}
+
+func TestAsyncBlock(t *testing.T) {
+	a := newTestAsync(context.Background(), AsyncConfig{QueueSize: 1, Policy: Block})
+	r := newReleases()
+	a.push(r.frame(1))
+	pushed := make(chan bool)
+	go func() {
+		pushed <- a.push(r.frame(2))
+	}()
+	select {
+	case <-pushed:
+		t.Fatal("push returned with a full queue")
+	case <-time.After(20 * time.Millisecond):
+	}
+	if frame, ok := a.pop(); !ok || frame.Pts != 1 {
+		t.Fatalf("popped %d %v, want 1", frame.Pts, ok)
+	}
+	if !<-pushed {
+		t.Fatal("frame not queued once there was room")
+	}
+	if frame, ok := a.pop(); !ok || frame.Pts != 2 {
+		t.Errorf("popped %d %v, want 2", frame.Pts, ok)
+	}
+	if s := a.Stats(); s.Dropped != 0 || len(r.released()) != 0 {
+		t.Errorf("stats %+v, released %v", s, r.released())
+	}
+}
+
+func TestAsyncCancel(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	a := newTestAsync(ctx, AsyncConfig{QueueSize: 2, Policy: Block})
+	r := newReleases()
+	go a.receive()
+	go a.watch()
+	a.Input() <- r.frame(1)
+	a.Input() <- r.frame(2)
+	// the third frame waits for room in the queue
+	blocked := make(chan struct{})
+	go func() {
+		a.Input() <- r.frame(3)
+		close(blocked)
+	}()
+	cancel()
+	<-blocked
+	for i := 0; i < 3; i++ {
+		select {
+		case <-r.seen:
+		case <-time.After(time.Second):
+			t.Fatalf("released %v after cancel, want all the frames", r.released())
+		}
+	}
+	if _, ok := a.pop(); ok {
+		t.Error("frame popped after cancel")
+	}
+	// frames sent after the stop are released by the receiver
+	a.Input() <- r.frame(4)
+	if pts := <-r.seen; pts != 4 {
+		t.Errorf("released %d, want 4", pts)
+	}
+	close(a.Input())
+	close(a.done)
+	if err := a.Wait(); err != context.Canceled {
+		t.Errorf("error %v, want context.Canceled", err)
+	}
+}
+
+func TestAsyncCloseInput(t *testing.T) {
+	a := newTestAsync(context.Background(), AsyncConfig{QueueSize: 4})
+	r := newReleases()
+	go a.receive()
+	for pts := CodecPts(1); pts <= 3; pts++ {
+		a.Input() <- r.frame(pts)
+	}
+	close(a.Input())
+	// the queued frames are still encoded, then pop reports the end of the
+	// stream without an error so the encoder is flushed
+	if got := popAll(a); !equalPts(got, []CodecPts{1, 2, 3}) {
+		t.Errorf("popped %v, want [1 2 3]", got)
+	}
+	if a.err != nil {
+		t.Errorf("error %v after the input was closed", a.err)
+	}
+	if got := r.released(); len(got) != 0 {
+		t.Errorf("released %v before the frames were encoded", got)
+	}
+}
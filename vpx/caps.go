@@ -0,0 +1,117 @@
+package vpx
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Caps lists the capabilities of a codec interface as reported by CodecGetCaps.
+// The encoder and decoder flags share bit values, so only the ones matching
+// the kind of the interface are set.
+type Caps struct {
+	Decoder bool
+	Encoder bool
+
+	// Encoder capabilities.
+	PSNR            bool
+	OutputPartition bool
+	HighBitDepth    bool
+
+	// Decoder capabilities.
+	PutSlice            bool
+	PutFrame            bool
+	Postproc            bool
+	ErrorConcealment    bool
+	InputFragments      bool
+	FrameThreading      bool
+	ExternalFrameBuffer bool
+}
+
+// Capabilities returns the capabilities of the codec interface,
+// a nil interface has none.
+func Capabilities(iface *CodecIface) Caps {
+	if iface == nil {
+		return Caps{}
+	}
+	caps := CodecGetCaps(iface)
+	c := Caps{
+		Decoder: caps&CodecCapDecoder != 0,
+		Encoder: caps&CodecCapEncoder != 0,
+	}
+	if c.Encoder {
+		c.PSNR = caps&CodecCapPsnr != 0
+		c.OutputPartition = caps&CodecCapOutputPartition != 0
+		c.HighBitDepth = caps&CodecCapHighbitdepth != 0
+	}
+	if c.Decoder {
+		c.PutSlice = caps&CodecCapPutSlice != 0
+		c.PutFrame = caps&CodecCapPutFrame != 0
+		c.Postproc = caps&CodecCapPostproc != 0
+		c.ErrorConcealment = caps&CodecCapErrorConcealment != 0
+		c.InputFragments = caps&CodecCapInputFragments != 0
+		c.FrameThreading = caps&CodecCapFrameThreading != 0
+		c.ExternalFrameBuffer = caps&CodecCapExternalFrameBuffer != 0
+	}
+	return c
+}
+
+// Library describes the libvpx library linked at runtime.
+type Library struct {
+	Major int
+	Minor int
+	Patch int
+	// Version is the full version string, e.g. v1.8.2-13-g1a2b3c4.
+	Version string
+	// Extra is the part of the version string after the release, if any.
+	Extra string
+	// BuildConfig is the raw configure command line of the build.
+	BuildConfig string
+	// ConfigureFlags are the options passed to configure, e.g. --enable-vp9-highbitdepth.
+	ConfigureFlags []string
+}
+
+// LibraryInfo returns the version and build configuration of the linked libvpx.
+func LibraryInfo() Library {
+	v := int(CodecVersion())
+	lib := Library{
+		Major:       (v >> 16) & 0xff,
+		Minor:       (v >> 8) & 0xff,
+		Patch:       v & 0xff,
+		Version:     CodecVersionStr(),
+		Extra:       CodecVersionExtraStr(),
+		BuildConfig: CodecBuildConfig(),
+	}
+	for _, field := range strings.Fields(lib.BuildConfig) {
+		if strings.HasPrefix(field, "--") {
+			lib.ConfigureFlags = append(lib.ConfigureFlags, field)
+		}
+	}
+	return lib
+}
+
+// AtLeast reports whether the library version is at least major.minor.patch.
+func (l Library) AtLeast(major, minor, patch int) bool {
+	if l.Major != major {
+		return l.Major > major
+	}
+	if l.Minor != minor {
+		return l.Minor > minor
+	}
+	return l.Patch >= patch
+}
+
+// HasFlag reports whether the library was configured with the given option,
+// e.g. "--enable-vp9-highbitdepth". Options with a value like "--target" match
+// when the option name is given without the value.
+func (l Library) HasFlag(flag string) bool {
+	for _, f := range l.ConfigureFlags {
+		if f == flag || strings.HasPrefix(f, flag+"=") {
+			return true
+		}
+	}
+	return false
+}
+
+func (l Library) String() string {
+	return fmt.Sprintf("libvpx %d.%d.%d (%s)", l.Major, l.Minor, l.Patch, l.Version)
+}
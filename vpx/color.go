@@ -0,0 +1,213 @@
+package vpx
+
+// ColorInfo describes the colour of a video, from the configuration to the encoder
+// controls, the container and the decoded frames. The VP9 bitstream only carries the
+// colour space, the range, the bit depth and the subsampling; the matrix, transfer and
+// primaries are ISO/IEC 23001-8 code points (see the webmwriter constants) and, like
+// the HDR metadata, are only stored in the container.
+type ColorInfo struct {
+	Space ColorSpace
+	Range ColorRange
+	// Matrix, Transfer and Primaries are zero if unknown, DefaultColorInfo derives
+	// them from the colour space.
+	Matrix    uint
+	Transfer  uint
+	Primaries uint
+
+	BitDepth     uint32
+	XChromaShift uint32
+	YChromaShift uint32
+
+	// Mastering describes the display the content was mastered on, nil if unknown.
+	Mastering *MasteringMetadata
+	// MaxCLL and MaxFALL are the maximum content and frame-average light levels
+	// in cd/m², zero if unknown.
+	MaxCLL  uint
+	MaxFALL uint
+}
+
+// MasteringMetadata is the SMPTE 2086 mastering display colour volume, the
+// chromaticities are CIE 1931 xy coordinates and the luminances in cd/m².
+type MasteringMetadata struct {
+	PrimaryRChromaticityX   float64
+	PrimaryRChromaticityY   float64
+	PrimaryGChromaticityX   float64
+	PrimaryGChromaticityY   float64
+	PrimaryBChromaticityX   float64
+	PrimaryBChromaticityY   float64
+	WhitePointChromaticityX float64
+	WhitePointChromaticityY float64
+	LuminanceMax            float64
+	LuminanceMin            float64
+}
+
+// ISO/IEC 23001-8 code points used by the colour space mapping.
+const (
+	cicpUnspecified = 2
+
+	cicpMatrixIdentity  = 0
+	cicpMatrixBT709     = 1
+	cicpMatrixBT470BG   = 5
+	cicpMatrixSMPTE170M = 6
+	cicpMatrixSMPTE240M = 7
+	cicpMatrixBT2020NCL = 9
+
+	cicpTransferBT709     = 1
+	cicpTransferSMPTE170M = 6
+	cicpTransferSMPTE240M = 7
+	cicpTransferIEC61966  = 13
+	cicpTransferBT2020_10 = 14
+	cicpTransferBT2020_12 = 15
+
+	cicpPrimariesBT709     = 1
+	cicpPrimariesBT470BG   = 5
+	cicpPrimariesSMPTE170M = 6
+	cicpPrimariesSMPTE240M = 7
+	cicpPrimariesBT2020    = 9
+)
+
+// DefaultColorInfo returns the colour of SDR content in the given colour space,
+// with the matrix, transfer and primaries the colour space implies.
+func DefaultColorInfo(cs ColorSpace, r ColorRange, bitDepth uint32) ColorInfo {
+	c := ColorInfo{
+		Space:        cs,
+		Range:        r,
+		BitDepth:     bitDepth,
+		XChromaShift: 1,
+		YChromaShift: 1,
+	}
+	c.fillCodePoints()
+	return c
+}
+
+// fillCodePoints sets the unknown matrix, transfer and primaries from the colour space.
+func (c *ColorInfo) fillCodePoints() {
+	var matrix, transfer, primaries uint
+	switch c.Space {
+	case ColorSpaceBt601:
+		matrix, transfer, primaries = cicpMatrixBT470BG, cicpTransferSMPTE170M, cicpPrimariesBT470BG
+	case ColorSpaceSmpte170:
+		matrix, transfer, primaries = cicpMatrixSMPTE170M, cicpTransferSMPTE170M, cicpPrimariesSMPTE170M
+	case ColorSpaceBt709:
+		matrix, transfer, primaries = cicpMatrixBT709, cicpTransferBT709, cicpPrimariesBT709
+	case ColorSpaceSmpte240:
+		matrix, transfer, primaries = cicpMatrixSMPTE240M, cicpTransferSMPTE240M, cicpPrimariesSMPTE240M
+	case ColorSpaceBt2020:
+		matrix, transfer, primaries = cicpMatrixBT2020NCL, cicpTransferBT2020_10, cicpPrimariesBT2020
+		if c.BitDepth > 10 {
+			transfer = cicpTransferBT2020_12
+		}
+	case ColorSpaceSrgb:
+		matrix, transfer, primaries = cicpMatrixIdentity, cicpTransferIEC61966, cicpPrimariesBT709
+	default:
+		return
+	}
+	if c.Matrix == 0 && c.Space != ColorSpaceSrgb {
+		c.Matrix = matrix
+	}
+	if c.Transfer == 0 {
+		c.Transfer = transfer
+	}
+	if c.Primaries == 0 {
+		c.Primaries = primaries
+	}
+}
+
+// ColorSpaceFromMatrix returns the VP9 colour space of a ISO/IEC 23001-8 matrix.
+func ColorSpaceFromMatrix(matrix uint) ColorSpace {
+	switch matrix {
+	case cicpMatrixIdentity:
+		return ColorSpaceSrgb
+	case cicpMatrixBT709:
+		return ColorSpaceBt709
+	case cicpMatrixBT470BG:
+		return ColorSpaceBt601
+	case cicpMatrixSMPTE170M:
+		return ColorSpaceSmpte170
+	case cicpMatrixSMPTE240M:
+		return ColorSpaceSmpte240
+	case cicpMatrixBT2020NCL:
+		return ColorSpaceBt2020
+	default:
+		return ColorSpaceUnknown
+	}
+}
+
+// Controls returns the VP9 encoder controls that signal the colour space and
+// range in the bitstream, the colour space is derived from the matrix if unknown,
+// so sRGB must be given as the colour space.
+func (c ColorInfo) Controls() []ControlSetting {
+	cs := c.Space
+	if cs == ColorSpaceUnknown && c.Matrix != 0 {
+		cs = ColorSpaceFromMatrix(c.Matrix)
+	}
+	return []ControlSetting{
+		{ID: Vp9eSetColorSpace, Value: int32(cs)},
+		{ID: Vp9eSetColorRange, Value: int32(c.Range)},
+	}
+}
+
+// SetColor signals the colour space and range of the VP9 stream, the other fields
+// of the colour are for the container, see webmwriter.NewColour.
+func (e *Encoder) SetColor(c ColorInfo) error {
+	if e.ctx == nil {
+		return ErrEncoderClosed
+	}
+	return e.setControls(c.Controls())
+}
+
+// ColorInfo returns the colour of the image as coded in the bitstream, with the
+// matrix, transfer and primaries implied by the colour space.
+func (img *Image) ColorInfo() ColorInfo {
+	c := ColorInfo{
+		Space:        img.Cs,
+		Range:        img.Range,
+		BitDepth:     img.BitDepth,
+		XChromaShift: img.XChromaShift,
+		YChromaShift: img.YChromaShift,
+	}
+	if c.BitDepth == 0 {
+		c.BitDepth = 8
+	}
+	c.fillCodePoints()
+	return c
+}
+
+// WithContainer completes the colour coded in the bitstream with the metadata from
+// the container, which is authoritative for the matrix, transfer and primaries.
+func (c ColorInfo) WithContainer(container ColorInfo) ColorInfo {
+	// zero is the identity matrix of sRGB, otherwise it is not set
+	if container.Space == ColorSpaceSrgb || container.Matrix != 0 && container.Matrix != cicpUnspecified {
+		c.Matrix = container.Matrix
+	}
+	if container.Transfer != 0 && container.Transfer != cicpUnspecified {
+		c.Transfer = container.Transfer
+	}
+	if container.Primaries != 0 && container.Primaries != cicpUnspecified {
+		c.Primaries = container.Primaries
+	}
+	if container.Mastering != nil {
+		c.Mastering = container.Mastering
+	}
+	if container.MaxCLL != 0 {
+		c.MaxCLL = container.MaxCLL
+	}
+	if container.MaxFALL != 0 {
+		c.MaxFALL = container.MaxFALL
+	}
+	return c
+}
+
+// lumaCoefficients returns the Kr and Kb coefficients of the matrix.
+func lumaCoefficients(matrix uint) (kr, kb float64) {
+	switch matrix {
+	case cicpMatrixBT709:
+		return 0.2126, 0.0722
+	case cicpMatrixSMPTE240M:
+		return 0.212, 0.087
+	case cicpMatrixBT2020NCL:
+		return 0.2627, 0.0593
+	default:
+		return 0.299, 0.114
+	}
+}
@@ -0,0 +1,294 @@
+package vpx
+
+/*
+#cgo pkg-config: vpx
+#include <vpx/vp8dx.h>
+#include <vpx/vp8cx.h>
+
+static vpx_codec_err_t codec_control_int(vpx_codec_ctx_t *ctx, int id, int v) {
+	return vpx_codec_control_(ctx, id, v);
+}
+static vpx_codec_err_t codec_control_uint(vpx_codec_ctx_t *ctx, int id, unsigned int v) {
+	return vpx_codec_control_(ctx, id, v);
+}
+static vpx_codec_err_t codec_control_ptr(vpx_codec_ctx_t *ctx, int id, void *v) {
+	return vpx_codec_control_(ctx, id, v);
+}
+static vpx_codec_err_t codec_control_scalemode(vpx_codec_ctx_t *ctx, int h, int v) {
+	vpx_scaling_mode_t mode = {(VPX_SCALING_MODE)h, (VPX_SCALING_MODE)v};
+	return vpx_codec_control_(ctx, VP8E_SET_SCALEMODE, &mode);
+}
+static vpx_codec_err_t codec_control_size(vpx_codec_ctx_t *ctx, int id, int w, int h) {
+	int size[2] = {w, h};
+	return vpx_codec_control_(ctx, id, size);
+}
+static vpx_codec_err_t codec_control_get_size(vpx_codec_ctx_t *ctx, int id, int *w, int *h) {
+	int size[2] = {0, 0};
+	vpx_codec_err_t ret = vpx_codec_control_(ctx, id, size);
+	*w = size[0];
+	*h = size[1];
+	return ret;
+}
+*/
+import "C"
+import (
+	"errors"
+	"strconv"
+	"unsafe"
+)
+
+// ControlID identifies a codec control as declared in vp8.h, vp8cx.h and vp8dx.h.
+type ControlID int32
+
+// Common controls as declared in vpx-1.6.0/vp8.h.
+const (
+	Vp8SetReference  ControlID = C.VP8_SET_REFERENCE
+	Vp8CopyReference ControlID = C.VP8_COPY_REFERENCE
+	Vp8SetPostproc   ControlID = C.VP8_SET_POSTPROC
+	Vp9GetReference  ControlID = C.VP9_GET_REFERENCE
+)
+
+// Encoder controls as declared in vpx-1.6.0/vp8cx.h.
+const (
+	Vp8eSetRoiMap                ControlID = C.VP8E_SET_ROI_MAP
+	Vp8eSetActivemap             ControlID = C.VP8E_SET_ACTIVEMAP
+	Vp8eSetScalemode             ControlID = C.VP8E_SET_SCALEMODE
+	Vp8eSetCpuused               ControlID = C.VP8E_SET_CPUUSED
+	Vp8eSetEnableautoaltref      ControlID = C.VP8E_SET_ENABLEAUTOALTREF
+	Vp8eSetNoiseSensitivity      ControlID = C.VP8E_SET_NOISE_SENSITIVITY
+	Vp8eSetSharpness             ControlID = C.VP8E_SET_SHARPNESS
+	Vp8eSetStaticThreshold       ControlID = C.VP8E_SET_STATIC_THRESHOLD
+	Vp8eSetTokenPartitions       ControlID = C.VP8E_SET_TOKEN_PARTITIONS
+	Vp8eGetLastQuantizer         ControlID = C.VP8E_GET_LAST_QUANTIZER
+	Vp8eGetLastQuantizer64       ControlID = C.VP8E_GET_LAST_QUANTIZER_64
+	Vp8eSetArnrMaxframes         ControlID = C.VP8E_SET_ARNR_MAXFRAMES
+	Vp8eSetArnrStrength          ControlID = C.VP8E_SET_ARNR_STRENGTH
+	Vp8eSetArnrType              ControlID = C.VP8E_SET_ARNR_TYPE
+	Vp8eSetTuning                ControlID = C.VP8E_SET_TUNING
+	Vp8eSetCqLevel               ControlID = C.VP8E_SET_CQ_LEVEL
+	Vp8eSetMaxIntraBitratePct    ControlID = C.VP8E_SET_MAX_INTRA_BITRATE_PCT
+	Vp8eSetFrameFlags            ControlID = C.VP8E_SET_FRAME_FLAGS
+	Vp9eSetMaxInterBitratePct    ControlID = C.VP9E_SET_MAX_INTER_BITRATE_PCT
+	Vp9eSetGfCbrBoostPct         ControlID = C.VP9E_SET_GF_CBR_BOOST_PCT
+	Vp8eSetTemporalLayerId       ControlID = C.VP8E_SET_TEMPORAL_LAYER_ID
+	Vp8eSetScreenContentMode     ControlID = C.VP8E_SET_SCREEN_CONTENT_MODE
+	Vp9eSetLossless              ControlID = C.VP9E_SET_LOSSLESS
+	Vp9eSetTileColumns           ControlID = C.VP9E_SET_TILE_COLUMNS
+	Vp9eSetTileRows              ControlID = C.VP9E_SET_TILE_ROWS
+	Vp9eSetFrameParallelDecoding ControlID = C.VP9E_SET_FRAME_PARALLEL_DECODING
+	Vp9eSetAqMode                ControlID = C.VP9E_SET_AQ_MODE
+	Vp9eSetFramePeriodicBoost    ControlID = C.VP9E_SET_FRAME_PERIODIC_BOOST
+	Vp9eSetNoiseSensitivity      ControlID = C.VP9E_SET_NOISE_SENSITIVITY
+	Vp9eSetSvc                   ControlID = C.VP9E_SET_SVC
+	Vp9eSetSvcParameters         ControlID = C.VP9E_SET_SVC_PARAMETERS
+	Vp9eSetSvcLayerId            ControlID = C.VP9E_SET_SVC_LAYER_ID
+	Vp9eSetTuneContent           ControlID = C.VP9E_SET_TUNE_CONTENT
+	Vp9eGetSvcLayerId            ControlID = C.VP9E_GET_SVC_LAYER_ID
+	Vp9eRegisterCxCallback       ControlID = C.VP9E_REGISTER_CX_CALLBACK
+	Vp9eSetColorSpace            ControlID = C.VP9E_SET_COLOR_SPACE
+	Vp9eSetTemporalLayeringMode  ControlID = C.VP9E_SET_TEMPORAL_LAYERING_MODE
+	Vp9eSetMinGfInterval         ControlID = C.VP9E_SET_MIN_GF_INTERVAL
+	Vp9eSetMaxGfInterval         ControlID = C.VP9E_SET_MAX_GF_INTERVAL
+	Vp9eGetActivemap             ControlID = C.VP9E_GET_ACTIVEMAP
+	Vp9eSetColorRange            ControlID = C.VP9E_SET_COLOR_RANGE
+	Vp9eSetSvcRefFrameConfig     ControlID = C.VP9E_SET_SVC_REF_FRAME_CONFIG
+	Vp9eSetRenderSize            ControlID = C.VP9E_SET_RENDER_SIZE
+	Vp9eSetTargetLevel           ControlID = C.VP9E_SET_TARGET_LEVEL
+	Vp9eGetLevel                 ControlID = C.VP9E_GET_LEVEL
+)
+
+// ScalingMode is the internal scaling of the encoder in one dimension, set with Vp8eSetScalemode.
+type ScalingMode int32
+
+// ScalingMode enumeration from vpx-1.6.0/vp8cx.h.
+const (
+	ScaleNormal    ScalingMode = C.VP8E_NORMAL
+	ScaleFourFive  ScalingMode = C.VP8E_FOURFIVE
+	ScaleThreeFive ScalingMode = C.VP8E_THREEFIVE
+	ScaleOneTwo    ScalingMode = C.VP8E_ONETWO
+)
+
+// Decoder controls as declared in vpx-1.6.0/vp8dx.h.
+const (
+	Vp8dGetLastRefUpdates    ControlID = C.VP8D_GET_LAST_REF_UPDATES
+	Vp8dGetFrameCorrupted    ControlID = C.VP8D_GET_FRAME_CORRUPTED
+	Vp8dGetLastRefUsed       ControlID = C.VP8D_GET_LAST_REF_USED
+	VpxdSetDecryptor         ControlID = C.VPXD_SET_DECRYPTOR
+	Vp9dGetFrameSize         ControlID = C.VP9D_GET_FRAME_SIZE
+	Vp9dGetDisplaySize       ControlID = C.VP9D_GET_DISPLAY_SIZE
+	Vp9dGetBitDepth          ControlID = C.VP9D_GET_BIT_DEPTH
+	Vp9SetByteAlignment      ControlID = C.VP9_SET_BYTE_ALIGNMENT
+	Vp9InvertTileDecodeOrder ControlID = C.VP9_INVERT_TILE_DECODE_ORDER
+	Vp9SetSkipLoopFilter     ControlID = C.VP9_SET_SKIP_LOOP_FILTER
+)
+
+var controlNames = map[ControlID]string{
+	Vp8SetReference:              "VP8_SET_REFERENCE",
+	Vp8CopyReference:             "VP8_COPY_REFERENCE",
+	Vp8SetPostproc:               "VP8_SET_POSTPROC",
+	Vp9GetReference:              "VP9_GET_REFERENCE",
+	Vp8dGetLastRefUpdates:        "VP8D_GET_LAST_REF_UPDATES",
+	Vp8dGetFrameCorrupted:        "VP8D_GET_FRAME_CORRUPTED",
+	Vp8dGetLastRefUsed:           "VP8D_GET_LAST_REF_USED",
+	VpxdSetDecryptor:             "VPXD_SET_DECRYPTOR",
+	Vp9dGetFrameSize:             "VP9D_GET_FRAME_SIZE",
+	Vp9dGetDisplaySize:           "VP9D_GET_DISPLAY_SIZE",
+	Vp9dGetBitDepth:              "VP9D_GET_BIT_DEPTH",
+	Vp9SetByteAlignment:          "VP9_SET_BYTE_ALIGNMENT",
+	Vp9InvertTileDecodeOrder:     "VP9_INVERT_TILE_DECODE_ORDER",
+	Vp9SetSkipLoopFilter:         "VP9_SET_SKIP_LOOP_FILTER",
+	Vp8eSetRoiMap:                "VP8E_SET_ROI_MAP",
+	Vp8eSetActivemap:             "VP8E_SET_ACTIVEMAP",
+	Vp8eSetScalemode:             "VP8E_SET_SCALEMODE",
+	Vp8eSetCpuused:               "VP8E_SET_CPUUSED",
+	Vp8eSetEnableautoaltref:      "VP8E_SET_ENABLEAUTOALTREF",
+	Vp8eSetNoiseSensitivity:      "VP8E_SET_NOISE_SENSITIVITY",
+	Vp8eSetSharpness:             "VP8E_SET_SHARPNESS",
+	Vp8eSetStaticThreshold:       "VP8E_SET_STATIC_THRESHOLD",
+	Vp8eSetTokenPartitions:       "VP8E_SET_TOKEN_PARTITIONS",
+	Vp8eGetLastQuantizer:         "VP8E_GET_LAST_QUANTIZER",
+	Vp8eGetLastQuantizer64:       "VP8E_GET_LAST_QUANTIZER_64",
+	Vp8eSetArnrMaxframes:         "VP8E_SET_ARNR_MAXFRAMES",
+	Vp8eSetArnrStrength:          "VP8E_SET_ARNR_STRENGTH",
+	Vp8eSetArnrType:              "VP8E_SET_ARNR_TYPE",
+	Vp8eSetTuning:                "VP8E_SET_TUNING",
+	Vp8eSetCqLevel:               "VP8E_SET_CQ_LEVEL",
+	Vp8eSetMaxIntraBitratePct:    "VP8E_SET_MAX_INTRA_BITRATE_PCT",
+	Vp8eSetFrameFlags:            "VP8E_SET_FRAME_FLAGS",
+	Vp9eSetMaxInterBitratePct:    "VP9E_SET_MAX_INTER_BITRATE_PCT",
+	Vp9eSetGfCbrBoostPct:         "VP9E_SET_GF_CBR_BOOST_PCT",
+	Vp8eSetTemporalLayerId:       "VP8E_SET_TEMPORAL_LAYER_ID",
+	Vp8eSetScreenContentMode:     "VP8E_SET_SCREEN_CONTENT_MODE",
+	Vp9eSetLossless:              "VP9E_SET_LOSSLESS",
+	Vp9eSetTileColumns:           "VP9E_SET_TILE_COLUMNS",
+	Vp9eSetTileRows:              "VP9E_SET_TILE_ROWS",
+	Vp9eSetFrameParallelDecoding: "VP9E_SET_FRAME_PARALLEL_DECODING",
+	Vp9eSetAqMode:                "VP9E_SET_AQ_MODE",
+	Vp9eSetFramePeriodicBoost:    "VP9E_SET_FRAME_PERIODIC_BOOST",
+	Vp9eSetNoiseSensitivity:      "VP9E_SET_NOISE_SENSITIVITY",
+	Vp9eSetSvc:                   "VP9E_SET_SVC",
+	Vp9eSetSvcParameters:         "VP9E_SET_SVC_PARAMETERS",
+	Vp9eSetSvcLayerId:            "VP9E_SET_SVC_LAYER_ID",
+	Vp9eSetTuneContent:           "VP9E_SET_TUNE_CONTENT",
+	Vp9eGetSvcLayerId:            "VP9E_GET_SVC_LAYER_ID",
+	Vp9eRegisterCxCallback:       "VP9E_REGISTER_CX_CALLBACK",
+	Vp9eSetColorSpace:            "VP9E_SET_COLOR_SPACE",
+	Vp9eSetTemporalLayeringMode:  "VP9E_SET_TEMPORAL_LAYERING_MODE",
+	Vp9eSetMinGfInterval:         "VP9E_SET_MIN_GF_INTERVAL",
+	Vp9eSetMaxGfInterval:         "VP9E_SET_MAX_GF_INTERVAL",
+	Vp9eGetActivemap:             "VP9E_GET_ACTIVEMAP",
+	Vp9eSetColorRange:            "VP9E_SET_COLOR_RANGE",
+	Vp9eSetSvcRefFrameConfig:     "VP9E_SET_SVC_REF_FRAME_CONFIG",
+	Vp9eSetRenderSize:            "VP9E_SET_RENDER_SIZE",
+	Vp9eSetTargetLevel:           "VP9E_SET_TARGET_LEVEL",
+	Vp9eGetLevel:                 "VP9E_GET_LEVEL",
+}
+
+// Supported reports whether the control is declared by the libvpx headers the package
+// was built with. Calling an unsupported control fails with CodecUnsupFeature, the
+// error returned by NewControlError then matches ErrControlUnsupported.
+func (id ControlID) Supported() bool {
+	return id >= 0
+}
+
+// String returns the C name of the control.
+func (id ControlID) String() string {
+	if name, ok := controlNames[id]; ok {
+		return name
+	}
+	return "ControlID(" + strconv.Itoa(int(id)) + ")"
+}
+
+// MarshalText encodes the control as its C name, so configuration files stay valid
+// across libvpx versions, or as its number if the name is not known.
+func (id ControlID) MarshalText() ([]byte, error) {
+	if name, ok := controlNames[id]; ok {
+		return []byte(name), nil
+	}
+	return []byte(strconv.Itoa(int(id))), nil
+}
+
+// UnmarshalText decodes a control given by its C name or number.
+func (id *ControlID) UnmarshalText(text []byte) error {
+	s := string(text)
+	for v, name := range controlNames {
+		if name == s {
+			*id = v
+			return nil
+		}
+	}
+	v, err := strconv.Atoi(s)
+	if err != nil {
+		return errors.New("vpx: unknown control " + strconv.Quote(s))
+	}
+	*id = ControlID(v)
+	return nil
+}
+
+// CodecControlInt calls a control that takes an int argument.
+func CodecControlInt(ctx *CodecCtx, id ControlID, v int32) CodecErr {
+	if !id.Supported() {
+		return CodecUnsupFeature
+	}
+	cctx := (*C.vpx_codec_ctx_t)(unsafe.Pointer(ctx))
+	return (CodecErr)(C.codec_control_int(cctx, C.int(id), C.int(v)))
+}
+
+// CodecControlUint calls a control that takes an unsigned int argument.
+func CodecControlUint(ctx *CodecCtx, id ControlID, v uint32) CodecErr {
+	if !id.Supported() {
+		return CodecUnsupFeature
+	}
+	cctx := (*C.vpx_codec_ctx_t)(unsafe.Pointer(ctx))
+	return (CodecErr)(C.codec_control_uint(cctx, C.int(id), C.uint(v)))
+}
+
+// CodecControlGetInt calls a control that stores an int result through a pointer.
+func CodecControlGetInt(ctx *CodecCtx, id ControlID) (int32, CodecErr) {
+	if !id.Supported() {
+		return 0, CodecUnsupFeature
+	}
+	cctx := (*C.vpx_codec_ctx_t)(unsafe.Pointer(ctx))
+	var v C.int
+	ret := C.codec_control_ptr(cctx, C.int(id), unsafe.Pointer(&v))
+	return int32(v), (CodecErr)(ret)
+}
+
+// CodecControlScaleMode sets the internal scaling of the encoder (Vp8eSetScalemode),
+// the input images keep their size and are scaled down before encoding.
+func CodecControlScaleMode(ctx *CodecCtx, h, v ScalingMode) CodecErr {
+	cctx := (*C.vpx_codec_ctx_t)(unsafe.Pointer(ctx))
+	return (CodecErr)(C.codec_control_scalemode(cctx, C.int(h), C.int(v)))
+}
+
+// CodecControlSize calls a control that takes a width and height as an int[2],
+// such as Vp9eSetRenderSize.
+func CodecControlSize(ctx *CodecCtx, id ControlID, w, h int32) CodecErr {
+	if !id.Supported() {
+		return CodecUnsupFeature
+	}
+	cctx := (*C.vpx_codec_ctx_t)(unsafe.Pointer(ctx))
+	return (CodecErr)(C.codec_control_size(cctx, C.int(id), C.int(w), C.int(h)))
+}
+
+// CodecControlGetSize calls a control that stores a width and height in an int[2],
+// such as Vp9dGetDisplaySize and Vp9dGetFrameSize.
+func CodecControlGetSize(ctx *CodecCtx, id ControlID) (w, h int32, ret CodecErr) {
+	if !id.Supported() {
+		return 0, 0, CodecUnsupFeature
+	}
+	cctx := (*C.vpx_codec_ctx_t)(unsafe.Pointer(ctx))
+	var cw, ch C.int
+	ret = (CodecErr)(C.codec_control_get_size(cctx, C.int(id), &cw, &ch))
+	return int32(cw), int32(ch), ret
+}
+
+// CodecControlPtr calls a control that takes a pointer argument, e.g. to a C struct
+// or array. The memory must not contain Go pointers.
+func CodecControlPtr(ctx *CodecCtx, id ControlID, ptr unsafe.Pointer) CodecErr {
+	if !id.Supported() {
+		return CodecUnsupFeature
+	}
+	cctx := (*C.vpx_codec_ctx_t)(unsafe.Pointer(ctx))
+	return (CodecErr)(C.codec_control_ptr(cctx, C.int(id), ptr))
+}
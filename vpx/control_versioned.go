@@ -0,0 +1,141 @@
+package vpx
+
+/*
+#cgo pkg-config: vpx
+#include <vpx/vp8dx.h>
+#include <vpx/vp8cx.h>
+
+// The controls below were added after libvpx 1.6.0. The headers define
+// VPX_CTRL_<id> for every control they declare, controls missing from the
+// installed headers get distinct negative ids that are never passed to libvpx.
+
+#ifdef VPX_CTRL_VP9E_SET_ROW_MT
+#define GO_VP9E_SET_ROW_MT VP9E_SET_ROW_MT
+#else
+#define GO_VP9E_SET_ROW_MT -1
+#endif
+
+#ifdef VPX_CTRL_VP9E_SET_TPL
+#define GO_VP9E_SET_TPL VP9E_SET_TPL
+#else
+#define GO_VP9E_SET_TPL -2
+#endif
+
+#ifdef VPX_CTRL_VP9E_ENABLE_MOTION_VECTOR_UNIT_TEST
+#define GO_VP9E_ENABLE_MOTION_VECTOR_UNIT_TEST VP9E_ENABLE_MOTION_VECTOR_UNIT_TEST
+#else
+#define GO_VP9E_ENABLE_MOTION_VECTOR_UNIT_TEST -3
+#endif
+
+#ifdef VPX_CTRL_VP9E_SET_SVC_INTER_LAYER_PRED
+#define GO_VP9E_SET_SVC_INTER_LAYER_PRED VP9E_SET_SVC_INTER_LAYER_PRED
+#else
+#define GO_VP9E_SET_SVC_INTER_LAYER_PRED -4
+#endif
+
+#ifdef VPX_CTRL_VP9E_SET_SVC_FRAME_DROP_LAYER
+#define GO_VP9E_SET_SVC_FRAME_DROP_LAYER VP9E_SET_SVC_FRAME_DROP_LAYER
+#else
+#define GO_VP9E_SET_SVC_FRAME_DROP_LAYER -5
+#endif
+
+#ifdef VPX_CTRL_VP9E_SET_SVC_GF_TEMPORAL_REF
+#define GO_VP9E_SET_SVC_GF_TEMPORAL_REF VP9E_SET_SVC_GF_TEMPORAL_REF
+#else
+#define GO_VP9E_SET_SVC_GF_TEMPORAL_REF -6
+#endif
+
+#ifdef VPX_CTRL_VP9E_SET_POSTENCODE_DROP
+#define GO_VP9E_SET_POSTENCODE_DROP VP9E_SET_POSTENCODE_DROP
+#else
+#define GO_VP9E_SET_POSTENCODE_DROP -7
+#endif
+
+#ifdef VPX_CTRL_VP9E_SET_DISABLE_OVERSHOOT_MAXQ_CBR
+#define GO_VP9E_SET_DISABLE_OVERSHOOT_MAXQ_CBR VP9E_SET_DISABLE_OVERSHOOT_MAXQ_CBR
+#else
+#define GO_VP9E_SET_DISABLE_OVERSHOOT_MAXQ_CBR -8
+#endif
+
+#ifdef VPX_CTRL_VP9E_SET_DISABLE_LOOPFILTER
+#define GO_VP9E_SET_DISABLE_LOOPFILTER VP9E_SET_DISABLE_LOOPFILTER
+#else
+#define GO_VP9E_SET_DISABLE_LOOPFILTER -9
+#endif
+
+#ifdef VPX_CTRL_VP8E_SET_RTC_EXTERNAL_RATECTRL
+#define GO_VP8E_SET_RTC_EXTERNAL_RATECTRL VP8E_SET_RTC_EXTERNAL_RATECTRL
+#else
+#define GO_VP8E_SET_RTC_EXTERNAL_RATECTRL -10
+#endif
+
+#ifdef VPX_CTRL_VP9_DECODE_SVC_SPATIAL_LAYER
+#define GO_VP9_DECODE_SVC_SPATIAL_LAYER VP9_DECODE_SVC_SPATIAL_LAYER
+#else
+#define GO_VP9_DECODE_SVC_SPATIAL_LAYER -11
+#endif
+
+#ifdef VPX_CTRL_VPXD_GET_LAST_QUANTIZER
+#define GO_VPXD_GET_LAST_QUANTIZER VPXD_GET_LAST_QUANTIZER
+#else
+#define GO_VPXD_GET_LAST_QUANTIZER -12
+#endif
+
+#ifdef VPX_CTRL_VP9D_SET_ROW_MT
+#define GO_VP9D_SET_ROW_MT VP9D_SET_ROW_MT
+#else
+#define GO_VP9D_SET_ROW_MT -13
+#endif
+
+#ifdef VPX_CTRL_VP9D_SET_LOOP_FILTER_OPT
+#define GO_VP9D_SET_LOOP_FILTER_OPT VP9D_SET_LOOP_FILTER_OPT
+#else
+#define GO_VP9D_SET_LOOP_FILTER_OPT -14
+#endif
+*/
+import "C"
+
+// Encoder controls added in libvpx 1.7 and later, they are unsupported
+// when the installed headers do not declare them.
+const (
+	Vp9eSetRowMT                   ControlID = C.GO_VP9E_SET_ROW_MT
+	Vp9eSetTpl                     ControlID = C.GO_VP9E_SET_TPL
+	Vp9eEnableMotionVectorUnitTest ControlID = C.GO_VP9E_ENABLE_MOTION_VECTOR_UNIT_TEST
+	Vp9eSetSvcInterLayerPred       ControlID = C.GO_VP9E_SET_SVC_INTER_LAYER_PRED
+	Vp9eSetSvcFrameDropLayer       ControlID = C.GO_VP9E_SET_SVC_FRAME_DROP_LAYER
+	Vp9eSetSvcGfTemporalRef        ControlID = C.GO_VP9E_SET_SVC_GF_TEMPORAL_REF
+	Vp9eSetPostencodeDrop          ControlID = C.GO_VP9E_SET_POSTENCODE_DROP
+	Vp9eSetDisableOvershootMaxqCbr ControlID = C.GO_VP9E_SET_DISABLE_OVERSHOOT_MAXQ_CBR
+	Vp9eSetDisableLoopfilter       ControlID = C.GO_VP9E_SET_DISABLE_LOOPFILTER
+	Vp8eSetRtcExternalRatectrl     ControlID = C.GO_VP8E_SET_RTC_EXTERNAL_RATECTRL
+)
+
+// Decoder controls added in libvpx 1.7 and later, they are unsupported
+// when the installed headers do not declare them.
+const (
+	Vp9DecodeSvcSpatialLayer ControlID = C.GO_VP9_DECODE_SVC_SPATIAL_LAYER
+	VpxdGetLastQuantizer     ControlID = C.GO_VPXD_GET_LAST_QUANTIZER
+	Vp9dSetRowMT             ControlID = C.GO_VP9D_SET_ROW_MT
+	Vp9dSetLoopFilterOpt     ControlID = C.GO_VP9D_SET_LOOP_FILTER_OPT
+)
+
+func init() {
+	for id, name := range map[ControlID]string{
+		Vp9eSetRowMT:                   "VP9E_SET_ROW_MT",
+		Vp9eSetTpl:                     "VP9E_SET_TPL",
+		Vp9eEnableMotionVectorUnitTest: "VP9E_ENABLE_MOTION_VECTOR_UNIT_TEST",
+		Vp9eSetSvcInterLayerPred:       "VP9E_SET_SVC_INTER_LAYER_PRED",
+		Vp9eSetSvcFrameDropLayer:       "VP9E_SET_SVC_FRAME_DROP_LAYER",
+		Vp9eSetSvcGfTemporalRef:        "VP9E_SET_SVC_GF_TEMPORAL_REF",
+		Vp9eSetPostencodeDrop:          "VP9E_SET_POSTENCODE_DROP",
+		Vp9eSetDisableOvershootMaxqCbr: "VP9E_SET_DISABLE_OVERSHOOT_MAXQ_CBR",
+		Vp9eSetDisableLoopfilter:       "VP9E_SET_DISABLE_LOOPFILTER",
+		Vp8eSetRtcExternalRatectrl:     "VP8E_SET_RTC_EXTERNAL_RATECTRL",
+		Vp9DecodeSvcSpatialLayer:       "VP9_DECODE_SVC_SPATIAL_LAYER",
+		VpxdGetLastQuantizer:           "VPXD_GET_LAST_QUANTIZER",
+		Vp9dSetRowMT:                   "VP9D_SET_ROW_MT",
+		Vp9dSetLoopFilterOpt:           "VP9D_SET_LOOP_FILTER_OPT",
+	} {
+		controlNames[id] = name
+	}
+}
@@ -0,0 +1,362 @@
+package vpx
+
+/*
+#cgo pkg-config: vpx
+#include <vpx/vpx_decoder.h>
+#include <stdint.h>
+#include <stdlib.h>
+#include <string.h>
+
+static vpx_codec_err_t decoder_decode(vpx_codec_ctx_t *ctx, const void *data, unsigned int sz, uintptr_t tag) {
+	return vpx_codec_decode(ctx, (const uint8_t *)data, sz, (void *)tag, 0);
+}
+
+static uintptr_t image_tag(const vpx_image_t *img) { return (uintptr_t)img->user_priv; }
+
+static void *copy_fragment(const void *data, size_t sz) {
+	void *buf = malloc(sz);
+	if (buf != NULL) {
+		memcpy(buf, data, sz);
+	}
+	return buf;
+}
+*/
+import "C"
+
+import (
+	"errors"
+	"runtime"
+	"unsafe"
+)
+
+var (
+	ErrDecoderClosed    = errors.New("vpx: decoder is closed")
+	ErrNotFragmentMode  = errors.New("vpx: decoder was not created with InputFragments")
+	ErrEmptyFragment    = errors.New("vpx: empty fragment")
+	ErrNoDecoderIface   = errors.New("vpx: no decoder interface")
+	ErrIfaceNotDecoder  = errors.New("vpx: interface is not a decoder")
+	ErrConcealmentUnsup = errors.New("vpx: decoder does not support error concealment")
+	ErrFragmentsUnsup   = errors.New("vpx: decoder does not support input fragments")
+)
+
+// DecoderConfig holds the options of a Decoder.
+type DecoderConfig struct {
+	// Threads is the maximum number of threads to use, runtime.NumCPU is used if zero.
+	// VP9 decodes the tile columns of a frame in parallel, so the stream must be
+	// encoded with tile columns to benefit. Frame parallel decoding
+	// (CodecUseFrameThreading) is not offered, it is a no-op since libvpx 1.7.
+	Threads uint32
+	// Width and Height are optional hints of the stream size.
+	Width  uint32
+	Height uint32
+	// ErrorConcealment enables VP8 error concealment (CodecUseErrorConcealment): instead of
+	// failing on frames with missing data the decoder conceals the damaged macroblocks
+	// and marks the frame as corrupted.
+	ErrorConcealment bool
+	// InputFragments enables passing a frame one partition at a time with DecodeFragment
+	// followed by EndFrame (CodecUseInputFragments), so a frame with lost partitions can
+	// still be decoded. Decode passes the whole frame as a single fragment.
+	InputFragments bool
+}
+
+// DecodedFrame is a frame returned by the decoder.
+type DecodedFrame struct {
+	// Image references decoder memory, it stays valid until the next decode call.
+	*Image
+	// Pts is the value passed to DecodePts along with the data of the frame.
+	Pts CodecPts
+	// Color is the colour coded in the bitstream, complete it with the container
+	// metadata using WithContainer.
+	Color ColorInfo
+	// DisplayWidth and DisplayHeight are the size the frame is meant to be shown at,
+	// the VP9 render size (VP9D_GET_DISPLAY_SIZE) which may differ from the coded
+	// size DW and DH for anamorphic streams. It is read when the frame is decoded and
+	// kept with its pts.
+	DisplayWidth  uint32
+	DisplayHeight uint32
+	// Corrupted is set when the decoder reports the frame as corrupted (VP8D_GET_FRAME_CORRUPTED),
+	// with error concealment this means parts of the frame were concealed.
+	Corrupted bool
+}
+
+// Decoder wraps a decoder context with the decode and get frame loop.
+type Decoder struct {
+	h     *Context
+	ctx   *CodecCtx
+	iface *CodecIface
+	cfg   DecoderConfig
+
+	iter      CodecIter
+	corrupted bool
+	fragments []unsafe.Pointer
+
+	// pts and render size of the frames in decoding order, libvpx returns
+	// the tags through the user_priv field of the images.
+	pending []pendingFrame
+	nextTag uintptr
+}
+
+// maxPendingFrames bounds the number of frames waiting for output.
+const maxPendingFrames = 256
+
+type pendingFrame struct {
+	tag uintptr
+	pts CodecPts
+	// render size reported after the frame was decoded, zero if unknown
+	displayW, displayH uint32
+}
+
+// NewDecoder initializes a decoder with the given interface, see DecoderIfaceVP8 and DecoderIfaceVP9.
+func NewDecoder(iface *CodecIface, cfg DecoderConfig) (*Decoder, error) {
+	if iface == nil {
+		return nil, ErrNoDecoderIface
+	}
+	caps := Capabilities(iface)
+	if !caps.Decoder {
+		return nil, ErrIfaceNotDecoder
+	}
+	var flags CodecFlags
+	if cfg.ErrorConcealment {
+		if !caps.ErrorConcealment {
+			return nil, ErrConcealmentUnsup
+		}
+		flags |= CodecUseErrorConcealment
+	}
+	if cfg.InputFragments {
+		if !caps.InputFragments {
+			return nil, ErrFragmentsUnsup
+		}
+		flags |= CodecUseInputFragments
+	}
+	if cfg.Threads == 0 {
+		cfg.Threads = uint32(runtime.NumCPU())
+	}
+	d := &Decoder{
+		h:     NewContext(),
+		iface: iface,
+		cfg:   cfg,
+	}
+	decCfg := &CodecDecCfg{
+		Threads: cfg.Threads,
+		W:       cfg.Width,
+		H:       cfg.Height,
+	}
+	// the decoder keeps its own copy of the configuration
+	defer decCfg.Free()
+	if err := d.h.InitDecoder(iface, decCfg, flags); err != nil {
+		d.h.Close()
+		return nil, err
+	}
+	d.ctx, _ = d.h.Ctx()
+	return d, nil
+}
+
+// Config returns the options the decoder was created with.
+func (d *Decoder) Config() DecoderConfig {
+	return d.cfg
+}
+
+// Ctx returns the underlying codec context, e.g. to call controls.
+func (d *Decoder) Ctx() *CodecCtx {
+	return d.ctx
+}
+
+// SetControl calls a decoder control that takes an int argument, such as
+// Vp9DecodeSvcSpatialLayer. The error matches ErrControlUnsupported if the
+// installed libvpx does not have the control.
+func (d *Decoder) SetControl(id ControlID, v int32) error {
+	if d.ctx == nil {
+		return ErrDecoderClosed
+	}
+	err := NewControlError(d.ctx, d.iface, id, CodecControlInt(d.ctx, id, v))
+	runtime.KeepAlive(d.h)
+	return err
+}
+
+// GetControl calls a decoder control that returns an int, such as VpxdGetLastQuantizer.
+func (d *Decoder) GetControl(id ControlID) (int32, error) {
+	if d.ctx == nil {
+		return 0, ErrDecoderClosed
+	}
+	v, ret := CodecControlGetInt(d.ctx, id)
+	err := NewControlError(d.ctx, d.iface, id, ret)
+	runtime.KeepAlive(d.h)
+	if err != nil {
+		return 0, err
+	}
+	return v, nil
+}
+
+// Decode decodes a complete frame, the decoded frames are then available from NextFrame.
+func (d *Decoder) Decode(data []byte) error {
+	return d.DecodePts(data, 0)
+}
+
+// DecodePts decodes a complete frame like Decode, the pts is attached to the frame
+// returned by NextFrame even if the decoder delays the output.
+func (d *Decoder) DecodePts(data []byte, pts CodecPts) error {
+	if d.ctx == nil {
+		return ErrDecoderClosed
+	}
+	d.nextTag++
+	if len(d.pending) >= maxPendingFrames {
+		// frames that failed to decode never come out
+		d.pending = d.pending[1:]
+	}
+	d.pending = append(d.pending, pendingFrame{
+		tag: d.nextTag,
+		pts: pts,
+	})
+	if d.cfg.InputFragments {
+		if err := d.DecodeFragment(data); err != nil {
+			return err
+		}
+		err := d.decode(nil, d.nextTag)
+		d.freeFragments()
+		return err
+	}
+	return d.decode(data, d.nextTag)
+}
+
+// Flush signals the end of the stream, the frames still held by the decoder are then
+// available from NextFrame. On seek, flush and discard the returned frames before
+// decoding from the new position.
+func (d *Decoder) Flush() error {
+	if d.ctx == nil {
+		return ErrDecoderClosed
+	}
+	if d.cfg.InputFragments {
+		// a call with no data completes the frame in this mode, and
+		// the decoder holds no frames in between
+		return nil
+	}
+	return d.decode(nil, 0)
+}
+
+// DecodeFragment passes a partition of the frame to the decoder, the data is copied
+// and kept until EndFrame. For VP8 the partitions can be obtained with vp8.ParseFrame.
+func (d *Decoder) DecodeFragment(data []byte) error {
+	if d.ctx == nil {
+		return ErrDecoderClosed
+	}
+	if !d.cfg.InputFragments {
+		return ErrNotFragmentMode
+	}
+	if len(data) == 0 {
+		return ErrEmptyFragment
+	}
+	// libvpx keeps a pointer to each fragment until the frame is complete
+	buf := C.copy_fragment(unsafe.Pointer(&data[0]), C.size_t(len(data)))
+	if buf == nil {
+		return ErrCodecMemError
+	}
+	d.fragments = append(d.fragments, buf)
+	ret := C.decoder_decode((*C.vpx_codec_ctx_t)(unsafe.Pointer(d.ctx)), buf, C.uint(len(data)), 0)
+	err := NewOpError(d.ctx, d.iface, OpDecode, CodecErr(ret))
+	runtime.KeepAlive(d.h)
+	if err != nil {
+		d.freeFragments()
+		return err
+	}
+	return nil
+}
+
+// EndFrame completes a frame passed with DecodeFragment by calling the decoder with no
+// data, the decoded frames are then available from NextFrame.
+func (d *Decoder) EndFrame() error {
+	if d.ctx == nil {
+		return ErrDecoderClosed
+	}
+	if !d.cfg.InputFragments {
+		return ErrNotFragmentMode
+	}
+	err := d.decode(nil, 0)
+	d.freeFragments()
+	return err
+}
+
+func (d *Decoder) decode(data []byte, tag uintptr) error {
+	d.iter = nil
+	d.corrupted = false
+	var ptr unsafe.Pointer
+	if len(data) > 0 {
+		ptr = unsafe.Pointer(&data[0])
+	}
+	ret := C.decoder_decode((*C.vpx_codec_ctx_t)(unsafe.Pointer(d.ctx)), ptr, C.uint(len(data)), C.uintptr_t(tag))
+	if err := NewOpError(d.ctx, d.iface, OpDecode, CodecErr(ret)); err != nil {
+		runtime.KeepAlive(d.h)
+		return err
+	}
+	if v, ret := CodecControlGetInt(d.ctx, Vp8dGetFrameCorrupted); ret == CodecOk {
+		d.corrupted = v != 0
+	}
+	if tag != 0 && d.iface == DecoderIfaceVP9() {
+		// the frame just decoded is the last pending one
+		if w, h, ret := CodecControlGetSize(d.ctx, Vp9dGetDisplaySize); ret == CodecOk && w > 0 && h > 0 {
+			if p := &d.pending[len(d.pending)-1]; p.tag == tag {
+				p.displayW, p.displayH = uint32(w), uint32(h)
+			}
+		}
+	}
+	// the context is freed by the finalizer of the handle
+	runtime.KeepAlive(d.h)
+	return nil
+}
+
+// NextFrame returns the next frame produced by the last decode call or nil if there are no more.
+func (d *Decoder) NextFrame() *DecodedFrame {
+	if d.ctx == nil {
+		return nil
+	}
+	img := CodecGetFrame(d.ctx, &d.iter)
+	if img == nil {
+		return nil
+	}
+	img.Deref()
+	p := d.popPending(uintptr(C.image_tag(img.Ref())))
+	runtime.KeepAlive(d.h)
+	frame := &DecodedFrame{
+		Image:         img,
+		Pts:           p.pts,
+		Color:         img.ColorInfo(),
+		DisplayWidth:  img.DW,
+		DisplayHeight: img.DH,
+		Corrupted:     d.corrupted,
+	}
+	if p.displayW > 0 {
+		frame.DisplayWidth, frame.DisplayHeight = p.displayW, p.displayH
+	}
+	return frame
+}
+
+// popPending returns the pts and render size of the frame with the given tag. Frames
+// are returned in decoding order, so the entries before it belong to frames that were
+// never shown.
+func (d *Decoder) popPending(tag uintptr) pendingFrame {
+	for i, p := range d.pending {
+		if p.tag == tag {
+			d.pending = d.pending[i+1:]
+			return p
+		}
+	}
+	return pendingFrame{}
+}
+
+// Close destroys the decoder context. A decoder that is garbage collected
+// without being closed is destroyed by the finalizer of its context.
+func (d *Decoder) Close() error {
+	if d.ctx == nil {
+		return ErrDecoderClosed
+	}
+	d.freeFragments()
+	err := d.h.Close()
+	d.ctx = nil
+	return err
+}
+
+func (d *Decoder) freeFragments() {
+	for _, buf := range d.fragments {
+		C.free(buf)
+	}
+	d.fragments = d.fragments[:0]
+}
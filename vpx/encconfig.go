@@ -0,0 +1,402 @@
+package vpx
+
+import (
+	"errors"
+	"strconv"
+)
+
+// EncoderConfig is a plain Go mirror of CodecEncCfg that can be stored in configuration
+// files, the JSON and YAML keys are the C field names. The fixed size layer arrays are
+// slices holding the used entries and Controls are set after the encoder is initialized.
+// RcTwopassStatsIn and RcFirstpassMbStatsIn point to data produced while encoding and
+// are not part of it, see NewLastPassEncoder. To fill only some fields from a file,
+// decode the file into the value returned by NewEncoderConfig for the default
+// configuration of the interface.
+type EncoderConfig struct {
+	GUsage                  uint32       `json:"g_usage" yaml:"g_usage"`
+	GThreads                uint32       `json:"g_threads" yaml:"g_threads"`
+	GProfile                uint32       `json:"g_profile" yaml:"g_profile"`
+	GW                      uint32       `json:"g_w" yaml:"g_w"`
+	GH                      uint32       `json:"g_h" yaml:"g_h"`
+	GBitDepth               BitDepth     `json:"g_bit_depth" yaml:"g_bit_depth"`
+	GInputBitDepth          uint32       `json:"g_input_bit_depth" yaml:"g_input_bit_depth"`
+	GTimebase               Timebase     `json:"g_timebase" yaml:"g_timebase"`
+	GErrorResilient         CodecErFlags `json:"g_error_resilient" yaml:"g_error_resilient"`
+	GPass                   EncPass      `json:"g_pass" yaml:"g_pass"`
+	GLagInFrames            uint32       `json:"g_lag_in_frames" yaml:"g_lag_in_frames"`
+	RcDropframeThresh       uint32       `json:"rc_dropframe_thresh" yaml:"rc_dropframe_thresh"`
+	RcResizeAllowed         uint32       `json:"rc_resize_allowed" yaml:"rc_resize_allowed"`
+	RcScaledWidth           uint32       `json:"rc_scaled_width" yaml:"rc_scaled_width"`
+	RcScaledHeight          uint32       `json:"rc_scaled_height" yaml:"rc_scaled_height"`
+	RcResizeUpThresh        uint32       `json:"rc_resize_up_thresh" yaml:"rc_resize_up_thresh"`
+	RcResizeDownThresh      uint32       `json:"rc_resize_down_thresh" yaml:"rc_resize_down_thresh"`
+	RcEndUsage              RcMode       `json:"rc_end_usage" yaml:"rc_end_usage"`
+	RcTargetBitrate         uint32       `json:"rc_target_bitrate" yaml:"rc_target_bitrate"`
+	RcMinQuantizer          uint32       `json:"rc_min_quantizer" yaml:"rc_min_quantizer"`
+	RcMaxQuantizer          uint32       `json:"rc_max_quantizer" yaml:"rc_max_quantizer"`
+	RcUndershootPct         uint32       `json:"rc_undershoot_pct" yaml:"rc_undershoot_pct"`
+	RcOvershootPct          uint32       `json:"rc_overshoot_pct" yaml:"rc_overshoot_pct"`
+	RcBufSz                 uint32       `json:"rc_buf_sz" yaml:"rc_buf_sz"`
+	RcBufInitialSz          uint32       `json:"rc_buf_initial_sz" yaml:"rc_buf_initial_sz"`
+	RcBufOptimalSz          uint32       `json:"rc_buf_optimal_sz" yaml:"rc_buf_optimal_sz"`
+	Rc2passVbrBiasPct       uint32       `json:"rc_2pass_vbr_bias_pct" yaml:"rc_2pass_vbr_bias_pct"`
+	Rc2passVbrMinsectionPct uint32       `json:"rc_2pass_vbr_minsection_pct" yaml:"rc_2pass_vbr_minsection_pct"`
+	Rc2passVbrMaxsectionPct uint32       `json:"rc_2pass_vbr_maxsection_pct" yaml:"rc_2pass_vbr_maxsection_pct"`
+	KfMode                  KfMode       `json:"kf_mode" yaml:"kf_mode"`
+	KfMinDist               uint32       `json:"kf_min_dist" yaml:"kf_min_dist"`
+	KfMaxDist               uint32       `json:"kf_max_dist" yaml:"kf_max_dist"`
+	SsNumberLayers          uint32       `json:"ss_number_layers" yaml:"ss_number_layers"`
+	SsEnableAutoAltRef      []int32      `json:"ss_enable_auto_alt_ref,omitempty" yaml:"ss_enable_auto_alt_ref,omitempty"`
+	SsTargetBitrate         []uint32     `json:"ss_target_bitrate,omitempty" yaml:"ss_target_bitrate,omitempty"`
+	TsNumberLayers          uint32       `json:"ts_number_layers" yaml:"ts_number_layers"`
+	TsTargetBitrate         []uint32     `json:"ts_target_bitrate,omitempty" yaml:"ts_target_bitrate,omitempty"`
+	TsRateDecimator         []uint32     `json:"ts_rate_decimator,omitempty" yaml:"ts_rate_decimator,omitempty"`
+	TsPeriodicity           uint32       `json:"ts_periodicity" yaml:"ts_periodicity"`
+	TsLayerID               []uint32     `json:"ts_layer_id,omitempty" yaml:"ts_layer_id,omitempty"`
+	LayerTargetBitrate      []uint32     `json:"layer_target_bitrate,omitempty" yaml:"layer_target_bitrate,omitempty"`
+	TemporalLayeringMode    int32        `json:"temporal_layering_mode" yaml:"temporal_layering_mode"`
+
+	Controls []ControlSetting `json:"controls,omitempty" yaml:"controls,omitempty"`
+}
+
+// Timebase mirrors the GTimebase rational.
+type Timebase struct {
+	Num int32 `json:"num" yaml:"num"`
+	Den int32 `json:"den" yaml:"den"`
+}
+
+// NewEncoderConfig copies the fields of cfg, the controls are left empty.
+func NewEncoderConfig(cfg *CodecEncCfg) *EncoderConfig {
+	return &EncoderConfig{
+		GUsage:                  cfg.GUsage,
+		GThreads:                cfg.GThreads,
+		GProfile:                cfg.GProfile,
+		GW:                      cfg.GW,
+		GH:                      cfg.GH,
+		GBitDepth:               cfg.GBitDepth,
+		GInputBitDepth:          cfg.GInputBitDepth,
+		GTimebase:               Timebase{Num: cfg.GTimebase.Num, Den: cfg.GTimebase.Den},
+		GErrorResilient:         cfg.GErrorResilient,
+		GPass:                   cfg.GPass,
+		GLagInFrames:            cfg.GLagInFrames,
+		RcDropframeThresh:       cfg.RcDropframeThresh,
+		RcResizeAllowed:         cfg.RcResizeAllowed,
+		RcScaledWidth:           cfg.RcScaledWidth,
+		RcScaledHeight:          cfg.RcScaledHeight,
+		RcResizeUpThresh:        cfg.RcResizeUpThresh,
+		RcResizeDownThresh:      cfg.RcResizeDownThresh,
+		RcEndUsage:              cfg.RcEndUsage,
+		RcTargetBitrate:         cfg.RcTargetBitrate,
+		RcMinQuantizer:          cfg.RcMinQuantizer,
+		RcMaxQuantizer:          cfg.RcMaxQuantizer,
+		RcUndershootPct:         cfg.RcUndershootPct,
+		RcOvershootPct:          cfg.RcOvershootPct,
+		RcBufSz:                 cfg.RcBufSz,
+		RcBufInitialSz:          cfg.RcBufInitialSz,
+		RcBufOptimalSz:          cfg.RcBufOptimalSz,
+		Rc2passVbrBiasPct:       cfg.Rc2passVbrBiasPct,
+		Rc2passVbrMinsectionPct: cfg.Rc2passVbrMinsectionPct,
+		Rc2passVbrMaxsectionPct: cfg.Rc2passVbrMaxsectionPct,
+		KfMode:                  cfg.KfMode,
+		KfMinDist:               cfg.KfMinDist,
+		KfMaxDist:               cfg.KfMaxDist,
+		SsNumberLayers:          cfg.SsNumberLayers,
+		SsEnableAutoAltRef:      trimInt32s(cfg.SsEnableAutoAltRef[:]),
+		SsTargetBitrate:         trimUint32s(cfg.SsTargetBitrate[:]),
+		TsNumberLayers:          cfg.TsNumberLayers,
+		TsTargetBitrate:         trimUint32s(cfg.TsTargetBitrate[:]),
+		TsRateDecimator:         trimUint32s(cfg.TsRateDecimator[:]),
+		TsPeriodicity:           cfg.TsPeriodicity,
+		TsLayerID:               trimUint32s(cfg.TsLayerID[:]),
+		LayerTargetBitrate:      trimUint32s(cfg.LayerTargetBitrate[:]),
+		TemporalLayeringMode:    cfg.TemporalLayeringMode,
+	}
+}
+
+// EncoderConfig returns the configuration and the controls of the preset.
+func (p *EncoderPreset) EncoderConfig() *EncoderConfig {
+	c := NewEncoderConfig(&p.Config)
+	c.Controls = append([]ControlSetting(nil), p.Controls...)
+	return c
+}
+
+// EncCfg validates the configuration and returns it as a CodecEncCfg,
+// a plain Go value holding no C memory.
+func (c *EncoderConfig) EncCfg() (*CodecEncCfg, error) {
+	if err := c.Validate(); err != nil {
+		return nil, err
+	}
+	cfg := &CodecEncCfg{
+		GUsage:                  c.GUsage,
+		GThreads:                c.GThreads,
+		GProfile:                c.GProfile,
+		GW:                      c.GW,
+		GH:                      c.GH,
+		GBitDepth:               c.GBitDepth,
+		GInputBitDepth:          c.GInputBitDepth,
+		GTimebase:               Rational{Num: c.GTimebase.Num, Den: c.GTimebase.Den},
+		GErrorResilient:         c.GErrorResilient,
+		GPass:                   c.GPass,
+		GLagInFrames:            c.GLagInFrames,
+		RcDropframeThresh:       c.RcDropframeThresh,
+		RcResizeAllowed:         c.RcResizeAllowed,
+		RcScaledWidth:           c.RcScaledWidth,
+		RcScaledHeight:          c.RcScaledHeight,
+		RcResizeUpThresh:        c.RcResizeUpThresh,
+		RcResizeDownThresh:      c.RcResizeDownThresh,
+		RcEndUsage:              c.RcEndUsage,
+		RcTargetBitrate:         c.RcTargetBitrate,
+		RcMinQuantizer:          c.RcMinQuantizer,
+		RcMaxQuantizer:          c.RcMaxQuantizer,
+		RcUndershootPct:         c.RcUndershootPct,
+		RcOvershootPct:          c.RcOvershootPct,
+		RcBufSz:                 c.RcBufSz,
+		RcBufInitialSz:          c.RcBufInitialSz,
+		RcBufOptimalSz:          c.RcBufOptimalSz,
+		Rc2passVbrBiasPct:       c.Rc2passVbrBiasPct,
+		Rc2passVbrMinsectionPct: c.Rc2passVbrMinsectionPct,
+		Rc2passVbrMaxsectionPct: c.Rc2passVbrMaxsectionPct,
+		KfMode:                  c.KfMode,
+		KfMinDist:               c.KfMinDist,
+		KfMaxDist:               c.KfMaxDist,
+		SsNumberLayers:          c.SsNumberLayers,
+		TsNumberLayers:          c.TsNumberLayers,
+		TsPeriodicity:           c.TsPeriodicity,
+		TemporalLayeringMode:    c.TemporalLayeringMode,
+	}
+	copy(cfg.SsEnableAutoAltRef[:], c.SsEnableAutoAltRef)
+	copy(cfg.SsTargetBitrate[:], c.SsTargetBitrate)
+	copy(cfg.TsTargetBitrate[:], c.TsTargetBitrate)
+	copy(cfg.TsRateDecimator[:], c.TsRateDecimator)
+	copy(cfg.TsLayerID[:], c.TsLayerID)
+	copy(cfg.LayerTargetBitrate[:], c.LayerTargetBitrate)
+	return cfg, nil
+}
+
+// NewEncoder validates the configuration, initializes an encoder and sets the controls.
+func (c *EncoderConfig) NewEncoder(iface *CodecIface, flags CodecFlags) (*Encoder, error) {
+	cfg, err := c.EncCfg()
+	if err != nil {
+		return nil, err
+	}
+	enc, err := NewEncoder(iface, cfg, flags)
+	if err != nil {
+		return nil, err
+	}
+	if err := enc.setControls(c.Controls); err != nil {
+		enc.Close()
+		return nil, err
+	}
+	return enc, nil
+}
+
+// Validate checks the ranges of the fields and the constraints between them,
+// the first failure is returned as a *ConfigError naming the field.
+func (c *EncoderConfig) Validate() error {
+	switch {
+	case c.GW == 0:
+		return &ConfigError{"GW", "width must not be zero"}
+	case c.GH == 0:
+		return &ConfigError{"GH", "height must not be zero"}
+	case c.GTimebase.Num <= 0 || c.GTimebase.Den <= 0:
+		return &ConfigError{"GTimebase", "numerator and denominator must be positive"}
+	case c.GThreads > 64:
+		return &ConfigError{"GThreads", "must be at most 64"}
+	case c.GProfile > 3:
+		return &ConfigError{"GProfile", "must be at most 3"}
+	case c.GBitDepth != Bits8 && c.GBitDepth != Bits10 && c.GBitDepth != Bits12:
+		return &ConfigError{"GBitDepth", "must be 8, 10 or 12"}
+	case c.GProfile <= 1 && c.GBitDepth != Bits8:
+		return &ConfigError{"GBitDepth", "must be 8 with profile " + strconv.Itoa(int(c.GProfile))}
+	case c.GProfile >= 2 && c.GBitDepth == Bits8:
+		return &ConfigError{"GBitDepth", "must be 10 or 12 with profile " + strconv.Itoa(int(c.GProfile))}
+	case c.GInputBitDepth > uint32(c.GBitDepth):
+		return &ConfigError{"GInputBitDepth", "must not exceed GBitDepth"}
+	case c.GPass != RcOnePass && c.GPass != RcFirstPass && c.GPass != RcLastPass:
+		return &ConfigError{"GPass", "unknown pass " + strconv.Itoa(int(c.GPass))}
+	case c.RcEndUsage != Vbr && c.RcEndUsage != Cbr && c.RcEndUsage != Cq && c.RcEndUsage != Q:
+		return &ConfigError{"RcEndUsage", "unknown mode " + strconv.Itoa(int(c.RcEndUsage))}
+	case c.RcDropframeThresh > 100:
+		return &ConfigError{"RcDropframeThresh", "must be at most 100"}
+	case c.RcMaxQuantizer > 63:
+		return &ConfigError{"RcMaxQuantizer", "must be at most 63"}
+	case c.RcMinQuantizer > c.RcMaxQuantizer:
+		return &ConfigError{"RcMinQuantizer", "must not exceed RcMaxQuantizer"}
+	case c.KfMode != KfFixed && c.KfMode != KfAuto:
+		return &ConfigError{"KfMode", "unknown mode " + strconv.Itoa(int(c.KfMode))}
+	case c.KfMode == KfAuto && c.KfMinDist > c.KfMaxDist:
+		return &ConfigError{"KfMinDist", "must not exceed KfMaxDist"}
+	}
+	return c.validateLayers()
+}
+
+func (c *EncoderConfig) validateLayers() error {
+	ss, ts := c.SsNumberLayers, c.TsNumberLayers
+	if ss == 0 {
+		ss = 1
+	}
+	if ts == 0 {
+		ts = 1
+	}
+	switch {
+	case ss > SsMaxLayers:
+		return &ConfigError{"SsNumberLayers", "must be at most " + strconv.Itoa(SsMaxLayers)}
+	case ts > TsMaxLayers:
+		return &ConfigError{"TsNumberLayers", "must be at most " + strconv.Itoa(TsMaxLayers)}
+	case ss*ts > MaxLayers:
+		return &ConfigError{"SsNumberLayers", "spatial times temporal layers must be at most " + strconv.Itoa(MaxLayers)}
+	case len(c.SsEnableAutoAltRef) > SsMaxLayers:
+		return &ConfigError{"SsEnableAutoAltRef", "must have at most " + strconv.Itoa(SsMaxLayers) + " entries"}
+	case len(c.SsTargetBitrate) > SsMaxLayers:
+		return &ConfigError{"SsTargetBitrate", "must have at most " + strconv.Itoa(SsMaxLayers) + " entries"}
+	case len(c.TsTargetBitrate) > TsMaxLayers:
+		return &ConfigError{"TsTargetBitrate", "must have at most " + strconv.Itoa(TsMaxLayers) + " entries"}
+	case len(c.TsRateDecimator) > TsMaxLayers:
+		return &ConfigError{"TsRateDecimator", "must have at most " + strconv.Itoa(TsMaxLayers) + " entries"}
+	case len(c.TsLayerID) > TsMaxPeriodicity:
+		return &ConfigError{"TsLayerID", "must have at most " + strconv.Itoa(TsMaxPeriodicity) + " entries"}
+	case len(c.LayerTargetBitrate) > MaxLayers:
+		return &ConfigError{"LayerTargetBitrate", "must have at most " + strconv.Itoa(MaxLayers) + " entries"}
+	case c.TsPeriodicity > TsMaxPeriodicity:
+		return &ConfigError{"TsPeriodicity", "must be at most " + strconv.Itoa(TsMaxPeriodicity)}
+	}
+	if ts == 1 {
+		return nil
+	}
+	// the missing entries of the trimmed arrays are zero
+	if c.TsPeriodicity == 0 {
+		return &ConfigError{"TsPeriodicity", "must not be zero with temporal layers"}
+	}
+	for i := 0; i < int(c.TsPeriodicity) && i < len(c.TsLayerID); i++ {
+		if c.TsLayerID[i] >= ts {
+			return &ConfigError{"TsLayerID[" + strconv.Itoa(i) + "]", "must be lower than TsNumberLayers"}
+		}
+	}
+	for i := 0; i < int(ts); i++ {
+		idx := "[" + strconv.Itoa(i) + "]"
+		if i >= len(c.TsRateDecimator) || c.TsRateDecimator[i] == 0 {
+			return &ConfigError{"TsRateDecimator" + idx, "must not be zero with temporal layers"}
+		}
+		if i > 0 && i < len(c.TsTargetBitrate) && c.TsTargetBitrate[i] < c.TsTargetBitrate[i-1] {
+			return &ConfigError{"TsTargetBitrate" + idx, "layer bitrates are cumulative and must not decrease"}
+		}
+	}
+	return nil
+}
+
+// trimUint32s returns a copy of s without the trailing zeros, nil if all are zero.
+func trimUint32s(s []uint32) []uint32 {
+	n := len(s)
+	for n > 0 && s[n-1] == 0 {
+		n--
+	}
+	if n == 0 {
+		return nil
+	}
+	return append([]uint32(nil), s[:n]...)
+}
+
+// trimInt32s returns a copy of s without the trailing zeros, nil if all are zero.
+func trimInt32s(s []int32) []int32 {
+	n := len(s)
+	for n > 0 && s[n-1] == 0 {
+		n--
+	}
+	if n == 0 {
+		return nil
+	}
+	return append([]int32(nil), s[:n]...)
+}
+
+var (
+	encPassNames = map[EncPass]string{
+		RcOnePass:   "one-pass",
+		RcFirstPass: "first-pass",
+		RcLastPass:  "last-pass",
+	}
+	rcModeNames = map[RcMode]string{
+		Vbr: "vbr",
+		Cbr: "cbr",
+		Cq:  "cq",
+		Q:   "q",
+	}
+	// KfFixed and KfDisabled have the same value
+	kfModeNames = map[KfMode]string{
+		KfDisabled: "disabled",
+		KfAuto:     "auto",
+	}
+)
+
+// MarshalText encodes the pass as one-pass, first-pass or last-pass.
+func (p EncPass) MarshalText() ([]byte, error) {
+	return marshalEnum(encPassNames[p], int(p))
+}
+
+// UnmarshalText decodes a pass given by its name or number.
+func (p *EncPass) UnmarshalText(text []byte) error {
+	for v, name := range encPassNames {
+		if name == string(text) {
+			*p = v
+			return nil
+		}
+	}
+	v, err := unmarshalEnum("pass", text)
+	*p = EncPass(v)
+	return err
+}
+
+// MarshalText encodes the mode as vbr, cbr, cq or q.
+func (m RcMode) MarshalText() ([]byte, error) {
+	return marshalEnum(rcModeNames[m], int(m))
+}
+
+// UnmarshalText decodes a rate control mode given by its name or number.
+func (m *RcMode) UnmarshalText(text []byte) error {
+	for v, name := range rcModeNames {
+		if name == string(text) {
+			*m = v
+			return nil
+		}
+	}
+	v, err := unmarshalEnum("rate control mode", text)
+	*m = RcMode(v)
+	return err
+}
+
+// MarshalText encodes the mode as auto or disabled.
+func (m KfMode) MarshalText() ([]byte, error) {
+	return marshalEnum(kfModeNames[m], int(m))
+}
+
+// UnmarshalText decodes a keyframe mode given by its name or number, fixed is
+// accepted as a synonym of disabled.
+func (m *KfMode) UnmarshalText(text []byte) error {
+	if string(text) == "fixed" {
+		*m = KfFixed
+		return nil
+	}
+	for v, name := range kfModeNames {
+		if name == string(text) {
+			*m = v
+			return nil
+		}
+	}
+	v, err := unmarshalEnum("keyframe mode", text)
+	*m = KfMode(v)
+	return err
+}
+
+func marshalEnum(name string, v int) ([]byte, error) {
+	if name == "" {
+		return []byte(strconv.Itoa(v)), nil
+	}
+	return []byte(name), nil
+}
+
+func unmarshalEnum(kind string, text []byte) (int, error) {
+	v, err := strconv.Atoi(string(text))
+	if err != nil {
+		return 0, errors.New("vpx: unknown " + kind + " " + strconv.Quote(string(text)))
+	}
+	return v, nil
+}
@@ -0,0 +1,167 @@
+package vpx
+
+import (
+	"encoding/json"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// testEncCfg returns a valid configuration with two spatial and two temporal layers.
+func testEncCfg() *CodecEncCfg {
+	return &CodecEncCfg{
+		GUsage:                  1,
+		GThreads:                4,
+		GProfile:                2,
+		GW:                      1280,
+		GH:                      720,
+		GBitDepth:               Bits10,
+		GInputBitDepth:          10,
+		GTimebase:               Rational{Num: 1, Den: 30},
+		GErrorResilient:         1,
+		GPass:                   RcOnePass,
+		GLagInFrames:            0,
+		RcDropframeThresh:       30,
+		RcResizeAllowed:         1,
+		RcScaledWidth:           640,
+		RcScaledHeight:          360,
+		RcResizeUpThresh:        60,
+		RcResizeDownThresh:      30,
+		RcEndUsage:              Cbr,
+		RcTargetBitrate:         1200,
+		RcMinQuantizer:          4,
+		RcMaxQuantizer:          56,
+		RcUndershootPct:         50,
+		RcOvershootPct:          50,
+		RcBufSz:                 1000,
+		RcBufInitialSz:          500,
+		RcBufOptimalSz:          600,
+		Rc2passVbrBiasPct:       50,
+		Rc2passVbrMinsectionPct: 10,
+		Rc2passVbrMaxsectionPct: 400,
+		KfMode:                  KfAuto,
+		KfMinDist:               10,
+		KfMaxDist:               300,
+		SsNumberLayers:          2,
+		SsEnableAutoAltRef:      [SsMaxLayers]int32{1, 1},
+		SsTargetBitrate:         [SsMaxLayers]uint32{400, 1200},
+		TsNumberLayers:          2,
+		TsTargetBitrate:         [TsMaxLayers]uint32{600, 1200},
+		TsRateDecimator:         [TsMaxLayers]uint32{2, 1},
+		TsPeriodicity:           2,
+		TsLayerID:               [TsMaxPeriodicity]uint32{0, 1},
+		LayerTargetBitrate:      [MaxLayers]uint32{200, 400, 600, 1200},
+		TemporalLayeringMode:    2,
+	}
+}
+
+func TestEncoderConfigJSONRoundTrip(t *testing.T) {
+	cfg := testEncCfg()
+	c := NewEncoderConfig(cfg)
+	c.Controls = []ControlSetting{
+		{ID: Vp8eSetCpuused, Value: 8},
+		{ID: Vp9eSetTileColumns, Value: 2, Optional: true},
+	}
+	data, err := json.Marshal(c)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, s := range []string{
+		`"g_pass":"one-pass"`,
+		`"rc_end_usage":"cbr"`,
+		`"kf_mode":"auto"`,
+		`"ts_layer_id":[0,1]`,
+		`"id":"VP8E_SET_CPUUSED"`,
+		`"id":"VP9E_SET_TILE_COLUMNS"`,
+	} {
+		if !strings.Contains(string(data), s) {
+			t.Errorf("%s not in %s", s, data)
+		}
+	}
+	var got EncoderConfig
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(&got, c) {
+		t.Errorf("decoded %+v, want %+v", got, *c)
+	}
+	out, err := got.EncCfg()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changed := changedFields(cfg, out); len(changed) != 0 {
+		t.Errorf("fields %v differ after the round trip", changed)
+	}
+}
+
+func TestEncoderConfigDefaults(t *testing.T) {
+	c := NewEncoderConfig(testEncCfg())
+	// the fields missing from the file keep their value
+	if err := json.Unmarshal([]byte(`{"g_w":640,"rc_end_usage":"vbr","g_pass":"last-pass"}`), c); err != nil {
+		t.Fatal(err)
+	}
+	if c.GW != 640 || c.GH != 720 || c.RcEndUsage != Vbr || c.GPass != RcLastPass || len(c.TsLayerID) != 2 {
+		t.Errorf("config %+v", *c)
+	}
+	if err := json.Unmarshal([]byte(`{"kf_mode":"sometimes"}`), c); err == nil {
+		t.Error("unknown keyframe mode decoded")
+	}
+}
+
+func TestEncoderConfigValidate(t *testing.T) {
+	tests := []struct {
+		field  string
+		modify func(c *EncoderConfig)
+	}{
+		{"GW", func(c *EncoderConfig) { c.GW = 0 }},
+		{"GH", func(c *EncoderConfig) { c.GH = 0 }},
+		{"GTimebase", func(c *EncoderConfig) { c.GTimebase.Den = 0 }},
+		{"GTimebase", func(c *EncoderConfig) { c.GTimebase.Num = -1 }},
+		{"GThreads", func(c *EncoderConfig) { c.GThreads = 65 }},
+		{"GProfile", func(c *EncoderConfig) { c.GProfile = 4 }},
+		{"GBitDepth", func(c *EncoderConfig) { c.GBitDepth = 9 }},
+		{"GBitDepth", func(c *EncoderConfig) { c.GProfile = 1 }},
+		{"GBitDepth", func(c *EncoderConfig) { c.GBitDepth, c.GInputBitDepth = Bits8, 8 }},
+		{"GInputBitDepth", func(c *EncoderConfig) { c.GInputBitDepth = 12 }},
+		{"GPass", func(c *EncoderConfig) { c.GPass = 3 }},
+		{"RcEndUsage", func(c *EncoderConfig) { c.RcEndUsage = 4 }},
+		{"RcDropframeThresh", func(c *EncoderConfig) { c.RcDropframeThresh = 101 }},
+		{"RcMaxQuantizer", func(c *EncoderConfig) { c.RcMaxQuantizer = 64 }},
+		{"RcMinQuantizer", func(c *EncoderConfig) { c.RcMinQuantizer = 57 }},
+		{"KfMode", func(c *EncoderConfig) { c.KfMode = 2 }},
+		{"KfMinDist", func(c *EncoderConfig) { c.KfMinDist = 301 }},
+		{"SsNumberLayers", func(c *EncoderConfig) { c.SsNumberLayers = SsMaxLayers + 1 }},
+		{"TsNumberLayers", func(c *EncoderConfig) { c.TsNumberLayers = TsMaxLayers + 1 }},
+		{"SsNumberLayers", func(c *EncoderConfig) { c.SsNumberLayers, c.TsNumberLayers = 3, 5 }},
+		{"SsEnableAutoAltRef", func(c *EncoderConfig) { c.SsEnableAutoAltRef = make([]int32, SsMaxLayers+1) }},
+		{"SsTargetBitrate", func(c *EncoderConfig) { c.SsTargetBitrate = make([]uint32, SsMaxLayers+1) }},
+		{"TsTargetBitrate", func(c *EncoderConfig) { c.TsTargetBitrate = make([]uint32, TsMaxLayers+1) }},
+		{"TsRateDecimator", func(c *EncoderConfig) { c.TsRateDecimator = make([]uint32, TsMaxLayers+1) }},
+		{"TsLayerID", func(c *EncoderConfig) { c.TsLayerID = make([]uint32, TsMaxPeriodicity+1) }},
+		{"LayerTargetBitrate", func(c *EncoderConfig) { c.LayerTargetBitrate = make([]uint32, MaxLayers+1) }},
+		{"TsPeriodicity", func(c *EncoderConfig) { c.TsPeriodicity = TsMaxPeriodicity + 1 }},
+		{"TsPeriodicity", func(c *EncoderConfig) { c.TsPeriodicity = 0 }},
+		{"TsLayerID[1]", func(c *EncoderConfig) { c.TsLayerID[1] = 2 }},
+		{"TsRateDecimator[1]", func(c *EncoderConfig) { c.TsRateDecimator = c.TsRateDecimator[:1] }},
+		{"TsTargetBitrate[1]", func(c *EncoderConfig) { c.TsTargetBitrate[1] = 500 }},
+	}
+	if err := NewEncoderConfig(testEncCfg()).Validate(); err != nil {
+		t.Fatalf("valid configuration: %v", err)
+	}
+	for i, tt := range tests {
+		c := NewEncoderConfig(testEncCfg())
+		tt.modify(c)
+		err := c.Validate()
+		ce, ok := err.(*ConfigError)
+		if !ok {
+			t.Errorf("%d %s: error %v, want a *ConfigError", i, tt.field, err)
+			continue
+		}
+		if ce.Field != tt.field {
+			t.Errorf("%d %s: field %s (%v)", i, tt.field, ce.Field, err)
+		}
+		if _, err := c.EncCfg(); err == nil || err.Error() != ce.Error() {
+			t.Errorf("%d %s: EncCfg error %v", i, tt.field, err)
+		}
+	}
+}
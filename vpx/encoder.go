@@ -0,0 +1,420 @@
+package vpx
+
+/*
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"errors"
+	"runtime"
+	"unsafe"
+)
+
+var (
+	ErrEncoderClosed   = errors.New("vpx: encoder is closed")
+	ErrNoEncoderIface  = errors.New("vpx: no encoder interface")
+	ErrNoImage         = errors.New("vpx: no image to encode")
+	ErrIfaceNotEncoder = errors.New("vpx: interface is not an encoder")
+	ErrNoEncoderConfig = errors.New("vpx: no encoder configuration")
+	ErrNoStats         = errors.New("vpx: no first pass statistics")
+)
+
+// EncConfigDefault returns the default encoder configuration of the interface
+// as a plain Go value, it holds no C memory and can be freely copied.
+func EncConfigDefault(iface *CodecIface) (*CodecEncCfg, error) {
+	if iface == nil {
+		return nil, ErrNoEncoderIface
+	}
+	ccfg := &CodecEncCfg{}
+	defer ccfg.Free()
+	if err := NewOpError(nil, iface, OpConfig, CodecEncConfigDefault(iface, ccfg, 0)); err != nil {
+		return nil, err
+	}
+	cfg := *ccfg
+	cfg.detach()
+	return &cfg, nil
+}
+
+// detach reads the values of the referenced C configuration and drops the
+// reference, so neither the struct nor the nested ones point into C memory.
+func (x *CodecEncCfg) detach() {
+	if x.ref37e25db9 == nil {
+		return
+	}
+	x.Deref()
+	x.GTimebase.Deref()
+	x.GTimebase.ref48ce5779 = nil
+	x.RcTwopassStatsIn.Deref()
+	x.RcTwopassStatsIn.refeac28dc0 = nil
+	x.RcFirstpassMbStatsIn.Deref()
+	x.RcFirstpassMbStatsIn.refeac28dc0 = nil
+	x.ref37e25db9 = nil
+	x.allocs37e25db9 = nil
+}
+
+// Encoder wraps an encoder context with the encode and get packet loop.
+type Encoder struct {
+	// Deadline is the time in microseconds the encoder may spend on a frame,
+	// passed to CodecEncode, see DlRealtime and DlGoodQuality.
+	Deadline uint
+
+	h     *Context
+	ctx   *CodecCtx
+	iface *CodecIface
+	cfg   CodecEncCfg
+	flags CodecFlags
+
+	// size the context was initialized with
+	initW, initH uint32
+	// forceKeyframe is set when a live size change requires a keyframe
+	forceKeyframe bool
+
+	// controls applied to the context in order, replayed on re-initialization
+	controls []ControlSetting
+	// scale mode and render size, set when the controls were applied
+	scaleH, scaleV   ScalingMode
+	scaleSet         bool
+	renderW, renderH int32
+
+	// metadata of the frames waiting for output, in input order
+	pending []pendingMeta
+
+	// first pass statistics output so far
+	stats []byte
+	// statsIn is the C copy of the statistics read by the last pass,
+	// referenced by cfg and freed on Close
+	statsIn unsafe.Pointer
+}
+
+// EncodedFrame is a compressed frame returned by the encoder.
+type EncodedFrame struct {
+	// CodecCxFrame holds a copy of the data, it stays valid after the next encode call.
+	*CodecCxFrame
+	// Meta is the value passed to EncodeMeta along with the source image of the frame.
+	Meta interface{}
+	// HasSource is false for frames that do not correspond to an input image,
+	// i.e. invisible alt-ref frames, their Meta is always nil.
+	HasSource bool
+}
+
+// maxPendingMeta bounds the number of frames waiting for output.
+const maxPendingMeta = 256
+
+type pendingMeta struct {
+	pts  CodecPts
+	meta interface{}
+}
+
+// NewEncoder initializes an encoder with the given interface and configuration,
+// see EncoderIfaceVP8, EncoderIfaceVP9 and EncConfigDefault. The deadline is DlRealtime.
+func NewEncoder(iface *CodecIface, cfg *CodecEncCfg, flags CodecFlags) (*Encoder, error) {
+	if iface == nil {
+		return nil, ErrNoEncoderIface
+	}
+	if !Capabilities(iface).Encoder {
+		return nil, ErrIfaceNotEncoder
+	}
+	if cfg == nil {
+		return nil, ErrNoEncoderConfig
+	}
+	e := &Encoder{
+		Deadline: DlRealtime,
+		iface:    iface,
+		cfg:      *cfg,
+		flags:    flags,
+	}
+	e.cfg.detach()
+	if err := e.init(); err != nil {
+		return nil, err
+	}
+	return e, nil
+}
+
+// NewLastPassEncoder initializes the encoder of the last pass of two pass encoding with
+// the statistics returned by Stats after the first pass, which used the same interface
+// and configuration with GPass set to RcFirstPass. The statistics are copied to C memory
+// held until the encoder is closed, GPass and RcTwopassStatsIn are set accordingly.
+func NewLastPassEncoder(iface *CodecIface, cfg *CodecEncCfg, flags CodecFlags, stats []byte) (*Encoder, error) {
+	if cfg == nil {
+		return nil, ErrNoEncoderConfig
+	}
+	if len(stats) == 0 {
+		return nil, ErrNoStats
+	}
+	last := *cfg
+	last.detach()
+	statsIn := C.CBytes(stats)
+	last.GPass = RcLastPass
+	last.RcTwopassStatsIn = FixedBuf{
+		Buf: statsIn,
+		Sz:  uint(len(stats)),
+	}
+	e, err := NewEncoder(iface, &last, flags)
+	if err != nil {
+		C.free(statsIn)
+		return nil, err
+	}
+	e.statsIn = statsIn
+	return e, nil
+}
+
+// init initializes a new context and applies the controls set so far, the
+// encoder is left unchanged on failure.
+func (e *Encoder) init() error {
+	h := NewContext()
+	// the encoder keeps its own copy of the configuration
+	cfg := e.cfg
+	defer cfg.Free()
+	if err := h.InitEncoder(e.iface, &cfg, e.flags); err != nil {
+		h.Close()
+		return err
+	}
+	ctx, _ := h.Ctx()
+	if err := e.replayControls(ctx); err != nil {
+		h.Close()
+		return err
+	}
+	e.h = h
+	e.ctx = ctx
+	e.initW, e.initH = e.cfg.GW, e.cfg.GH
+	return nil
+}
+
+// replayControls applies the recorded controls to a new context.
+func (e *Encoder) replayControls(ctx *CodecCtx) error {
+	for _, c := range e.controls {
+		if err := NewControlError(ctx, e.iface, c.ID, CodecControlInt(ctx, c.ID, c.Value)); err != nil {
+			return err
+		}
+	}
+	if e.scaleSet {
+		ret := CodecControlScaleMode(ctx, e.scaleH, e.scaleV)
+		if err := NewControlError(ctx, e.iface, Vp8eSetScalemode, ret); err != nil {
+			return err
+		}
+	}
+	if e.renderW > 0 && e.renderH > 0 {
+		ret := CodecControlSize(ctx, Vp9eSetRenderSize, e.renderW, e.renderH)
+		if err := NewControlError(ctx, e.iface, Vp9eSetRenderSize, ret); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// recordControl remembers the last value of a control, moving it to the end
+// so the replay keeps the order the values were applied in.
+func (e *Encoder) recordControl(id ControlID, v int32) {
+	controls := e.controls[:0:0]
+	for _, c := range e.controls {
+		if c.ID != id {
+			controls = append(controls, c)
+		}
+	}
+	e.controls = append(controls, ControlSetting{
+		ID:    id,
+		Value: v,
+	})
+}
+
+// Config returns the configuration the encoder runs with.
+func (e *Encoder) Config() CodecEncCfg {
+	return e.cfg
+}
+
+// Ctx returns the underlying codec context, e.g. to call controls. Controls called
+// directly on the context are lost when Reconfigure re-initializes the encoder,
+// the ones set through the Encoder methods are applied again.
+func (e *Encoder) Ctx() *CodecCtx {
+	return e.ctx
+}
+
+// Iface returns the interface of the encoder.
+func (e *Encoder) Iface() *CodecIface {
+	return e.iface
+}
+
+// SetControl calls an encoder control that takes an int argument.
+// The error matches ErrControlUnsupported if the installed libvpx does not have the control.
+func (e *Encoder) SetControl(id ControlID, v int32) error {
+	if e.ctx == nil {
+		return ErrEncoderClosed
+	}
+	err := NewControlError(e.ctx, e.iface, id, CodecControlInt(e.ctx, id, v))
+	runtime.KeepAlive(e.h)
+	if err != nil {
+		return err
+	}
+	e.recordControl(id, v)
+	return nil
+}
+
+// GetControl calls an encoder control that returns an int, such as Vp9eGetLevel.
+func (e *Encoder) GetControl(id ControlID) (int32, error) {
+	if e.ctx == nil {
+		return 0, ErrEncoderClosed
+	}
+	v, ret := CodecControlGetInt(e.ctx, id)
+	err := NewControlError(e.ctx, e.iface, id, ret)
+	runtime.KeepAlive(e.h)
+	if err != nil {
+		return 0, err
+	}
+	return v, nil
+}
+
+// SetScaleMode sets the internal scaling of the encoder, see CodecControlScaleMode.
+func (e *Encoder) SetScaleMode(h, v ScalingMode) error {
+	if e.ctx == nil {
+		return ErrEncoderClosed
+	}
+	err := NewControlError(e.ctx, e.iface, Vp8eSetScalemode, CodecControlScaleMode(e.ctx, h, v))
+	runtime.KeepAlive(e.h)
+	if err != nil {
+		return err
+	}
+	e.scaleH, e.scaleV, e.scaleSet = h, v, true
+	return nil
+}
+
+// SetRenderSize makes the VP9 encoder signal a display size other than the coded
+// size, e.g. to have anamorphic frames stretched by the player.
+func (e *Encoder) SetRenderSize(w, h int32) error {
+	if e.ctx == nil {
+		return ErrEncoderClosed
+	}
+	err := NewControlError(e.ctx, e.iface, Vp9eSetRenderSize, CodecControlSize(e.ctx, Vp9eSetRenderSize, w, h))
+	runtime.KeepAlive(e.h)
+	if err != nil {
+		return err
+	}
+	e.renderW, e.renderH = w, h
+	return nil
+}
+
+// Stats returns a copy of the statistics output so far by a first pass encoder, the
+// whole statistics are complete after Flush. See NewLastPassEncoder.
+func (e *Encoder) Stats() []byte {
+	return append([]byte(nil), e.stats...)
+}
+
+// Encode encodes an image allocated by libvpx (see AllocImage) and returns the
+// compressed frames it produced, if any. With lagged encoding the frames belong to
+// images passed earlier.
+func (e *Encoder) Encode(img *Image, pts CodecPts, duration uint, flags EncFrameFlags) ([]*EncodedFrame, error) {
+	return e.EncodeMeta(img, pts, duration, flags, nil)
+}
+
+// EncodeMeta encodes an image like Encode, the meta value is returned with the frame
+// produced from the image even if the output is delayed by lagged encoding. Frames are
+// matched by pts, so it must increase with every image.
+func (e *Encoder) EncodeMeta(img *Image, pts CodecPts, duration uint, flags EncFrameFlags, meta interface{}) ([]*EncodedFrame, error) {
+	if e.ctx == nil {
+		return nil, ErrEncoderClosed
+	}
+	if img == nil {
+		return nil, ErrNoImage
+	}
+	if len(e.pending) >= maxPendingMeta {
+		// images dropped by the rate control never come out
+		e.pending = e.pending[1:]
+	}
+	e.pending = append(e.pending, pendingMeta{
+		pts:  pts,
+		meta: meta,
+	})
+	if e.forceKeyframe {
+		flags |= EflagForceKf
+		e.forceKeyframe = false
+	}
+	frames, _, err := e.encode(img, pts, duration, flags)
+	return frames, err
+}
+
+// Flush signals the end of the stream and returns the frames held back by lagged encoding.
+func (e *Encoder) Flush() ([]*EncodedFrame, error) {
+	if e.ctx == nil {
+		return nil, ErrEncoderClosed
+	}
+	var frames []*EncodedFrame
+	for {
+		// a first pass encoder outputs statistics only
+		out, packets, err := e.encode(nil, 0, 0, 0)
+		frames = append(frames, out...)
+		if err != nil || packets == 0 {
+			return frames, err
+		}
+	}
+}
+
+// encode returns the frames output by the encoder and the number of packets of any kind,
+// the statistics packets are appended to the stats.
+func (e *Encoder) encode(img *Image, pts CodecPts, duration uint, flags EncFrameFlags) ([]*EncodedFrame, int, error) {
+	ret := CodecEncode(e.ctx, img, pts, duration, flags, e.Deadline)
+	if err := NewOpError(e.ctx, e.iface, OpEncode, ret); err != nil {
+		runtime.KeepAlive(e.h)
+		return nil, 0, err
+	}
+	var frames []*EncodedFrame
+	var packets int
+	var iter CodecIter
+	for pkt := CodecGetCxData(e.ctx, &iter); pkt != nil; pkt = CodecGetCxData(e.ctx, &iter) {
+		packets++
+		if stats := pkt.Stats(); stats != nil {
+			e.stats = append(e.stats, stats...)
+			continue
+		}
+		frame := pkt.Frame()
+		if frame == nil {
+			continue
+		}
+		// the buffer is reused by the next encode call
+		frame.Buf = append([]byte(nil), frame.Buf...)
+		frames = append(frames, e.match(frame))
+	}
+	runtime.KeepAlive(e.h)
+	return frames, packets, nil
+}
+
+// match attaches the metadata of the source image to a frame. Invisible frames are
+// built from future images and have no source, the entries before the matching one
+// belong to images dropped by the rate control.
+func (e *Encoder) match(frame *CodecCxFrame) *EncodedFrame {
+	out := &EncodedFrame{
+		CodecCxFrame: frame,
+	}
+	if frame.IsInvisible() {
+		return out
+	}
+	for i, p := range e.pending {
+		if p.pts != frame.Pts {
+			continue
+		}
+		out.Meta = p.meta
+		out.HasSource = true
+		if frame.IsFragment() {
+			// more partitions of the same frame follow
+			e.pending = e.pending[i:]
+		} else {
+			e.pending = e.pending[i+1:]
+		}
+		break
+	}
+	return out
+}
+
+// Close destroys the encoder context. Frames held back by lagged encoding
+// are lost, call Flush first to get them.
+func (e *Encoder) Close() error {
+	if e.ctx == nil {
+		return ErrEncoderClosed
+	}
+	err := e.h.Close()
+	e.h, e.ctx = nil, nil
+	if e.statsIn != nil {
+		C.free(e.statsIn)
+		e.statsIn = nil
+	}
+	return err
+}
@@ -1,6 +1,15 @@
 package vpx
 
-import "errors"
+/*
+#cgo pkg-config: vpx
+#include <vpx/vpx_codec.h>
+*/
+import "C"
+
+import (
+	"errors"
+	"unsafe"
+)
 
 func Error(err CodecErr) error {
 	switch err {
@@ -22,6 +31,8 @@ func Error(err CodecErr) error {
 		return ErrCodecCorruptFrame
 	case CodecInvalidParam:
 		return ErrCodecInvalidParam
+	case CodecListEnd:
+		return ErrCodecListEnd
 	default:
 		return ErrCodecUnknownError
 	}
@@ -36,4 +47,99 @@ var (
 	ErrCodecUnsupFeature   = errors.New("vpx: unsupported feature")
 	ErrCodecCorruptFrame   = errors.New("vpx: corrupt frame")
 	ErrCodecInvalidParam   = errors.New("vpx: invalid param")
+	ErrCodecListEnd        = errors.New("vpx: list end")
+
+	ErrControlUnsupported = errors.New("vpx: control is not supported by the installed libvpx")
 )
+
+// Operations reported by OpError.
+const (
+	OpInit    = "init"
+	OpConfig  = "config"
+	OpDecode  = "decode"
+	OpEncode  = "encode"
+	OpControl = "control"
+	OpDestroy = "destroy"
+)
+
+// OpError is a libvpx error along with the operation and the context it happened in.
+// It unwraps to the ErrCodec* sentinel of its code, so errors.Is keeps working.
+type OpError struct {
+	Code CodecErr
+	// Op is the failed operation, one of the Op* constants.
+	Op string
+	// Control is the control that failed when Op is OpControl.
+	Control ControlID
+	// Iface is the name of the codec interface.
+	Iface string
+	// Message is the error string of the context (vpx_codec_error).
+	Message string
+	// Detail is the detailed error string of the context (vpx_codec_error_detail), if any.
+	Detail string
+}
+
+// NewOpError returns an *OpError for an operation that failed on ctx with code,
+// or nil if code is CodecOk. The ctx may be nil for operations without a context.
+func NewOpError(ctx *CodecCtx, iface *CodecIface, op string, code CodecErr) error {
+	return opError(ctx, iface, op, 0, code)
+}
+
+// NewControlError is NewOpError for a control that failed on ctx with code, the
+// *OpError has Op set to OpControl and records the control.
+func NewControlError(ctx *CodecCtx, iface *CodecIface, id ControlID, code CodecErr) error {
+	return opError(ctx, iface, OpControl, id, code)
+}
+
+func opError(ctx *CodecCtx, iface *CodecIface, op string, id ControlID, code CodecErr) error {
+	if code == CodecOk {
+		return nil
+	}
+	e := &OpError{
+		Code:    code,
+		Op:      op,
+		Control: id,
+	}
+	if iface != nil {
+		e.Iface = CodecIfaceName(iface)
+	}
+	if op == OpControl && !id.Supported() {
+		e.Message = "not declared by the libvpx headers the package was built with"
+		return e
+	}
+	if ctx != nil {
+		cctx := (*C.vpx_codec_ctx_t)(unsafe.Pointer(ctx))
+		e.Message = C.GoString(C.vpx_codec_error(cctx))
+		// after a failed init the detail may point into freed codec memory
+		if op != OpInit {
+			e.Detail = C.GoString(C.vpx_codec_error_detail(cctx))
+		}
+	} else {
+		e.Message = C.GoString(C.vpx_codec_err_to_string(C.vpx_codec_err_t(code)))
+	}
+	return e
+}
+
+func (e *OpError) Error() string {
+	msg := "vpx: " + e.Op
+	if e.Op == OpControl {
+		msg += " " + e.Control.String()
+	}
+	if e.Iface != "" {
+		msg += " (" + e.Iface + ")"
+	}
+	msg += ": " + e.Message
+	if e.Detail != "" {
+		msg += ": " + e.Detail
+	}
+	return msg
+}
+
+// Unwrap returns the sentinel error of the code.
+func (e *OpError) Unwrap() error {
+	return Error(e.Code)
+}
+
+// Is reports whether a failed control is missing from the installed libvpx.
+func (e *OpError) Is(target error) bool {
+	return target == ErrControlUnsupported && e.Op == OpControl && !e.Control.Supported()
+}
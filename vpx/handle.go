@@ -0,0 +1,297 @@
+package vpx
+
+/*
+#cgo pkg-config: vpx
+#include <vpx/vpx_codec.h>
+#include <stdlib.h>
+*/
+import "C"
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"runtime"
+	"sort"
+	"sync"
+	"unsafe"
+)
+
+var (
+	ErrHandleClosed      = errors.New("vpx: use of closed handle")
+	ErrHandleDoubleClose = errors.New("vpx: handle closed twice")
+	ErrContextInited     = errors.New("vpx: context is already initialized")
+	ErrContextNotInited  = errors.New("vpx: context is not initialized")
+)
+
+// Context owns a C-allocated codec context. The context is destroyed and freed by
+// Close, a finalizer does the same if the Context becomes unreachable while open.
+// The interfaces returned by DecoderIfaceVP8 and friends are static and need no freeing.
+type Context struct {
+	ctx    *CodecCtx
+	iface  *CodecIface
+	inited bool
+	track  *tracked
+}
+
+// NewContext allocates a codec context, initialize it with InitDecoder or InitEncoder.
+func NewContext() *Context {
+	c := &Context{
+		ctx:   NewCodecCtx(),
+		track: trackAlloc("context"),
+	}
+	runtime.SetFinalizer(c, (*Context).finalize)
+	return c
+}
+
+// InitDecoder initializes the context as a decoder, the configuration may be nil.
+func (c *Context) InitDecoder(iface *CodecIface, cfg *CodecDecCfg, flags CodecFlags) error {
+	if c.ctx == nil {
+		return ErrHandleClosed
+	}
+	if c.inited {
+		return ErrContextInited
+	}
+	ret := CodecDecInitVer(c.ctx, iface, cfg, flags, DecoderABIVersion)
+	if err := NewOpError(c.ctx, iface, OpInit, ret); err != nil {
+		return err
+	}
+	c.iface = iface
+	c.inited = true
+	return nil
+}
+
+// InitEncoder initializes the context as an encoder, the encoder keeps its own copy of the configuration.
+func (c *Context) InitEncoder(iface *CodecIface, cfg *CodecEncCfg, flags CodecFlags) error {
+	if c.ctx == nil {
+		return ErrHandleClosed
+	}
+	if c.inited {
+		return ErrContextInited
+	}
+	ret := CodecEncInitVer(c.ctx, iface, cfg, flags, EncoderABIVersion)
+	if err := NewOpError(c.ctx, iface, OpInit, ret); err != nil {
+		return err
+	}
+	c.iface = iface
+	c.inited = true
+	return nil
+}
+
+// Ctx returns the underlying codec context or ErrHandleClosed after Close.
+func (c *Context) Ctx() (*CodecCtx, error) {
+	if c.ctx == nil {
+		return nil, ErrHandleClosed
+	}
+	if !c.inited {
+		return nil, ErrContextNotInited
+	}
+	return c.ctx, nil
+}
+
+// Iface returns the interface the context was initialized with.
+func (c *Context) Iface() *CodecIface {
+	return c.iface
+}
+
+// Close destroys the codec if it was initialized and frees the context.
+// Closing it again returns ErrHandleDoubleClose.
+func (c *Context) Close() error {
+	if c.ctx == nil {
+		return ErrHandleDoubleClose
+	}
+	err := c.release()
+	trackFree(c.track)
+	runtime.SetFinalizer(c, nil)
+	return err
+}
+
+func (c *Context) release() error {
+	var err error
+	if c.inited {
+		err = NewOpError(c.ctx, c.iface, OpDestroy, CodecDestroy(c.ctx))
+	}
+	C.free(unsafe.Pointer(c.ctx))
+	c.ctx = nil
+	c.inited = false
+	return err
+}
+
+func (c *Context) finalize() {
+	if c.ctx == nil {
+		return
+	}
+	trackLeak(c.track)
+	c.release()
+}
+
+// ImageBuffer owns an image allocated by libvpx. The image is freed by Close,
+// a finalizer does the same if the ImageBuffer becomes unreachable while open.
+type ImageBuffer struct {
+	img   *Image
+	track *tracked
+}
+
+// AllocImage allocates an image with the given format and size, see ImageAlloc.
+func AllocImage(fmt ImageFormat, w, h, align uint32) (*ImageBuffer, error) {
+	img := ImageAlloc(nil, fmt, w, h, align)
+	if img == nil {
+		return nil, ErrCodecMemError
+	}
+	img.Deref()
+	b := &ImageBuffer{
+		img:   img,
+		track: trackAlloc("image"),
+	}
+	runtime.SetFinalizer(b, (*ImageBuffer).finalize)
+	return b, nil
+}
+
+// Image returns the image or ErrHandleClosed after Close.
+func (b *ImageBuffer) Image() (*Image, error) {
+	if b.img == nil {
+		return nil, ErrHandleClosed
+	}
+	return b.img, nil
+}
+
+// Close frees the image. Closing it again returns ErrHandleDoubleClose.
+func (b *ImageBuffer) Close() error {
+	if b.img == nil {
+		return ErrHandleDoubleClose
+	}
+	b.release()
+	trackFree(b.track)
+	runtime.SetFinalizer(b, nil)
+	return nil
+}
+
+func (b *ImageBuffer) release() {
+	ImageFree(b.img)
+	b.img = nil
+}
+
+func (b *ImageBuffer) finalize() {
+	if b.img == nil {
+		return
+	}
+	trackLeak(b.track)
+	b.release()
+}
+
+// Leak describes a handle, as reported by the leak tracking debug mode.
+type Leak struct {
+	// Kind is either "context" or "image".
+	Kind string
+	// Stack is the stack trace of the allocation.
+	Stack string
+}
+
+type tracked struct {
+	id   uint64
+	leak Leak
+}
+
+var leakDebug = struct {
+	sync.Mutex
+	enabled bool
+	nextID  uint64
+	open    map[uint64]*tracked
+	leaked  []Leak
+}{
+	enabled: os.Getenv("VPX_DEBUG_LEAKS") != "",
+	open:    make(map[uint64]*tracked),
+}
+
+// SetLeakTracking enables recording the allocation stack of every Context and ImageBuffer,
+// so the ones never closed can be reported. It can also be enabled by setting the
+// VPX_DEBUG_LEAKS environment variable. Only handles allocated while enabled are tracked.
+func SetLeakTracking(enabled bool) {
+	leakDebug.Lock()
+	leakDebug.enabled = enabled
+	leakDebug.Unlock()
+}
+
+// Leaks returns the handles that were garbage collected without being closed.
+func Leaks() []Leak {
+	leakDebug.Lock()
+	defer leakDebug.Unlock()
+	return append([]Leak(nil), leakDebug.leaked...)
+}
+
+// OpenHandles returns the tracked handles that are still open, in allocation order.
+func OpenHandles() []Leak {
+	leakDebug.Lock()
+	defer leakDebug.Unlock()
+	open := make([]*tracked, 0, len(leakDebug.open))
+	for _, t := range leakDebug.open {
+		open = append(open, t)
+	}
+	sort.Slice(open, func(i, j int) bool {
+		return open[i].id < open[j].id
+	})
+	handles := make([]Leak, len(open))
+	for i, t := range open {
+		handles[i] = t.leak
+	}
+	return handles
+}
+
+// WriteLeakReport writes the leaked and still open handles with their allocation stacks.
+func WriteLeakReport(w io.Writer) error {
+	leaks, open := Leaks(), OpenHandles()
+	if _, err := fmt.Fprintf(w, "vpx: %d leaked, %d open handles\n", len(leaks), len(open)); err != nil {
+		return err
+	}
+	for _, l := range leaks {
+		if _, err := fmt.Fprintf(w, "\nleaked %s allocated at:\n%s", l.Kind, l.Stack); err != nil {
+			return err
+		}
+	}
+	for _, l := range open {
+		if _, err := fmt.Fprintf(w, "\nopen %s allocated at:\n%s", l.Kind, l.Stack); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func trackAlloc(kind string) *tracked {
+	leakDebug.Lock()
+	defer leakDebug.Unlock()
+	if !leakDebug.enabled {
+		return nil
+	}
+	buf := make([]byte, 4096)
+	buf = buf[:runtime.Stack(buf, false)]
+	leakDebug.nextID++
+	t := &tracked{
+		id: leakDebug.nextID,
+		leak: Leak{
+			Kind:  kind,
+			Stack: string(buf),
+		},
+	}
+	leakDebug.open[t.id] = t
+	return t
+}
+
+func trackFree(t *tracked) {
+	if t == nil {
+		return
+	}
+	leakDebug.Lock()
+	delete(leakDebug.open, t.id)
+	leakDebug.Unlock()
+}
+
+func trackLeak(t *tracked) {
+	if t == nil {
+		return
+	}
+	leakDebug.Lock()
+	delete(leakDebug.open, t.id)
+	leakDebug.leaked = append(leakDebug.leaked, t.leak)
+	leakDebug.Unlock()
+}
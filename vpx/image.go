@@ -6,31 +6,54 @@ import (
 )
 
 /*
+#cgo pkg-config: vpx
+#include <vpx/vpx_image.h>
 #include <stdint.h>
 
-void yuv420_to_rgb(uint16_t width, uint16_t height,
-                 const uint8_t *y, const uint8_t *u, const uint8_t *v,
-                 unsigned int ystride,
-                 unsigned int ustride,
-                 unsigned int vstride,
-                 uint8_t *out)
+// yuv_to_rgb converts the visible part of an image with any subsampling and bit
+// depth. The k coefficients are fixed point with 16 fractional bits for samples
+// scaled to 8 bits: k[0] scales luma, k[1] is Cr to R, k[2] Cb to G, k[3] Cr to G
+// and k[4] Cb to B. With identity set, the planes hold G, B and R as is.
+void yuv_to_rgb(int width, int height,
+                const uint8_t *y, const uint8_t *u, const uint8_t *v,
+                int ystride, int ustride, int vstride,
+                int xshift, int yshift, int highbd, int depth_shift,
+                int yoff, int coff, int identity, const int64_t *k,
+                uint8_t *out)
 {
-    unsigned long int i, j;
+    int i, j;
+    int64_t round = (int64_t)1 << (15 + depth_shift);
+    int shift = 16 + depth_shift;
     for (i = 0; i < height; ++i) {
+        const uint8_t *yrow = y + (long)i * ystride;
+        const uint8_t *urow = u + (long)(i >> yshift) * ustride;
+        const uint8_t *vrow = v + (long)(i >> yshift) * vstride;
         for (j = 0; j < width; ++j) {
-            uint8_t *point = out + 4 * ((i * width) + j);
-            int t_y = y[((i * ystride) + j)];
-            int t_u = u[(((i / 2) * ustride) + (j / 2))];
-            int t_v = v[(((i / 2) * vstride) + (j / 2))];
-            t_y = t_y < 16 ? 16 : t_y;
-
-            int r = (298 * (t_y - 16) + 409 * (t_v - 128) + 128) >> 8;
-            int g = (298 * (t_y - 16) - 100 * (t_u - 128) - 208 * (t_v - 128) + 128) >> 8;
-            int b = (298 * (t_y - 16) + 516 * (t_u - 128) + 128) >> 8;
-
-            point[0] = r>255? 255 : r<0 ? 0 : r;
-            point[1] = g>255? 255 : g<0 ? 0 : g;
-            point[2] = b>255? 255 : b<0 ? 0 : b;
+            uint8_t *point = out + 4 * ((long)i * width + j);
+            int t_y, t_u, t_v;
+            if (highbd) {
+                t_y = ((const uint16_t *)yrow)[j];
+                t_u = ((const uint16_t *)urow)[j >> xshift];
+                t_v = ((const uint16_t *)vrow)[j >> xshift];
+            } else {
+                t_y = yrow[j];
+                t_u = urow[j >> xshift];
+                t_v = vrow[j >> xshift];
+            }
+            int64_t r, g, b;
+            if (identity) {
+                g = t_y >> depth_shift;
+                b = t_u >> depth_shift;
+                r = t_v >> depth_shift;
+            } else {
+                int64_t yy = k[0] * (t_y - yoff);
+                r = (yy + k[1] * (t_v - coff) + round) >> shift;
+                g = (yy - k[2] * (t_u - coff) - k[3] * (t_v - coff) + round) >> shift;
+                b = (yy + k[4] * (t_u - coff) + round) >> shift;
+            }
+            point[0] = r > 255 ? 255 : r < 0 ? 0 : r;
+            point[1] = g > 255 ? 255 : g < 0 ? 0 : g;
+            point[2] = b > 255 ? 255 : b < 0 ? 0 : b;
             point[3] = ~0;
         }
     }
@@ -38,23 +61,86 @@ void yuv420_to_rgb(uint16_t width, uint16_t height,
 */
 import "C"
 
+// ImageRGBA converts the image to RGBA with the colour space, range and bit depth
+// coded in the bitstream, see ImageRGBAColor.
 func (img *Image) ImageRGBA() *image.RGBA {
+	return img.ImageRGBAColor(img.ColorInfo())
+}
+
+// ImageRGBAColor converts the image to RGBA using the matrix and range of the given
+// colour, e.g. completed with the container metadata. Unknown matrices are converted
+// as BT.601. The transfer function is not applied, HDR content is not tone mapped.
+func (img *Image) ImageRGBAColor(c ColorInfo) *image.RGBA {
 	out := make([]uint8, img.DW*img.DH*4)
-	C.yuv420_to_rgb(
-		(C.uint16_t)(img.DW),
-		(C.uint16_t)(img.DH),
+	depth := img.BitDepth
+	if depth < 8 {
+		depth = 8
+	}
+	depthShift := depth - 8
+	var highbd C.int
+	if img.Fmt&ImageFormatHighbitdepth != 0 {
+		highbd = 1
+	}
+	var identity C.int
+	matrix := c.Matrix
+	if matrix == 0 {
+		if c.Space == ColorSpaceSrgb {
+			identity = 1
+		} else {
+			implied := ColorInfo{Space: c.Space}
+			implied.fillCodePoints()
+			matrix = implied.Matrix
+		}
+	}
+	k, yoff, coff := rgbCoefficients(matrix, c.Range)
+	ck := [5]C.int64_t{}
+	for i := range k {
+		ck[i] = C.int64_t(k[i])
+	}
+	C.yuv_to_rgb(
+		C.int(img.DW),
+		C.int(img.DH),
 		(*C.uint8_t)(img.Planes[PlaneY]),
 		(*C.uint8_t)(img.Planes[PlaneU]),
 		(*C.uint8_t)(img.Planes[PlaneV]),
-		(C.uint)(img.Stride[PlaneY]),
-		(C.uint)(img.Stride[PlaneU]),
-		(C.uint)(img.Stride[PlaneV]),
+		C.int(img.Stride[PlaneY]),
+		C.int(img.Stride[PlaneU]),
+		C.int(img.Stride[PlaneV]),
+		C.int(img.XChromaShift),
+		C.int(img.YChromaShift),
+		highbd,
+		C.int(depthShift),
+		C.int(yoff<<depthShift),
+		C.int(coff<<depthShift),
+		identity,
+		&ck[0],
 		(*C.uint8_t)(unsafe.Pointer((*sliceHeader)(unsafe.Pointer(&out)).Data)),
 	)
 	return &image.RGBA{
-		Pix:  out,
-		Rect: image.Rect(0, 0, int(img.DW), int(img.DH)),
+		Pix:    out,
+		Stride: int(img.DW) * 4,
+		Rect:   image.Rect(0, 0, int(img.DW), int(img.DH)),
+	}
+}
+
+// rgbCoefficients returns the fixed point conversion coefficients of yuv_to_rgb
+// and the offsets of the 8-bit samples.
+func rgbCoefficients(matrix uint, r ColorRange) (k [5]int64, yoff, coff uint32) {
+	kr, kb := lumaCoefficients(matrix)
+	kg := 1 - kr - kb
+	ys, cs := 1.0, 1.0
+	if r != CrFullRange {
+		ys, cs = 255.0/219, 255.0/224
+		yoff = 16
 	}
+	coff = 128
+	const one = 1 << 16
+	k[0] = int64(ys*one + 0.5)
+	k[1] = int64(2*(1-kr)*cs*one + 0.5)
+	k[2] = int64(2*kb*(1-kb)/kg*cs*one + 0.5)
+	k[3] = int64(2*kr*(1-kr)/kg*cs*one + 0.5)
+	k[4] = int64(2*(1-kb)*cs*one + 0.5)
+	return k, yoff, coff
 }
 
 func (img *Image) ImageYCbCr() *image.YCbCr {
@@ -88,6 +174,23 @@ func (img *Image) ImageYCbCr() *image.YCbCr {
 	return norm
 }
 
+// Update writes the colour space, colour range, bit depth and the display and
+// render sizes of the wrapper back to the referenced C image, so changes made
+// to an image allocated by ImageAlloc become visible to libvpx.
+func (img *Image) Update() {
+	ref := img.Ref()
+	if ref == nil {
+		return
+	}
+	ref.cs = (C.vpx_color_space_t)(img.Cs)
+	ref._range = (C.vpx_color_range_t)(img.Range)
+	ref.bit_depth = (C.uint)(img.BitDepth)
+	ref.d_w = (C.uint)(img.DW)
+	ref.d_h = (C.uint)(img.DH)
+	ref.r_w = (C.uint)(img.RW)
+	ref.r_h = (C.uint)(img.RH)
+}
+
 func copyBytePtr(buf *byte, size uint32) []uint8 {
 	dst := make([]uint8, size)
 	src := (*(*[1 << 30]uint8)(unsafe.Pointer(buf)))[:size]
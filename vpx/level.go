@@ -0,0 +1,58 @@
+package vpx
+
+import "strconv"
+
+// Level is a VP9 level as used by Vp9eSetTargetLevel and Vp9eGetLevel,
+// the level number times ten. The values match vp9.Level.
+type Level int32
+
+const (
+	// LevelOff disables level targeting and the level statistics, the default.
+	LevelOff Level = 255
+	// LevelStats only keeps the statistics needed by Vp9eGetLevel.
+	LevelStats Level = 0
+	// LevelAuto keeps the statistics and adapts the alt-ref distance and the
+	// number of tile columns to the picture size.
+	LevelAuto Level = 1
+
+	Level1  Level = 10
+	Level11 Level = 11
+	Level2  Level = 20
+	Level21 Level = 21
+	Level3  Level = 30
+	Level31 Level = 31
+	Level4  Level = 40
+	Level41 Level = 41
+	Level5  Level = 50
+	Level51 Level = 51
+	Level52 Level = 52
+	Level6  Level = 60
+	Level61 Level = 61
+	Level62 Level = 62
+)
+
+// String returns the level number, such as 4.1.
+func (l Level) String() string {
+	switch l {
+	case LevelOff:
+		return "off"
+	case LevelStats:
+		return "unknown"
+	case LevelAuto:
+		return "auto"
+	}
+	return strconv.Itoa(int(l)/10) + "." + strconv.Itoa(int(l)%10)
+}
+
+// SetTargetLevel constrains the VP9 encoder to a level, it must be called before the
+// first frame is encoded. LevelStats only enables the reporting done by Level.
+func (e *Encoder) SetTargetLevel(l Level) error {
+	return e.SetControl(Vp9eSetTargetLevel, int32(l))
+}
+
+// Level returns the VP9 level achieved by the frames encoded so far. The encoder must
+// have a target level other than LevelOff, LevelStats is returned if it has none.
+func (e *Encoder) Level() (Level, error) {
+	v, err := e.GetControl(Vp9eGetLevel)
+	return Level(v), err
+}
@@ -0,0 +1,257 @@
+package vpx
+
+import (
+	"bytes"
+	"errors"
+	"strconv"
+	"unsafe"
+)
+
+var (
+	ErrHighBitDepthUnsup = errors.New("vpx: libvpx was built without high bit depth support")
+	ErrLosslessFormat    = errors.New("vpx: image format not supported by VP9")
+	ErrNoSource          = errors.New("vpx: decoded a frame with no source image to compare")
+	ErrMissingFrames     = errors.New("vpx: source images left without decoded frames")
+)
+
+// VP9Profile returns the VP9 profile that encodes images of the given format and bit
+// depth: 0 for 8-bit 4:2:0, 1 for 8-bit 4:2:2, 4:4:0 and 4:4:4, 2 and 3 likewise
+// for 10 and 12-bit.
+func VP9Profile(fmt ImageFormat, bitDepth BitDepth) (uint32, error) {
+	var profile uint32
+	switch fmt &^ ImageFormatHighbitdepth {
+	case ImageFormatI420, ImageFormatYv12:
+	case ImageFormatI422, ImageFormatI440, ImageFormatI444:
+		profile = 1
+	default:
+		return 0, ErrLosslessFormat
+	}
+	switch bitDepth {
+	case Bits8:
+	case Bits10, Bits12:
+		profile += 2
+	default:
+		return 0, &ConfigError{"GBitDepth", "must be 8, 10 or 12"}
+	}
+	return profile, nil
+}
+
+// LosslessPreset returns the lossless-vp9 preset set up for source images of the given
+// format and bit depth, such as ImageFormatI44416 with Bits10. Profile, bit depth and
+// the CodecUseHighbitdepth flag are set accordingly, high bit depth needs a libvpx
+// built with it. Each decoded frame is then bit-exact with its source image.
+func LosslessPreset(fmt ImageFormat, bitDepth BitDepth, w, h, fps uint32) (*EncoderPreset, error) {
+	profile, err := VP9Profile(fmt, bitDepth)
+	if err != nil {
+		return nil, err
+	}
+	highBitDepth := bitDepth != Bits8
+	if highBitDepth != (fmt&ImageFormatHighbitdepth != 0) {
+		return nil, &ConfigError{"GInputBitDepth", "the image format does not match the bit depth"}
+	}
+	p, err := Preset("lossless-vp9", w, h, fps, 0)
+	if err != nil {
+		return nil, err
+	}
+	if highBitDepth {
+		if !Capabilities(p.Iface).HighBitDepth {
+			return nil, ErrHighBitDepthUnsup
+		}
+		p.Flags |= CodecUseHighbitdepth
+	}
+	p.Config.GProfile = profile
+	p.Config.GBitDepth = bitDepth
+	p.Config.GInputBitDepth = uint32(bitDepth)
+	return p, nil
+}
+
+// SetLossless switches VP9 lossless coding on or off, the quantizers are then ignored.
+func (e *Encoder) SetLossless(lossless bool) error {
+	var v int32
+	if lossless {
+		v = 1
+	}
+	return e.SetControl(Vp9eSetLossless, v)
+}
+
+// MismatchError reports the first difference found by a LosslessVerifier.
+type MismatchError struct {
+	// Frame is the index of the frame in display order.
+	Frame int
+	// Plane is PlaneY, PlaneU or PlaneV, -1 if the format or the size differ.
+	Plane int
+	// Row and Col locate the first differing sample in the plane.
+	Row int
+	Col int
+	// Reason describes the difference.
+	Reason string
+}
+
+func (e *MismatchError) Error() string {
+	msg := "vpx: frame " + strconv.Itoa(e.Frame)
+	if e.Plane >= 0 {
+		msg += " plane " + strconv.Itoa(e.Plane) + " at " + strconv.Itoa(e.Col) + "," + strconv.Itoa(e.Row)
+	}
+	return msg + ": " + e.Reason
+}
+
+// LosslessVerifier decodes an encoded stream and compares each frame bit-exactly with
+// its source image. Add the source images in display order as they are encoded, they
+// are copied so the buffers can be reused, then Decode the packets as they come out.
+type LosslessVerifier struct {
+	dec     *Decoder
+	sources []*planeCopy
+	frame   int
+	err     error
+}
+
+// planeCopy holds the visible samples of the planes of an image, without the padding.
+type planeCopy struct {
+	fmt    ImageFormat
+	w, h   uint32
+	planes [3][]byte
+}
+
+// NewLosslessVerifier returns a verifier for a VP9 stream.
+func NewLosslessVerifier() (*LosslessVerifier, error) {
+	dec, err := NewDecoder(DecoderIfaceVP9(), DecoderConfig{})
+	if err != nil {
+		return nil, err
+	}
+	return &LosslessVerifier{
+		dec: dec,
+	}, nil
+}
+
+// AddSource queues a copy of the next source image.
+func (v *LosslessVerifier) AddSource(img *Image) {
+	v.sources = append(v.sources, copyPlanes(img))
+}
+
+// Decode decodes a packet and compares the frames it produces, it returns the first
+// *MismatchError found, which is also returned by every later call.
+func (v *LosslessVerifier) Decode(data []byte) error {
+	if v.err != nil {
+		return v.err
+	}
+	if err := v.dec.Decode(data); err != nil {
+		v.err = err
+		return err
+	}
+	for f := v.dec.NextFrame(); f != nil; f = v.dec.NextFrame() {
+		if len(v.sources) == 0 {
+			v.err = ErrNoSource
+			return v.err
+		}
+		src := v.sources[0]
+		v.sources[0] = nil
+		v.sources = v.sources[1:]
+		if err := src.compare(f.Image, v.frame); err != nil {
+			v.err = err
+			return err
+		}
+		v.frame++
+	}
+	return nil
+}
+
+// Close checks that every source image was matched by a decoded frame
+// and destroys the decoder.
+func (v *LosslessVerifier) Close() error {
+	v.dec.Close()
+	if v.err == nil && len(v.sources) > 0 {
+		v.err = ErrMissingFrames
+	}
+	return v.err
+}
+
+// VerifyLossless decodes the packets and compares the frames with the source images,
+// given in display order.
+func VerifyLossless(packets [][]byte, sources []*Image) error {
+	v, err := NewLosslessVerifier()
+	if err != nil {
+		return err
+	}
+	for _, img := range sources {
+		v.AddSource(img)
+	}
+	for _, pkt := range packets {
+		if err := v.Decode(pkt); err != nil {
+			v.Close()
+			return err
+		}
+	}
+	return v.Close()
+}
+
+// planeSize returns the width in bytes and the height of a plane.
+func planeSize(img *Image, plane int) (int, int) {
+	w, h := img.DW, img.DH
+	if plane != PlaneY {
+		w = (w + (1 << img.XChromaShift) - 1) >> img.XChromaShift
+		h = (h + (1 << img.YChromaShift) - 1) >> img.YChromaShift
+	}
+	if img.Fmt&ImageFormatHighbitdepth != 0 {
+		w *= 2
+	}
+	return int(w), int(h)
+}
+
+// planeRow returns a row of a plane of the image.
+func planeRow(img *Image, plane, row, size int) []byte {
+	off := uintptr(row) * uintptr(img.Stride[plane])
+	return (*[1 << 30]byte)(unsafe.Pointer(uintptr(unsafe.Pointer(img.Planes[plane])) + off))[:size:size]
+}
+
+func copyPlanes(img *Image) *planeCopy {
+	c := &planeCopy{
+		fmt: img.Fmt,
+		w:   img.DW,
+		h:   img.DH,
+	}
+	if c.fmt == ImageFormatYv12 {
+		// the planes are only stored in a different order, VP9 decodes to I420
+		c.fmt = ImageFormatI420
+	}
+	for p := PlaneY; p <= PlaneV; p++ {
+		w, h := planeSize(img, p)
+		c.planes[p] = make([]byte, 0, w*h)
+		for y := 0; y < h; y++ {
+			c.planes[p] = append(c.planes[p], planeRow(img, p, y, w)...)
+		}
+	}
+	return c
+}
+
+func (c *planeCopy) compare(img *Image, frame int) error {
+	switch {
+	case img.Fmt != c.fmt:
+		return &MismatchError{Frame: frame, Plane: -1, Reason: "decoded format " + img.Fmt.String() + ", source " + c.fmt.String()}
+	case img.DW != c.w || img.DH != c.h:
+		return &MismatchError{Frame: frame, Plane: -1, Reason: "decoded size " + sizeString(img.DW, img.DH) + ", source " + sizeString(c.w, c.h)}
+	}
+	bps := 1
+	if c.fmt&ImageFormatHighbitdepth != 0 {
+		bps = 2
+	}
+	for p := PlaneY; p <= PlaneV; p++ {
+		w, h := planeSize(img, p)
+		for y := 0; y < h; y++ {
+			src := c.planes[p][y*w : (y+1)*w]
+			row := planeRow(img, p, y, w)
+			if bytes.Equal(src, row) {
+				continue
+			}
+			x := 0
+			for src[x] == row[x] {
+				x++
+			}
+			return &MismatchError{Frame: frame, Plane: p, Row: y, Col: x / bps, Reason: "samples differ"}
+		}
+	}
+	return nil
+}
+
+func sizeString(w, h uint32) string {
+	return strconv.Itoa(int(w)) + "x" + strconv.Itoa(int(h))
+}
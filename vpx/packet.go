@@ -0,0 +1,77 @@
+package vpx
+
+/*
+#cgo pkg-config: vpx
+#include <vpx/vpx_encoder.h>
+
+static void *cx_pkt_frame_buf(const vpx_codec_cx_pkt_t *pkt) { return pkt->data.frame.buf; }
+static size_t cx_pkt_frame_sz(const vpx_codec_cx_pkt_t *pkt) { return pkt->data.frame.sz; }
+static vpx_codec_pts_t cx_pkt_frame_pts(const vpx_codec_cx_pkt_t *pkt) { return pkt->data.frame.pts; }
+static unsigned long cx_pkt_frame_duration(const vpx_codec_cx_pkt_t *pkt) { return pkt->data.frame.duration; }
+static vpx_codec_frame_flags_t cx_pkt_frame_flags(const vpx_codec_cx_pkt_t *pkt) { return pkt->data.frame.flags; }
+static int cx_pkt_frame_partition_id(const vpx_codec_cx_pkt_t *pkt) { return pkt->data.frame.partition_id; }
+static void *cx_pkt_stats_buf(const vpx_codec_cx_pkt_t *pkt) { return pkt->data.twopass_stats.buf; }
+static size_t cx_pkt_stats_sz(const vpx_codec_cx_pkt_t *pkt) { return pkt->data.twopass_stats.sz; }
+*/
+import "C"
+
+// CodecCxFrame holds the compressed frame carried by a CodecCxFramePkt packet.
+// Buf references encoder-owned memory that stays valid only until the next
+// call to CodecEncode on the same context, copy it if you need to keep it.
+type CodecCxFrame struct {
+	Buf         []byte
+	Pts         CodecPts
+	Duration    uint
+	Flags       CodecFrameFlags
+	PartitionID int32
+}
+
+// Frame returns the compressed frame of the packet or nil if
+// the packet is not a CodecCxFramePkt.
+func (x *CodecCxPkt) Frame() *CodecCxFrame {
+	ref := x.Ref()
+	if ref == nil || ref.kind != CodecCxFramePkt {
+		return nil
+	}
+	frame := &CodecCxFrame{
+		Pts:         (CodecPts)(C.cx_pkt_frame_pts(ref)),
+		Duration:    (uint)(C.cx_pkt_frame_duration(ref)),
+		Flags:       (CodecFrameFlags)(C.cx_pkt_frame_flags(ref)),
+		PartitionID: (int32)(C.cx_pkt_frame_partition_id(ref)),
+	}
+	if sz := int(C.cx_pkt_frame_sz(ref)); sz > 0 {
+		frame.Buf = (*(*[1 << 30]byte)(C.cx_pkt_frame_buf(ref)))[:sz:sz]
+	}
+	return frame
+}
+
+// Stats returns the first pass statistics carried by a CodecStatsPkt packet or nil
+// if the packet is not one. The data references encoder-owned memory like CodecCxFrame.Buf.
+func (x *CodecCxPkt) Stats() []byte {
+	ref := x.Ref()
+	if ref == nil || ref.kind != CodecStatsPkt {
+		return nil
+	}
+	sz := int(C.cx_pkt_stats_sz(ref))
+	if sz == 0 {
+		return nil
+	}
+	return (*(*[1 << 30]byte)(C.cx_pkt_stats_buf(ref)))[:sz:sz]
+}
+
+// IsKeyframe reports whether the frame is a keyframe.
+func (f *CodecCxFrame) IsKeyframe() bool {
+	return f.Flags&FrameIsKey != 0
+}
+
+// IsInvisible reports whether the frame is not meant to be shown,
+// e.g. an alt-ref frame.
+func (f *CodecCxFrame) IsInvisible() bool {
+	return f.Flags&FrameIsInvisible != 0
+}
+
+// IsFragment reports whether the frame is one of several partitions
+// emitted in CodecUseOutputPartition mode and more fragments follow.
+func (f *CodecCxFrame) IsFragment() bool {
+	return f.Flags&FrameIsFragment != 0
+}
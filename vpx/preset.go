@@ -0,0 +1,363 @@
+package vpx
+
+import (
+	"errors"
+	"runtime"
+	"sort"
+)
+
+var (
+	ErrUnknownPreset = errors.New("vpx: unknown preset")
+	ErrPresetSize    = errors.New("vpx: preset needs a non-zero size and frame rate")
+)
+
+// Values of the VP9 tune content and temporal layering mode controls.
+const (
+	TuneContentDefault = 0
+	TuneContentScreen  = 1
+
+	TemporalLayeringNone   = 0
+	TemporalLayeringBypass = 1
+	TemporalLayering0101   = 2
+	TemporalLayering0212   = 3
+)
+
+// ControlSetting is a control set on the encoder after initialization.
+type ControlSetting struct {
+	ID    ControlID `json:"id" yaml:"id"`
+	Value int32     `json:"value" yaml:"value"`
+	// Optional controls are skipped if the installed libvpx does not support them.
+	Optional bool `json:"optional,omitempty" yaml:"optional,omitempty"`
+}
+
+// EncoderPreset is a complete encoder setup for a workload. Fields can be changed
+// before calling NewEncoder, Config is a plain Go value with no C memory attached.
+type EncoderPreset struct {
+	Name     string
+	Iface    *CodecIface
+	Config   CodecEncCfg
+	Flags    CodecFlags
+	Controls []ControlSetting
+	// Deadline is passed to CodecEncode, see DlRealtime, DlGoodQuality and DlBestQuality.
+	Deadline uint
+	// Passes is 2 for presets meant for two pass encoding: encode and flush the whole
+	// stream with the encoder of NewEncoder, whose GPass is RcFirstPass, then encode it
+	// again with NewLastPassEncoder given the Stats of the first encoder.
+	Passes int
+}
+
+// SetControl sets a control of the preset, replacing the previous value if any.
+func (p *EncoderPreset) SetControl(id ControlID, v int32) {
+	for i := range p.Controls {
+		if p.Controls[i].ID == id {
+			p.Controls[i].Value = v
+			return
+		}
+	}
+	p.Controls = append(p.Controls, ControlSetting{
+		ID:    id,
+		Value: v,
+	})
+}
+
+// NewEncoder initializes an encoder with the preset and sets its controls.
+func (p *EncoderPreset) NewEncoder() (*Encoder, error) {
+	cfg := p.Config
+	enc, err := NewEncoder(p.Iface, &cfg, p.Flags)
+	if err != nil {
+		return nil, err
+	}
+	enc.Deadline = p.Deadline
+	if err := enc.setControls(p.Controls); err != nil {
+		enc.Close()
+		return nil, err
+	}
+	return enc, nil
+}
+
+// NewLastPassEncoder initializes the last pass encoder of a two pass preset with the
+// statistics of the first pass and sets its controls, see the package NewLastPassEncoder.
+func (p *EncoderPreset) NewLastPassEncoder(stats []byte) (*Encoder, error) {
+	enc, err := NewLastPassEncoder(p.Iface, &p.Config, p.Flags, stats)
+	if err != nil {
+		return nil, err
+	}
+	enc.Deadline = p.Deadline
+	if err := enc.setControls(p.Controls); err != nil {
+		enc.Close()
+		return nil, err
+	}
+	return enc, nil
+}
+
+// setControls sets the controls in order, skipping the unsupported optional ones.
+func (e *Encoder) setControls(controls []ControlSetting) error {
+	for _, c := range controls {
+		if c.Optional && !c.ID.Supported() {
+			continue
+		}
+		if err := e.SetControl(c.ID, c.Value); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+type presetFunc func(w, h, fps, kbps uint32) (*EncoderPreset, error)
+
+var presets = map[string]presetFunc{
+	"rtc-vp8":          presetRtcVP8,
+	"rtc-vp9-svc":      presetRtcVP9SVC,
+	"screen-share-vp9": presetScreenShareVP9,
+	"vod-vp9-2pass":    presetVodVP92Pass,
+	"lossless-vp9":     presetLosslessVP9,
+	"archive-vp8-cq":   presetArchiveVP8CQ,
+}
+
+// PresetNames returns the names accepted by Preset.
+func PresetNames() []string {
+	names := make([]string, 0, len(presets))
+	for name := range presets {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// Preset returns the named preset for the given size, frame rate and bitrate in kbps:
+//
+//	rtc-vp8           realtime VP8 in CBR with frame dropping, for video calls
+//	rtc-vp9-svc       realtime VP9 in CBR with three temporal layers (0-2-1-2)
+//	screen-share-vp9  realtime VP9 tuned for screen content
+//	vod-vp9-2pass     two pass VP9 in VBR with alt-ref frames, for on demand video
+//	lossless-vp9      lossless VP9, the bitrate is ignored
+//	archive-vp8-cq    good quality VP8 in constrained quality mode
+//
+// The timebase is 1/fps, so the pts of a frame is its index.
+func Preset(name string, w, h, fps, kbps uint32) (*EncoderPreset, error) {
+	fn, ok := presets[name]
+	if !ok {
+		return nil, ErrUnknownPreset
+	}
+	if w == 0 || h == 0 || fps == 0 {
+		return nil, ErrPresetSize
+	}
+	p, err := fn(w, h, fps, kbps)
+	if err != nil {
+		return nil, err
+	}
+	p.Name = name
+	return p, nil
+}
+
+func newPreset(iface *CodecIface, w, h, fps, kbps uint32) (*EncoderPreset, error) {
+	cfg, err := EncConfigDefault(iface)
+	if err != nil {
+		return nil, err
+	}
+	cfg.GW = w
+	cfg.GH = h
+	cfg.GTimebase = Rational{Num: 1, Den: int32(fps)}
+	cfg.GThreads = presetThreads(w, h)
+	cfg.RcTargetBitrate = kbps
+	return &EncoderPreset{
+		Iface:    iface,
+		Config:   *cfg,
+		Deadline: DlRealtime,
+		Passes:   1,
+	}, nil
+}
+
+// presetThreads picks the number of threads by resolution, capped by the CPU count.
+func presetThreads(w, h uint32) uint32 {
+	var n uint32
+	switch px := w * h; {
+	case px <= 320*240:
+		n = 1
+	case px <= 640*480:
+		n = 2
+	case px <= 1280*720:
+		n = 4
+	default:
+		n = 8
+	}
+	if cpus := uint32(runtime.NumCPU()); n > cpus {
+		n = cpus
+	}
+	return n
+}
+
+// tileColumns returns the log2 of the number of VP9 tile columns,
+// each tile being at least 256 pixels wide.
+func tileColumns(w uint32) int32 {
+	var n int32
+	for n < 6 && w>>uint(n+1) >= 256 {
+		n++
+	}
+	return n
+}
+
+// setRealtimeRc sets the CBR rate control of realtime presets.
+func setRealtimeRc(cfg *CodecEncCfg) {
+	cfg.GPass = RcOnePass
+	cfg.GLagInFrames = 0
+	cfg.GErrorResilient = ErrorResilientDefault
+	cfg.RcEndUsage = Cbr
+	cfg.RcMinQuantizer = 2
+	cfg.RcMaxQuantizer = 56
+	cfg.RcUndershootPct = 50
+	cfg.RcOvershootPct = 50
+	cfg.RcBufSz = 1000
+	cfg.RcBufInitialSz = 500
+	cfg.RcBufOptimalSz = 600
+	cfg.RcDropframeThresh = 30
+	cfg.RcResizeAllowed = 0
+	// keyframes are requested by the receiver when needed
+	cfg.KfMode = KfAuto
+	cfg.KfMinDist = 0
+	cfg.KfMaxDist = 3000
+}
+
+func presetRtcVP8(w, h, fps, kbps uint32) (*EncoderPreset, error) {
+	p, err := newPreset(EncoderIfaceVP8(), w, h, fps, kbps)
+	if err != nil {
+		return nil, err
+	}
+	setRealtimeRc(&p.Config)
+	// keyframes are capped at half the optimal buffer worth of frames
+	maxIntra := int32(p.Config.RcBufOptimalSz * fps / 20)
+	p.Controls = []ControlSetting{
+		{ID: Vp8eSetCpuused, Value: -6},
+		{ID: Vp8eSetStaticThreshold, Value: 1},
+		{ID: Vp8eSetNoiseSensitivity, Value: 0},
+		{ID: Vp8eSetTokenPartitions, Value: 0},
+		{ID: Vp8eSetMaxIntraBitratePct, Value: maxIntra},
+	}
+	return p, nil
+}
+
+func presetRtcVP9SVC(w, h, fps, kbps uint32) (*EncoderPreset, error) {
+	p, err := newPreset(EncoderIfaceVP9(), w, h, fps, kbps)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &p.Config
+	setRealtimeRc(cfg)
+	// the base layer gets half of the bitrate, each upper layer a quarter
+	cfg.SsNumberLayers = 1
+	cfg.TsNumberLayers = 3
+	cfg.TsPeriodicity = 4
+	cfg.TsLayerID = [16]uint32{0, 2, 1, 2}
+	cfg.TsRateDecimator = [5]uint32{4, 2, 1}
+	cfg.TsTargetBitrate = [5]uint32{kbps / 2, kbps * 3 / 4, kbps}
+	cfg.LayerTargetBitrate = [12]uint32{kbps / 2, kbps * 3 / 4, kbps}
+	cfg.TemporalLayeringMode = TemporalLayering0212
+	p.Controls = []ControlSetting{
+		{ID: Vp8eSetCpuused, Value: 7},
+		{ID: Vp9eSetSvc, Value: 1},
+		{ID: Vp9eSetAqMode, Value: 3},
+		{ID: Vp9eSetTileColumns, Value: tileColumns(w)},
+		{ID: Vp9eSetNoiseSensitivity, Value: 0},
+		{ID: Vp9eSetFrameParallelDecoding, Value: 0},
+		{ID: Vp9eSetRowMT, Value: 1, Optional: true},
+	}
+	return p, nil
+}
+
+func presetScreenShareVP9(w, h, fps, kbps uint32) (*EncoderPreset, error) {
+	p, err := newPreset(EncoderIfaceVP9(), w, h, fps, kbps)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &p.Config
+	setRealtimeRc(cfg)
+	// text must stay sharp, frames are dropped rather than blurred
+	cfg.RcMinQuantizer = 2
+	cfg.RcMaxQuantizer = 52
+	cfg.RcDropframeThresh = 50
+	p.Controls = []ControlSetting{
+		{ID: Vp8eSetCpuused, Value: 6},
+		{ID: Vp9eSetTuneContent, Value: TuneContentScreen},
+		{ID: Vp9eSetAqMode, Value: 3},
+		{ID: Vp9eSetTileColumns, Value: tileColumns(w)},
+		{ID: Vp9eSetNoiseSensitivity, Value: 0},
+		{ID: Vp9eSetRowMT, Value: 1, Optional: true},
+	}
+	return p, nil
+}
+
+func presetVodVP92Pass(w, h, fps, kbps uint32) (*EncoderPreset, error) {
+	p, err := newPreset(EncoderIfaceVP9(), w, h, fps, kbps)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &p.Config
+	cfg.GPass = RcFirstPass
+	cfg.GLagInFrames = 25
+	cfg.GErrorResilient = 0
+	cfg.RcEndUsage = Vbr
+	cfg.RcMinQuantizer = 0
+	cfg.RcMaxQuantizer = 63
+	cfg.RcUndershootPct = 50
+	cfg.RcOvershootPct = 50
+	cfg.KfMode = KfAuto
+	cfg.KfMaxDist = 10 * fps
+	p.Deadline = DlGoodQuality
+	p.Passes = 2
+	p.Controls = []ControlSetting{
+		{ID: Vp8eSetCpuused, Value: 1},
+		{ID: Vp8eSetEnableautoaltref, Value: 1},
+		{ID: Vp8eSetArnrMaxframes, Value: 7},
+		{ID: Vp8eSetArnrStrength, Value: 5},
+		{ID: Vp9eSetTileColumns, Value: tileColumns(w)},
+		{ID: Vp9eSetFrameParallelDecoding, Value: 1},
+		{ID: Vp9eSetRowMT, Value: 1, Optional: true},
+	}
+	return p, nil
+}
+
+func presetLosslessVP9(w, h, fps, kbps uint32) (*EncoderPreset, error) {
+	p, err := newPreset(EncoderIfaceVP9(), w, h, fps, 0)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &p.Config
+	cfg.GLagInFrames = 0
+	cfg.RcEndUsage = Q
+	cfg.RcMinQuantizer = 0
+	cfg.RcMaxQuantizer = 0
+	p.Deadline = DlGoodQuality
+	p.Controls = []ControlSetting{
+		{ID: Vp8eSetCpuused, Value: 2},
+		{ID: Vp9eSetLossless, Value: 1},
+		{ID: Vp9eSetTileColumns, Value: tileColumns(w)},
+		{ID: Vp9eSetRowMT, Value: 1, Optional: true},
+	}
+	return p, nil
+}
+
+func presetArchiveVP8CQ(w, h, fps, kbps uint32) (*EncoderPreset, error) {
+	p, err := newPreset(EncoderIfaceVP8(), w, h, fps, kbps)
+	if err != nil {
+		return nil, err
+	}
+	cfg := &p.Config
+	cfg.GLagInFrames = 25
+	cfg.GErrorResilient = 0
+	// the bitrate is an upper bound, the quality is set by the CQ level
+	cfg.RcEndUsage = Cq
+	cfg.RcMinQuantizer = 0
+	cfg.RcMaxQuantizer = 63
+	cfg.KfMode = KfAuto
+	cfg.KfMaxDist = 10 * fps
+	p.Deadline = DlGoodQuality
+	p.Controls = []ControlSetting{
+		{ID: Vp8eSetCpuused, Value: 0},
+		{ID: Vp8eSetCqLevel, Value: 10},
+		{ID: Vp8eSetEnableautoaltref, Value: 1},
+		{ID: Vp8eSetArnrMaxframes, Value: 7},
+		{ID: Vp8eSetArnrStrength, Value: 5},
+		{ID: Vp8eSetArnrType, Value: 3},
+	}
+	return p, nil
+}
@@ -0,0 +1,225 @@
+package vpx
+
+import (
+	"reflect"
+	"runtime"
+)
+
+// ConfigError reports an invalid encoder configuration field.
+type ConfigError struct {
+	Field  string
+	Reason string
+}
+
+func (e *ConfigError) Error() string {
+	return "vpx: invalid " + e.Field + ": " + e.Reason
+}
+
+// ReconfigureMode tells how a configuration change was applied.
+type ReconfigureMode int
+
+const (
+	// ReconfigureNone means the configuration did not change.
+	ReconfigureNone ReconfigureMode = iota
+	// ReconfigureLive means the change was applied to the running encoder with CodecEncConfigSet.
+	ReconfigureLive
+	// ReconfigureReinit means the encoder was destroyed and initialized again.
+	ReconfigureReinit
+)
+
+func (m ReconfigureMode) String() string {
+	switch m {
+	case ReconfigureNone:
+		return "none"
+	case ReconfigureLive:
+		return "live"
+	case ReconfigureReinit:
+		return "reinit"
+	default:
+		return "unknown"
+	}
+}
+
+// ReconfigureResult describes a change applied by Reconfigure.
+type ReconfigureResult struct {
+	Mode ReconfigureMode
+	// Changed lists the names of the changed CodecEncCfg fields.
+	Changed []string
+	// Keyframe is set when the next encoded frame is a keyframe because of the change.
+	Keyframe bool
+	// Flushed holds the frames the previous encoder held back before it was
+	// re-initialized, they come before any frame encoded afterwards.
+	Flushed []*EncodedFrame
+}
+
+// liveFields can be changed at any time through CodecEncConfigSet.
+var liveFields = map[string]bool{
+	"RcTargetBitrate":         true,
+	"RcMinQuantizer":          true,
+	"RcMaxQuantizer":          true,
+	"RcUndershootPct":         true,
+	"RcOvershootPct":          true,
+	"RcBufSz":                 true,
+	"RcBufInitialSz":          true,
+	"RcBufOptimalSz":          true,
+	"RcDropframeThresh":       true,
+	"RcResizeAllowed":         true,
+	"RcScaledWidth":           true,
+	"RcScaledHeight":          true,
+	"RcResizeUpThresh":        true,
+	"RcResizeDownThresh":      true,
+	"RcEndUsage":              true,
+	"Rc2passVbrBiasPct":       true,
+	"Rc2passVbrMinsectionPct": true,
+	"Rc2passVbrMaxsectionPct": true,
+	"KfMode":                  true,
+	"KfMinDist":               true,
+	"KfMaxDist":               true,
+	"GErrorResilient":         true,
+	"SsTargetBitrate":         true,
+	"TsTargetBitrate":         true,
+	"LayerTargetBitrate":      true,
+}
+
+// Reconfigure changes the configuration of the encoder, start from Config and modify
+// the fields to change. Rate control and keyframe settings are applied live. A new
+// size is applied live in one pass encoding without lag if the encoder allows the
+// scaling, VP8 cannot grow past the initial size and VP9 scales by at most 2:1 down
+// and 1:16 up; a keyframe is then forced. The lag may only decrease and VP9 only can
+// change the number of threads live. Any other change re-initializes the encoder,
+// the frames the old one held back are flushed and returned in the result. The
+// controls set through the Encoder methods, the scale mode and the render size are
+// applied again to the new encoder, if one fails the old encoder is kept and the
+// error returned. If the flush fails, the new encoder is still in use and the error
+// is returned along with the result, which holds the frames flushed until then.
+func (e *Encoder) Reconfigure(cfg *CodecEncCfg) (*ReconfigureResult, error) {
+	if e.ctx == nil {
+		return nil, ErrEncoderClosed
+	}
+	if cfg == nil {
+		return nil, ErrNoEncoderConfig
+	}
+	next := *cfg
+	next.detach()
+	if err := validateEncCfg(&next); err != nil {
+		return nil, err
+	}
+	res := &ReconfigureResult{
+		Changed: changedFields(&e.cfg, &next),
+	}
+	if len(res.Changed) == 0 {
+		return res, nil
+	}
+	if e.canApplyLive(&next, res.Changed) {
+		ncfg := next
+		ret := CodecEncConfigSet(e.ctx, &ncfg)
+		ncfg.Free()
+		err := NewOpError(e.ctx, e.iface, OpConfig, ret)
+		runtime.KeepAlive(e.h)
+		if err != nil {
+			return nil, err
+		}
+		if next.GW != e.cfg.GW || next.GH != e.cfg.GH {
+			e.forceKeyframe = true
+			res.Keyframe = true
+		}
+		e.cfg = next
+		res.Mode = ReconfigureLive
+		return res, nil
+	}
+
+	// initialize the new encoder first, so the old one keeps working on failure,
+	// including when a control cannot be applied again
+	prev := *e
+	e.cfg = next
+	if err := e.init(); err != nil {
+		e.cfg = prev.cfg
+		return nil, err
+	}
+	flushed, err := prev.Flush()
+	// the first pass statistics output by the flush belong to the same pass
+	e.stats = prev.stats
+	// the last pass statistics are read by the new encoder
+	prev.statsIn = nil
+	prev.Close()
+	e.pending = nil
+	e.forceKeyframe = false
+	res.Mode = ReconfigureReinit
+	res.Keyframe = true
+	res.Flushed = flushed
+	return res, err
+}
+
+func (e *Encoder) canApplyLive(next *CodecEncCfg, changed []string) bool {
+	vp9 := e.iface == EncoderIfaceVP9()
+	for _, name := range changed {
+		switch {
+		case liveFields[name]:
+		case name == "GLagInFrames":
+			if next.GLagInFrames > e.cfg.GLagInFrames {
+				return false
+			}
+		case name == "GThreads":
+			if !vp9 {
+				return false
+			}
+		case name == "GW" || name == "GH":
+			if next.GLagInFrames > 1 || next.GPass != RcOnePass {
+				return false
+			}
+			if vp9 {
+				if !validScale(e.cfg.GW, next.GW) || !validScale(e.cfg.GH, next.GH) {
+					return false
+				}
+			} else if next.GW > e.initW || next.GH > e.initH {
+				return false
+			}
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+// validScale reports whether VP9 can predict a frame of the new size from
+// references of the old one.
+func validScale(prev, next uint32) bool {
+	return 2*next >= prev && next <= 16*prev
+}
+
+func validateEncCfg(cfg *CodecEncCfg) error {
+	return NewEncoderConfig(cfg).Validate()
+}
+
+// changedFields returns the names of the exported fields that differ.
+func changedFields(prev, next *CodecEncCfg) []string {
+	var changed []string
+	pv, nv := reflect.ValueOf(prev).Elem(), reflect.ValueOf(next).Elem()
+	t := pv.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).PkgPath != "" {
+			continue
+		}
+		if !equalExported(pv.Field(i), nv.Field(i)) {
+			changed = append(changed, t.Field(i).Name)
+		}
+	}
+	return changed
+}
+
+// equalExported compares values ignoring the unexported C references of wrapper structs.
+func equalExported(a, b reflect.Value) bool {
+	if a.Kind() != reflect.Struct {
+		return a.Interface() == b.Interface()
+	}
+	t := a.Type()
+	for i := 0; i < t.NumField(); i++ {
+		if t.Field(i).PkgPath != "" {
+			continue
+		}
+		if !equalExported(a.Field(i), b.Field(i)) {
+			return false
+		}
+	}
+	return true
+}
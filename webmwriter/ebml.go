@@ -0,0 +1,178 @@
+package webmwriter
+
+import (
+	"encoding/binary"
+	"math"
+)
+
+// EBML and Matroska element IDs, see https://www.matroska.org/technical/elements.html
+const (
+	idEBML               = 0x1A45DFA3
+	idEBMLVersion        = 0x4286
+	idEBMLReadVersion    = 0x42F7
+	idEBMLMaxIDLength    = 0x42F2
+	idEBMLMaxSizeLength  = 0x42F3
+	idDocType            = 0x4282
+	idDocTypeVersion     = 0x4287
+	idDocTypeReadVersion = 0x4285
+	idVoid               = 0xEC
+
+	idSegment      = 0x18538067
+	idSeekHead     = 0x114D9B74
+	idSeek         = 0x4DBB
+	idSeekID       = 0x53AB
+	idSeekPosition = 0x53AC
+
+	idInfo          = 0x1549A966
+	idTimecodeScale = 0x2AD7B1
+	idDuration      = 0x4489
+	idMuxingApp     = 0x4D80
+	idWritingApp    = 0x5741
+
+	idTracks          = 0x1654AE6B
+	idTrackEntry      = 0xAE
+	idTrackNumber     = 0xD7
+	idTrackUID        = 0x73C5
+	idTrackType       = 0x83
+	idFlagLacing      = 0x9C
+	idDefaultDuration = 0x23E383
+	idCodecID         = 0x86
+	idCodecPrivate    = 0x63A2
+	idCodecDelay      = 0x56AA
+	idSeekPreRoll     = 0x56BB
+
+	idVideo         = 0xE0
+	idPixelWidth    = 0xB0
+	idPixelHeight   = 0xBA
+	idDisplayWidth  = 0x54B0
+	idDisplayHeight = 0x54BA
+
+	idColour                  = 0x55B0
+	idMatrixCoefficients      = 0x55B1
+	idBitsPerChannel          = 0x55B2
+	idChromaSubsamplingHorz   = 0x55B3
+	idChromaSubsamplingVert   = 0x55B4
+	idRange                   = 0x55B9
+	idTransferCharacteristics = 0x55BA
+	idPrimaries               = 0x55BB
+	idMaxCLL                  = 0x55BC
+	idMaxFALL                 = 0x55BD
+
+	idMasteringMetadata       = 0x55D0
+	idPrimaryRChromaticityX   = 0x55D1
+	idPrimaryRChromaticityY   = 0x55D2
+	idPrimaryGChromaticityX   = 0x55D3
+	idPrimaryGChromaticityY   = 0x55D4
+	idPrimaryBChromaticityX   = 0x55D5
+	idPrimaryBChromaticityY   = 0x55D6
+	idWhitePointChromaticityX = 0x55D7
+	idWhitePointChromaticityY = 0x55D8
+	idLuminanceMax            = 0x55D9
+	idLuminanceMin            = 0x55DA
+
+	idAudio             = 0xE1
+	idSamplingFrequency = 0xB5
+	idChannels          = 0x9F
+	idBitDepth          = 0x6264
+
+	idCluster     = 0x1F43B675
+	idTimecode    = 0xE7
+	idSimpleBlock = 0xA3
+
+	idCues               = 0x1C53BB6B
+	idCuePoint           = 0xBB
+	idCueTime            = 0xB3
+	idCueTrackPositions  = 0xB7
+	idCueTrack           = 0xF7
+	idCueClusterPosition = 0xF1
+)
+
+// unknownSize is the reserved 8-byte size value meaning "size unknown".
+var unknownSize = []byte{0x01, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF, 0xFF}
+
+func encodeID(id uint32) []byte {
+	switch {
+	case id >= 1<<24:
+		return []byte{byte(id >> 24), byte(id >> 16), byte(id >> 8), byte(id)}
+	case id >= 1<<16:
+		return []byte{byte(id >> 16), byte(id >> 8), byte(id)}
+	case id >= 1<<8:
+		return []byte{byte(id >> 8), byte(id)}
+	default:
+		return []byte{byte(id)}
+	}
+}
+
+// encodeSize encodes n as a variable size integer of the minimal length.
+func encodeSize(n uint64) []byte {
+	length := 1
+	for length < 8 && n >= 1<<(uint(length)*7)-1 {
+		length++
+	}
+	return encodeSizeN(n, length)
+}
+
+// encodeSizeN encodes n as a variable size integer of the given length.
+func encodeSizeN(n uint64, length int) []byte {
+	buf := make([]byte, length)
+	for i := length - 1; i >= 0; i-- {
+		buf[i] = byte(n)
+		n >>= 8
+	}
+	buf[0] |= 0x80 >> uint(length-1)
+	return buf
+}
+
+func element(id uint32, data []byte) []byte {
+	buf := encodeID(id)
+	buf = append(buf, encodeSize(uint64(len(data)))...)
+	return append(buf, data...)
+}
+
+func master(id uint32, children ...[]byte) []byte {
+	var data []byte
+	for _, child := range children {
+		data = append(data, child...)
+	}
+	return element(id, data)
+}
+
+func uintElement(id uint32, v uint64) []byte {
+	length := 1
+	for length < 8 && v >= 1<<(uint(length)*8) {
+		length++
+	}
+	buf := make([]byte, length)
+	for i := length - 1; i >= 0; i-- {
+		buf[i] = byte(v)
+		v >>= 8
+	}
+	return element(id, buf)
+}
+
+// fixedUintElement encodes v using exactly 8 bytes, so it can be patched later.
+func fixedUintElement(id uint32, v uint64) []byte {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, v)
+	return element(id, buf)
+}
+
+func floatElement(id uint32, v float64) []byte {
+	buf := make([]byte, 8)
+	binary.BigEndian.PutUint64(buf, math.Float64bits(v))
+	return element(id, buf)
+}
+
+func stringElement(id uint32, s string) []byte {
+	return element(id, []byte(s))
+}
+
+// voidElement returns a Void element occupying exactly size bytes, size must be at least 2.
+func voidElement(size int) []byte {
+	if size < 10 {
+		return element(idVoid, make([]byte, size-2))
+	}
+	buf := encodeID(idVoid)
+	buf = append(buf, encodeSizeN(uint64(size-9), 8)...)
+	return append(buf, make([]byte, size-9)...)
+}
@@ -0,0 +1,266 @@
+package webmwriter
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"math"
+
+	"github.com/xlab/libvpx-go/vpx"
+)
+
+var ErrMalformed = errors.New("webmwriter: malformed EBML")
+
+// maxTracksSize limits the size of the Tracks element read in memory.
+const maxTracksSize = 1 << 20
+
+// readVint reads an EBML variable size integer, IDs keep their length marker.
+// The size is -1 if all of its value bits are set, meaning the size is unknown.
+func readVint(r io.ByteReader, id bool) (int64, error) {
+	b, err := r.ReadByte()
+	if err != nil {
+		return 0, err
+	}
+	n := 1
+	for mask := byte(0x80); b&mask == 0; mask >>= 1 {
+		if mask == 1 {
+			return 0, ErrMalformed
+		}
+		n++
+	}
+	v := uint64(b)
+	if !id {
+		v &= 0xFF >> uint(n)
+	}
+	unknown := v == 0xFF>>uint(n)
+	for i := 1; i < n; i++ {
+		b, err := r.ReadByte()
+		if err != nil {
+			return 0, err
+		}
+		unknown = unknown && b == 0xFF
+		v = v<<8 | uint64(b)
+	}
+	if !id && unknown {
+		return -1, nil
+	}
+	return int64(v), nil
+}
+
+// readHeader reads the ID and the size of an element.
+func readHeader(r io.ByteReader) (id uint32, size int64, err error) {
+	v, err := readVint(r, true)
+	if err != nil {
+		return 0, 0, err
+	}
+	if size, err = readVint(r, false); err != nil {
+		return 0, 0, err
+	}
+	return uint32(v), size, nil
+}
+
+// rawElement is an EBML element read in memory.
+type rawElement struct {
+	id   uint32
+	data []byte
+}
+
+// readChildren returns the elements contained in data.
+func readChildren(data []byte) ([]rawElement, error) {
+	r := bytes.NewReader(data)
+	var elements []rawElement
+	for r.Len() > 0 {
+		id, size, err := readHeader(r)
+		if err != nil || size < 0 || size > int64(r.Len()) {
+			return nil, ErrMalformed
+		}
+		start := len(data) - r.Len()
+		elements = append(elements, rawElement{id, data[start : start+int(size)]})
+		r.Seek(size, io.SeekCurrent)
+	}
+	return elements, nil
+}
+
+func (e rawElement) uint() uint {
+	var v uint
+	for _, b := range e.data {
+		v = v<<8 | uint(b)
+	}
+	return v
+}
+
+func (e rawElement) float() float64 {
+	switch len(e.data) {
+	case 4:
+		return float64(math.Float32frombits(binary.BigEndian.Uint32(e.data)))
+	case 8:
+		return math.Float64frombits(binary.BigEndian.Uint64(e.data))
+	default:
+		return 0
+	}
+}
+
+// ReadTrackColours reads the headers of a WebM file and returns the Colour element of
+// the video tracks that have one, by track number. The tracks must come before the
+// first cluster. The reader is buffered, so r is read past the Tracks element.
+func ReadTrackColours(r io.Reader) (map[uint]*Colour, error) {
+	br := bufio.NewReader(r)
+	id, size, err := readHeader(br)
+	if err != nil {
+		return nil, err
+	}
+	if id != idEBML || size < 0 {
+		return nil, ErrMalformed
+	}
+	if _, err := br.Discard(int(size)); err != nil {
+		return nil, err
+	}
+	if id, _, err = readHeader(br); err != nil {
+		return nil, err
+	}
+	if id != idSegment {
+		return nil, ErrMalformed
+	}
+	for {
+		id, size, err := readHeader(br)
+		if err != nil {
+			return nil, err
+		}
+		switch {
+		case id == idCluster:
+			return nil, nil
+		case size < 0:
+			return nil, ErrMalformed
+		case id == idTracks:
+			if size > maxTracksSize {
+				return nil, ErrMalformed
+			}
+			data := make([]byte, size)
+			if _, err := io.ReadFull(br, data); err != nil {
+				return nil, err
+			}
+			return trackColours(data)
+		}
+		if _, err := br.Discard(int(size)); err != nil {
+			return nil, err
+		}
+	}
+}
+
+func trackColours(tracks []byte) (map[uint]*Colour, error) {
+	entries, err := readChildren(tracks)
+	if err != nil {
+		return nil, err
+	}
+	colours := make(map[uint]*Colour)
+	for _, entry := range entries {
+		if entry.id != idTrackEntry {
+			continue
+		}
+		fields, err := readChildren(entry.data)
+		if err != nil {
+			return nil, err
+		}
+		var number uint
+		var colour *Colour
+		for _, field := range fields {
+			switch field.id {
+			case idTrackNumber:
+				number = field.uint()
+			case idVideo:
+				video, err := readChildren(field.data)
+				if err != nil {
+					return nil, err
+				}
+				for _, v := range video {
+					if v.id == idColour {
+						if colour, err = readColour(v.data); err != nil {
+							return nil, err
+						}
+					}
+				}
+			}
+		}
+		if colour != nil {
+			colours[number] = colour
+		}
+	}
+	return colours, nil
+}
+
+// readColour decodes a Colour element, the values it omits keep their defaults.
+func readColour(data []byte) (*Colour, error) {
+	fields, err := readChildren(data)
+	if err != nil {
+		return nil, err
+	}
+	colour := &Colour{
+		MatrixCoefficients:      MatrixUnspecified,
+		TransferCharacteristics: TransferUnspecified,
+		Primaries:               PrimariesUnspecified,
+	}
+	for _, f := range fields {
+		switch f.id {
+		case idMatrixCoefficients:
+			colour.MatrixCoefficients = f.uint()
+		case idBitsPerChannel:
+			colour.BitsPerChannel = f.uint()
+		case idChromaSubsamplingHorz:
+			colour.ChromaSubsamplingHorz = f.uint()
+		case idChromaSubsamplingVert:
+			colour.ChromaSubsamplingVert = f.uint()
+		case idRange:
+			colour.Range = f.uint()
+		case idTransferCharacteristics:
+			colour.TransferCharacteristics = f.uint()
+		case idPrimaries:
+			colour.Primaries = f.uint()
+		case idMaxCLL:
+			colour.MaxCLL = f.uint()
+		case idMaxFALL:
+			colour.MaxFALL = f.uint()
+		case idMasteringMetadata:
+			m, err := readMastering(f.data)
+			if err != nil {
+				return nil, err
+			}
+			colour.MasteringMetadata = m
+		}
+	}
+	return colour, nil
+}
+
+func readMastering(data []byte) (*vpx.MasteringMetadata, error) {
+	fields, err := readChildren(data)
+	if err != nil {
+		return nil, err
+	}
+	m := &vpx.MasteringMetadata{}
+	for _, f := range fields {
+		switch f.id {
+		case idPrimaryRChromaticityX:
+			m.PrimaryRChromaticityX = f.float()
+		case idPrimaryRChromaticityY:
+			m.PrimaryRChromaticityY = f.float()
+		case idPrimaryGChromaticityX:
+			m.PrimaryGChromaticityX = f.float()
+		case idPrimaryGChromaticityY:
+			m.PrimaryGChromaticityY = f.float()
+		case idPrimaryBChromaticityX:
+			m.PrimaryBChromaticityX = f.float()
+		case idPrimaryBChromaticityY:
+			m.PrimaryBChromaticityY = f.float()
+		case idWhitePointChromaticityX:
+			m.WhitePointChromaticityX = f.float()
+		case idWhitePointChromaticityY:
+			m.WhitePointChromaticityY = f.float()
+		case idLuminanceMax:
+			m.LuminanceMax = f.float()
+		case idLuminanceMin:
+			m.LuminanceMin = f.float()
+		}
+	}
+	return m, nil
+}
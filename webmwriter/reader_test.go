@@ -0,0 +1,86 @@
+package webmwriter
+
+import (
+	"bytes"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/xlab/libvpx-go/vpx"
+)
+
+// writeFile returns a file with the video track and a few frames.
+func writeFile(t *testing.T, video *VideoTrack) []byte {
+	var buf bytes.Buffer
+	w, err := NewWriter(&buf, Config{
+		Video: video,
+		Audio: &AudioTrack{CodecID: CodecOpus, SamplingFrequency: 48000, Channels: 2},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < 3; i++ {
+		if err := w.WriteVideo([]byte{byte(i), 1, 2, 3}, time.Duration(i)*time.Second/30, i == 0); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := w.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func TestReadTrackColours(t *testing.T) {
+	hdr := vpx.DefaultColorInfo(vpx.ColorSpaceBt2020, vpx.CrFullRange, 10)
+	hdr.Transfer = TransferSMPTE2084
+	hdr.MaxCLL = 1000
+	hdr.MaxFALL = 400
+	hdr.Mastering = &vpx.MasteringMetadata{
+		PrimaryRChromaticityX:   0.708,
+		PrimaryRChromaticityY:   0.292,
+		PrimaryGChromaticityX:   0.17,
+		PrimaryGChromaticityY:   0.797,
+		PrimaryBChromaticityX:   0.131,
+		PrimaryBChromaticityY:   0.046,
+		WhitePointChromaticityX: 0.3127,
+		WhitePointChromaticityY: 0.329,
+		LuminanceMax:            1000,
+		LuminanceMin:            0.005,
+	}
+	tests := []struct {
+		name string
+		info vpx.ColorInfo
+	}{
+		{"bt709", vpx.DefaultColorInfo(vpx.ColorSpaceBt709, vpx.CrStudioRange, 8)},
+		{"srgb", vpx.DefaultColorInfo(vpx.ColorSpaceSrgb, vpx.CrFullRange, 8)},
+		{"hdr", hdr},
+	}
+	for _, tt := range tests {
+		want := NewColour(tt.info)
+		data := writeFile(t, &VideoTrack{CodecID: CodecVP9, Width: 640, Height: 360, Colour: want})
+		colours, err := ReadTrackColours(bytes.NewReader(data))
+		if err != nil {
+			t.Errorf("%s: %v", tt.name, err)
+			continue
+		}
+		if len(colours) != 1 || !reflect.DeepEqual(colours[1], want) {
+			t.Errorf("%s: colours %v, want %+v for track 1", tt.name, colours, *want)
+			continue
+		}
+		if got := colours[1].ColorInfo(); got.Space != tt.info.Space || got.Matrix != tt.info.Matrix {
+			t.Errorf("%s: colour space %v matrix %d, want %v %d", tt.name, got.Space, got.Matrix, tt.info.Space, tt.info.Matrix)
+		}
+	}
+}
+
+func TestReadTrackColoursNone(t *testing.T) {
+	data := writeFile(t, &VideoTrack{CodecID: CodecVP8, Width: 640, Height: 360})
+	colours, err := ReadTrackColours(bytes.NewReader(data))
+	if err != nil || len(colours) != 0 {
+		t.Errorf("colours %v, error %v", colours, err)
+	}
+	data[0] = 0x1B
+	if _, err := ReadTrackColours(bytes.NewReader(data)); err != ErrMalformed {
+		t.Errorf("error %v, want ErrMalformed", err)
+	}
+}
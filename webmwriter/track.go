@@ -0,0 +1,239 @@
+package webmwriter
+
+import (
+	"time"
+
+	"github.com/xlab/libvpx-go/vpx"
+)
+
+// Codec IDs of the tracks supported by the WebM container.
+const (
+	CodecVP8    = "V_VP8"
+	CodecVP9    = "V_VP9"
+	CodecOpus   = "A_OPUS"
+	CodecVorbis = "A_VORBIS"
+)
+
+const (
+	trackTypeVideo = 1
+	trackTypeAudio = 2
+)
+
+// VideoTrack describes the video track of the file.
+type VideoTrack struct {
+	// CodecID is either CodecVP8 or CodecVP9.
+	CodecID string
+	Width   uint
+	Height  uint
+	// DisplayWidth and DisplayHeight are optional, when set they specify
+	// the size the video should be displayed at.
+	DisplayWidth  uint
+	DisplayHeight uint
+	// DefaultDuration is the optional nominal frame duration.
+	DefaultDuration time.Duration
+	// Colour is optional colour metadata of the video.
+	Colour *Colour
+}
+
+// AudioTrack describes the audio track of the file. Audio packets are
+// passed through as is, the writer does not encode or parse them.
+type AudioTrack struct {
+	// CodecID is either CodecOpus or CodecVorbis.
+	CodecID string
+	// CodecPrivate holds the OpusHead packet or the Xiph-laced Vorbis headers.
+	CodecPrivate      []byte
+	SamplingFrequency float64
+	Channels          uint
+	BitDepth          uint
+	// CodecDelay and SeekPreRoll are used by Opus.
+	CodecDelay  time.Duration
+	SeekPreRoll time.Duration
+}
+
+// Colour values as defined by ISO/IEC 23001-8 that are commonly used with VP8/VP9.
+const (
+	MatrixIdentity    = 0
+	MatrixBT709       = 1
+	MatrixUnspecified = 2
+	MatrixBT470BG     = 5
+	MatrixSMPTE170M   = 6
+	MatrixSMPTE240M   = 7
+	MatrixBT2020NCL   = 9
+
+	RangeUnspecified = 0
+	RangeBroadcast   = 1
+	RangeFull        = 2
+
+	TransferBT709       = 1
+	TransferUnspecified = 2
+	TransferSMPTE170M   = 6
+	TransferSMPTE240M   = 7
+	TransferIEC61966    = 13
+	TransferBT2020_10   = 14
+	TransferBT2020_12   = 15
+	TransferSMPTE2084   = 16
+	TransferHLG         = 18
+
+	PrimariesBT709       = 1
+	PrimariesUnspecified = 2
+	PrimariesBT470BG     = 5
+	PrimariesSMPTE170M   = 6
+	PrimariesSMPTE240M   = 7
+	PrimariesBT2020      = 9
+)
+
+// Colour describes the colour format of the video track, it is written
+// as the Colour element of the track.
+type Colour struct {
+	MatrixCoefficients      uint
+	BitsPerChannel          uint
+	ChromaSubsamplingHorz   uint
+	ChromaSubsamplingVert   uint
+	Range                   uint
+	TransferCharacteristics uint
+	Primaries               uint
+	// MaxCLL and MaxFALL are the HDR light levels in cd/m², omitted if zero.
+	MaxCLL  uint
+	MaxFALL uint
+	// MasteringMetadata is the optional SMPTE 2086 mastering display colour volume.
+	MasteringMetadata *vpx.MasteringMetadata
+}
+
+// NewColour returns the Colour element describing the given colour,
+// see vpx.ColorInfo and vpx.Image.ColorInfo.
+func NewColour(c vpx.ColorInfo) *Colour {
+	colour := &Colour{
+		MatrixCoefficients:      c.Matrix,
+		BitsPerChannel:          uint(c.BitDepth),
+		ChromaSubsamplingHorz:   uint(c.XChromaShift),
+		ChromaSubsamplingVert:   uint(c.YChromaShift),
+		Range:                   RangeBroadcast,
+		TransferCharacteristics: c.Transfer,
+		Primaries:               c.Primaries,
+		MaxCLL:                  c.MaxCLL,
+		MaxFALL:                 c.MaxFALL,
+		MasteringMetadata:       c.Mastering,
+	}
+	if c.Matrix == 0 && c.Space != vpx.ColorSpaceSrgb {
+		colour.MatrixCoefficients = MatrixUnspecified
+	}
+	if c.Range == vpx.CrFullRange {
+		colour.Range = RangeFull
+	}
+	return colour
+}
+
+// ColorInfo returns the colour described by the element, the colour space is
+// derived from the matrix.
+func (c *Colour) ColorInfo() vpx.ColorInfo {
+	info := vpx.ColorInfo{
+		Space:        vpx.ColorSpaceFromMatrix(c.MatrixCoefficients),
+		Matrix:       c.MatrixCoefficients,
+		Transfer:     c.TransferCharacteristics,
+		Primaries:    c.Primaries,
+		BitDepth:     uint32(c.BitsPerChannel),
+		XChromaShift: uint32(c.ChromaSubsamplingHorz),
+		YChromaShift: uint32(c.ChromaSubsamplingVert),
+		MaxCLL:       c.MaxCLL,
+		MaxFALL:      c.MaxFALL,
+		Mastering:    c.MasteringMetadata,
+	}
+	if c.Range == RangeFull {
+		info.Range = vpx.CrFullRange
+	}
+	return info
+}
+
+func (c *Colour) marshal() []byte {
+	colour := [][]byte{
+		uintElement(idMatrixCoefficients, uint64(c.MatrixCoefficients)),
+		uintElement(idBitsPerChannel, uint64(c.BitsPerChannel)),
+		uintElement(idChromaSubsamplingHorz, uint64(c.ChromaSubsamplingHorz)),
+		uintElement(idChromaSubsamplingVert, uint64(c.ChromaSubsamplingVert)),
+		uintElement(idRange, uint64(c.Range)),
+	}
+	// zero is a reserved value for both
+	if c.TransferCharacteristics > 0 {
+		colour = append(colour, uintElement(idTransferCharacteristics, uint64(c.TransferCharacteristics)))
+	}
+	if c.Primaries > 0 {
+		colour = append(colour, uintElement(idPrimaries, uint64(c.Primaries)))
+	}
+	if c.MaxCLL > 0 {
+		colour = append(colour, uintElement(idMaxCLL, uint64(c.MaxCLL)))
+	}
+	if c.MaxFALL > 0 {
+		colour = append(colour, uintElement(idMaxFALL, uint64(c.MaxFALL)))
+	}
+	if m := c.MasteringMetadata; m != nil {
+		colour = append(colour, master(idMasteringMetadata,
+			floatElement(idPrimaryRChromaticityX, m.PrimaryRChromaticityX),
+			floatElement(idPrimaryRChromaticityY, m.PrimaryRChromaticityY),
+			floatElement(idPrimaryGChromaticityX, m.PrimaryGChromaticityX),
+			floatElement(idPrimaryGChromaticityY, m.PrimaryGChromaticityY),
+			floatElement(idPrimaryBChromaticityX, m.PrimaryBChromaticityX),
+			floatElement(idPrimaryBChromaticityY, m.PrimaryBChromaticityY),
+			floatElement(idWhitePointChromaticityX, m.WhitePointChromaticityX),
+			floatElement(idWhitePointChromaticityY, m.WhitePointChromaticityY),
+			floatElement(idLuminanceMax, m.LuminanceMax),
+			floatElement(idLuminanceMin, m.LuminanceMin),
+		))
+	}
+	return master(idColour, colour...)
+}
+
+func (t *VideoTrack) marshal(number uint64) []byte {
+	video := [][]byte{
+		uintElement(idPixelWidth, uint64(t.Width)),
+		uintElement(idPixelHeight, uint64(t.Height)),
+	}
+	if t.DisplayWidth > 0 && t.DisplayHeight > 0 {
+		video = append(video,
+			uintElement(idDisplayWidth, uint64(t.DisplayWidth)),
+			uintElement(idDisplayHeight, uint64(t.DisplayHeight)),
+		)
+	}
+	if t.Colour != nil {
+		video = append(video, t.Colour.marshal())
+	}
+	entry := [][]byte{
+		uintElement(idTrackNumber, number),
+		uintElement(idTrackUID, number),
+		uintElement(idTrackType, trackTypeVideo),
+		uintElement(idFlagLacing, 0),
+		stringElement(idCodecID, t.CodecID),
+	}
+	if t.DefaultDuration > 0 {
+		entry = append(entry, uintElement(idDefaultDuration, uint64(t.DefaultDuration)))
+	}
+	entry = append(entry, master(idVideo, video...))
+	return master(idTrackEntry, entry...)
+}
+
+func (t *AudioTrack) marshal(number uint64) []byte {
+	audio := [][]byte{
+		floatElement(idSamplingFrequency, t.SamplingFrequency),
+		uintElement(idChannels, uint64(t.Channels)),
+	}
+	if t.BitDepth > 0 {
+		audio = append(audio, uintElement(idBitDepth, uint64(t.BitDepth)))
+	}
+	entry := [][]byte{
+		uintElement(idTrackNumber, number),
+		uintElement(idTrackUID, number),
+		uintElement(idTrackType, trackTypeAudio),
+		uintElement(idFlagLacing, 0),
+		stringElement(idCodecID, t.CodecID),
+	}
+	if len(t.CodecPrivate) > 0 {
+		entry = append(entry, element(idCodecPrivate, t.CodecPrivate))
+	}
+	if t.CodecDelay > 0 {
+		entry = append(entry, uintElement(idCodecDelay, uint64(t.CodecDelay)))
+	}
+	if t.SeekPreRoll > 0 {
+		entry = append(entry, uintElement(idSeekPreRoll, uint64(t.SeekPreRoll)))
+	}
+	entry = append(entry, master(idAudio, audio...))
+	return master(idTrackEntry, entry...)
+}
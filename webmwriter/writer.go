@@ -0,0 +1,383 @@
+// Package webmwriter implements a WebM muxer for VP8/VP9 video produced by
+// the vpx encoder, with an optional Opus or Vorbis audio track passed through as is.
+// ReadTrackColours reads the colour metadata of the video tracks back from a file.
+package webmwriter
+
+import (
+	"errors"
+	"io"
+	"time"
+
+	"github.com/xlab/libvpx-go/vpx"
+)
+
+var (
+	ErrNoTracks         = errors.New("webmwriter: no tracks configured")
+	ErrUnsupportedCodec = errors.New("webmwriter: unsupported codec")
+	ErrNoVideoTrack     = errors.New("webmwriter: no video track configured")
+	ErrNoAudioTrack     = errors.New("webmwriter: no audio track configured")
+	ErrWriterClosed     = errors.New("webmwriter: writer is closed")
+)
+
+const (
+	defaultWritingApp         = "libvpx-go"
+	defaultMaxClusterDuration = 5 * time.Second
+
+	// seekHeadReserved is the space reserved for SeekHead at the beginning
+	// of the Segment, enough to store three fixed-size Seek entries.
+	seekHeadReserved = 96
+)
+
+// Config specifies the tracks and muxing options of a file.
+type Config struct {
+	Video *VideoTrack
+	Audio *AudioTrack
+
+	// WritingApp is the name of the application, defaults to "libvpx-go".
+	WritingApp string
+	// Live makes the writer treat the output as non-seekable even if it
+	// implements io.Seeker, so that nothing written is ever rewritten.
+	Live bool
+	// MaxClusterDuration limits the duration of a cluster, a new cluster is also
+	// started on every video keyframe. Defaults to 5 seconds.
+	MaxClusterDuration time.Duration
+}
+
+// Writer writes a WebM file. Blocks must be written in timestamp order.
+// If the output implements io.WriteSeeker (and Live is not set) the Segment
+// size, Duration and SeekHead are finalised on Close, otherwise the file is
+// written strictly sequentially with an unknown-sized Segment.
+type Writer struct {
+	cfg    Config
+	w      io.Writer
+	seeker io.WriteSeeker
+
+	// positions relative to the beginning of the Segment data,
+	// segmentStart is the absolute offset of it when the output is seekable.
+	segmentStart int64
+	pos          int64
+	infoPos      int64
+	tracksPos    int64
+	durationPos  int64
+
+	videoNum uint64
+	audioNum uint64
+	cueTrack uint64
+
+	cluster       []byte
+	clusterOpen   bool
+	clusterTc     int64
+	clusterHasCue bool
+	clusterCueTrk bool
+	cues          []cuePoint
+
+	partial  []byte
+	duration time.Duration
+	closed   bool
+}
+
+type cuePoint struct {
+	time     int64
+	track    uint64
+	position int64
+}
+
+// NewWriter writes the file headers to w and returns a Writer ready to accept blocks.
+func NewWriter(w io.Writer, cfg Config) (*Writer, error) {
+	if cfg.Video == nil && cfg.Audio == nil {
+		return nil, ErrNoTracks
+	}
+	if cfg.Video != nil {
+		switch cfg.Video.CodecID {
+		case CodecVP8, CodecVP9:
+		default:
+			return nil, ErrUnsupportedCodec
+		}
+	}
+	if cfg.Audio != nil {
+		switch cfg.Audio.CodecID {
+		case CodecOpus, CodecVorbis:
+		default:
+			return nil, ErrUnsupportedCodec
+		}
+	}
+	if len(cfg.WritingApp) == 0 {
+		cfg.WritingApp = defaultWritingApp
+	}
+	if cfg.MaxClusterDuration <= 0 {
+		cfg.MaxClusterDuration = defaultMaxClusterDuration
+	}
+	writer := &Writer{
+		cfg: cfg,
+		w:   w,
+	}
+	var start int64
+	if ws, ok := w.(io.WriteSeeker); ok && !cfg.Live {
+		if offset, err := ws.Seek(0, io.SeekCurrent); err == nil {
+			writer.seeker = ws
+			start = offset
+		}
+	}
+	if cfg.Video != nil {
+		writer.videoNum = 1
+		writer.cueTrack = writer.videoNum
+	}
+	if cfg.Audio != nil {
+		writer.audioNum = writer.videoNum + 1
+		if writer.cueTrack == 0 {
+			writer.cueTrack = writer.audioNum
+		}
+	}
+	if err := writer.writeHeaders(start); err != nil {
+		return nil, err
+	}
+	return writer, nil
+}
+
+func (w *Writer) writeHeaders(start int64) error {
+	header := master(idEBML,
+		uintElement(idEBMLVersion, 1),
+		uintElement(idEBMLReadVersion, 1),
+		uintElement(idEBMLMaxIDLength, 4),
+		uintElement(idEBMLMaxSizeLength, 8),
+		stringElement(idDocType, "webm"),
+		uintElement(idDocTypeVersion, 4),
+		uintElement(idDocTypeReadVersion, 2),
+	)
+	header = append(header, encodeID(idSegment)...)
+	header = append(header, unknownSize...)
+	if _, err := w.w.Write(header); err != nil {
+		return err
+	}
+	w.segmentStart = start + int64(len(header))
+
+	if w.seeker != nil {
+		if err := w.write(voidElement(seekHeadReserved)); err != nil {
+			return err
+		}
+	}
+	info := [][]byte{
+		uintElement(idTimecodeScale, uint64(time.Millisecond)),
+		stringElement(idMuxingApp, defaultWritingApp),
+		stringElement(idWritingApp, w.cfg.WritingApp),
+	}
+	if w.seeker != nil {
+		// to be patched on Close
+		info = append(info, floatElement(idDuration, 0))
+	}
+	infoElement := master(idInfo, info...)
+	w.infoPos = w.pos
+	w.durationPos = w.pos + int64(len(infoElement)) - 8
+	if err := w.write(infoElement); err != nil {
+		return err
+	}
+	var tracks [][]byte
+	if w.cfg.Video != nil {
+		tracks = append(tracks, w.cfg.Video.marshal(w.videoNum))
+	}
+	if w.cfg.Audio != nil {
+		tracks = append(tracks, w.cfg.Audio.marshal(w.audioNum))
+	}
+	w.tracksPos = w.pos
+	return w.write(master(idTracks, tracks...))
+}
+
+// WriteVideo writes a compressed video frame with the given timestamp.
+func (w *Writer) WriteVideo(data []byte, ts time.Duration, keyframe bool) error {
+	if w.videoNum == 0 {
+		return ErrNoVideoTrack
+	}
+	return w.writeBlock(w.videoNum, data, ts, keyframe, false)
+}
+
+// WriteVideoPacket writes the compressed frame from an encoder output packet,
+// its timestamp is converted using the encoder timebase. Partitions emitted in
+// CodecUseOutputPartition mode are collected until the frame is complete.
+// Packets of other kinds are ignored.
+func (w *Writer) WriteVideoPacket(pkt *vpx.CodecCxPkt, timebase vpx.Rational) error {
+	if w.videoNum == 0 {
+		return ErrNoVideoTrack
+	}
+	frame := pkt.Frame()
+	if frame == nil {
+		return nil
+	}
+	if frame.IsFragment() {
+		w.partial = append(w.partial, frame.Buf...)
+		return nil
+	}
+	data := frame.Buf
+	if len(w.partial) > 0 {
+		data = append(w.partial, data...)
+		w.partial = nil
+	}
+	ts := ptsToDuration(int64(frame.Pts), timebase)
+	if err := w.writeBlock(w.videoNum, data, ts, frame.IsKeyframe(), frame.IsInvisible()); err != nil {
+		return err
+	}
+	if end := ts + ptsToDuration(int64(frame.Duration), timebase); end > w.duration {
+		w.duration = end
+	}
+	return nil
+}
+
+// WriteAudio writes an audio packet with the given timestamp.
+func (w *Writer) WriteAudio(data []byte, ts time.Duration) error {
+	if w.audioNum == 0 {
+		return ErrNoAudioTrack
+	}
+	return w.writeBlock(w.audioNum, data, ts, true, false)
+}
+
+func (w *Writer) writeBlock(track uint64, data []byte, ts time.Duration, keyframe, invisible bool) error {
+	if w.closed {
+		return ErrWriterClosed
+	}
+	tc := int64(ts / time.Millisecond)
+	if w.needsCluster(track, tc, keyframe) {
+		if err := w.flushCluster(); err != nil {
+			return err
+		}
+		w.clusterOpen = true
+		w.clusterTc = tc
+		w.clusterHasCue = false
+		w.clusterCueTrk = false
+	}
+	if track == w.cueTrack {
+		if keyframe && !w.clusterHasCue {
+			w.cues = append(w.cues, cuePoint{
+				time:     tc,
+				track:    track,
+				position: w.pos,
+			})
+			w.clusterHasCue = true
+		}
+		w.clusterCueTrk = true
+	}
+	rel := tc - w.clusterTc
+	var flags byte
+	if keyframe {
+		flags |= 0x80
+	}
+	if invisible {
+		flags |= 0x08
+	}
+	block := encodeSize(track)
+	block = append(block, byte(rel>>8), byte(rel), flags)
+	block = append(block, data...)
+	w.cluster = append(w.cluster, element(idSimpleBlock, block)...)
+	if ts > w.duration {
+		w.duration = ts
+	}
+	return nil
+}
+
+func (w *Writer) needsCluster(track uint64, tc int64, keyframe bool) bool {
+	if !w.clusterOpen {
+		return true
+	}
+	rel := tc - w.clusterTc
+	switch {
+	case rel > 32767, rel < -32768:
+		return true
+	case track == w.cueTrack && keyframe && w.clusterCueTrk && w.videoNum != 0:
+		// start clusters on video keyframes so they can be used for seeking
+		return true
+	case time.Duration(rel)*time.Millisecond >= w.cfg.MaxClusterDuration:
+		return true
+	}
+	return false
+}
+
+func (w *Writer) flushCluster() error {
+	if !w.clusterOpen || len(w.cluster) == 0 {
+		return nil
+	}
+	cluster := master(idCluster, uintElement(idTimecode, uint64(w.clusterTc)), w.cluster)
+	w.cluster = w.cluster[:0]
+	w.clusterOpen = false
+	return w.write(cluster)
+}
+
+// Close flushes the pending cluster, writes Cues and, if the output is seekable,
+// finalises the Segment size, Duration and SeekHead. It does not close the underlying writer.
+func (w *Writer) Close() error {
+	if w.closed {
+		return ErrWriterClosed
+	}
+	w.closed = true
+	if err := w.flushCluster(); err != nil {
+		return err
+	}
+	var cuesPos int64 = -1
+	if len(w.cues) > 0 {
+		points := make([][]byte, 0, len(w.cues))
+		for _, cue := range w.cues {
+			points = append(points, master(idCuePoint,
+				uintElement(idCueTime, uint64(cue.time)),
+				master(idCueTrackPositions,
+					uintElement(idCueTrack, cue.track),
+					uintElement(idCueClusterPosition, uint64(cue.position)),
+				),
+			))
+		}
+		cuesPos = w.pos
+		if err := w.write(master(idCues, points...)); err != nil {
+			return err
+		}
+	}
+	if w.seeker == nil {
+		return nil
+	}
+	end := w.segmentStart + w.pos
+	if err := w.patch(-8, encodeSizeN(uint64(w.pos), 8)); err != nil {
+		return err
+	}
+	duration := floatElement(idDuration, float64(w.duration)/float64(time.Millisecond))
+	if err := w.patch(w.durationPos, duration[len(duration)-8:]); err != nil {
+		return err
+	}
+	seeks := [][]byte{
+		seekEntry(idInfo, w.infoPos),
+		seekEntry(idTracks, w.tracksPos),
+	}
+	if cuesPos >= 0 {
+		seeks = append(seeks, seekEntry(idCues, cuesPos))
+	}
+	seekHead := master(idSeekHead, seeks...)
+	seekHead = append(seekHead, voidElement(seekHeadReserved-len(seekHead))...)
+	if err := w.patch(0, seekHead); err != nil {
+		return err
+	}
+	_, err := w.seeker.Seek(end, io.SeekStart)
+	return err
+}
+
+func seekEntry(id uint32, pos int64) []byte {
+	return master(idSeek,
+		element(idSeekID, encodeID(id)),
+		fixedUintElement(idSeekPosition, uint64(pos)),
+	)
+}
+
+func (w *Writer) write(p []byte) error {
+	n, err := w.w.Write(p)
+	w.pos += int64(n)
+	return err
+}
+
+// patch overwrites data at the position relative to the beginning of the Segment data.
+func (w *Writer) patch(pos int64, p []byte) error {
+	if _, err := w.seeker.Seek(w.segmentStart+pos, io.SeekStart); err != nil {
+		return err
+	}
+	_, err := w.seeker.Write(p)
+	return err
+}
+
+func ptsToDuration(pts int64, timebase vpx.Rational) time.Duration {
+	if timebase.Den == 0 {
+		return 0
+	}
+	return time.Duration(pts * int64(timebase.Num) * int64(time.Second) / int64(timebase.Den))
+}
@@ -0,0 +1,124 @@
+package y4m
+
+import (
+	"bufio"
+	"io"
+	"unsafe"
+
+	"github.com/xlab/libvpx-go/vpx"
+)
+
+// Reader reads frames from a Y4M stream into a vpx.Image allocated by libvpx,
+// so the frames can be passed to the encoder directly.
+type Reader struct {
+	Header Header
+
+	r      *bufio.Reader
+	imgBuf *vpx.ImageBuffer
+	img    *vpx.Image
+	buf    []byte
+}
+
+// NewReader parses the stream header from r and returns a Reader positioned at the first frame.
+func NewReader(r io.Reader) (*Reader, error) {
+	reader := &Reader{
+		r: bufio.NewReader(r),
+	}
+	line, err := reader.readLine()
+	if err == io.EOF {
+		return nil, ErrInvalidHeader
+	} else if err != nil {
+		return nil, err
+	}
+	if err := reader.Header.parse(line); err != nil {
+		return nil, err
+	}
+	return reader, nil
+}
+
+// ReadFrame reads the next frame, it returns io.EOF when there are no more frames.
+// The returned image is reused by the subsequent calls and is valid until the
+// next ReadFrame or Close call.
+func (r *Reader) ReadFrame() (*vpx.Image, error) {
+	if r.r == nil {
+		return nil, ErrReaderClosed
+	}
+	line, err := r.readLine()
+	if err != nil {
+		if err == io.ErrUnexpectedEOF {
+			return nil, ErrInvalidFrameHeader
+		}
+		return nil, err
+	}
+	if len(line) < len(frameMagic) || line[:len(frameMagic)] != frameMagic {
+		return nil, ErrInvalidFrameHeader
+	}
+	if r.buf == nil {
+		r.buf = make([]byte, r.Header.FrameSize())
+	}
+	if _, err := io.ReadFull(r.r, r.buf); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	if r.img == nil {
+		buf, err := vpx.AllocImage(r.Header.Format,
+			uint32(r.Header.Width), uint32(r.Header.Height), 32)
+		if err != nil {
+			return nil, err
+		}
+		r.imgBuf = buf
+		r.img, _ = buf.Image()
+		r.img.BitDepth = uint32(r.Header.BitDepth)
+		r.img.Update()
+	}
+	// high bit depth samples are stored as 16-bit little-endian values
+	// in both Y4M and vpx.Image, so rows are copied as is
+	bps := r.Header.bytesPerSample()
+	w, h := r.Header.planeSizes()
+	src := r.buf
+	for p := 0; p < 3; p++ {
+		rowSize := w[p] * bps
+		stride := int(r.img.Stride[p])
+		plane := (*[1 << 30]byte)(unsafe.Pointer(r.img.Planes[p]))
+		for y := 0; y < h[p]; y++ {
+			copy(plane[y*stride:y*stride+rowSize], src[:rowSize])
+			src = src[rowSize:]
+		}
+	}
+	return r.img, nil
+}
+
+// Close releases the image allocated by the reader, it does not close the underlying reader.
+func (r *Reader) Close() error {
+	if r.r == nil {
+		return ErrReaderClosed
+	}
+	if r.imgBuf != nil {
+		r.imgBuf.Close()
+		r.imgBuf, r.img = nil, nil
+	}
+	r.r = nil
+	return nil
+}
+
+func (r *Reader) readLine() (string, error) {
+	var line []byte
+	for {
+		c, err := r.r.ReadByte()
+		if err != nil {
+			if err == io.EOF && len(line) > 0 {
+				return "", io.ErrUnexpectedEOF
+			}
+			return "", err
+		}
+		if c == '\n' {
+			return string(line), nil
+		}
+		if len(line) >= maxHeaderLen {
+			return "", ErrInvalidHeader
+		}
+		line = append(line, c)
+	}
+}
@@ -0,0 +1,104 @@
+package y4m
+
+import (
+	"bufio"
+	"io"
+	"unsafe"
+
+	"github.com/xlab/libvpx-go/vpx"
+)
+
+// Writer writes vpx.Image frames into a Y4M stream without any conversion,
+// so decoded images can be compared against reference files bit-exactly.
+type Writer struct {
+	Header Header
+
+	w   *bufio.Writer
+	buf []byte
+}
+
+// NewWriter writes the stream header to w and returns a Writer ready to accept frames,
+// see HeaderForImage to derive the header from the first decoded image.
+func NewWriter(w io.Writer, h Header) (*Writer, error) {
+	if h.Interlace == 0 {
+		h.Interlace = 'p'
+	}
+	cs, ok := lookupColorspace(h.Colorspace)
+	if !ok {
+		return nil, ErrUnsupportedColorspace
+	}
+	h.Format = cs.format
+	h.BitDepth = cs.bitDepth
+	if h.Width <= 0 || h.Height <= 0 || h.FpsNum <= 0 || h.FpsDen <= 0 {
+		return nil, ErrInvalidHeader
+	}
+	writer := &Writer{
+		Header: h,
+		w:      bufio.NewWriter(w),
+	}
+	if _, err := writer.w.WriteString(h.String() + "\n"); err != nil {
+		return nil, err
+	}
+	return writer, writer.w.Flush()
+}
+
+// WriteFrame writes the visible area of the image, the image must have been
+// dereferenced and match the format, size and bit depth of the stream. High bit
+// depth images holding 8-bit samples (as produced by some decoders) are narrowed
+// losslessly for 8-bit streams.
+func (w *Writer) WriteFrame(img *vpx.Image) error {
+	if int(img.DW) != w.Header.Width || int(img.DH) != w.Header.Height {
+		return ErrFormatMismatch
+	}
+	format := img.Fmt
+	if format == vpx.ImageFormatYv12 {
+		format = vpx.ImageFormatI420
+	}
+	srcBps := 1
+	if format&vpx.ImageFormatHighbitdepth != 0 {
+		srcBps = 2
+	}
+	if format&^vpx.ImageFormatHighbitdepth != w.Header.Format&^vpx.ImageFormatHighbitdepth {
+		return ErrFormatMismatch
+	}
+	dstBps := w.Header.bytesPerSample()
+	if dstBps > srcBps {
+		return ErrFormatMismatch
+	}
+	bitDepth := 8
+	if srcBps == 2 {
+		bitDepth = int(img.BitDepth)
+	}
+	if bitDepth != w.Header.BitDepth {
+		// narrowing 10 or 12-bit samples would keep their low byte only
+		return ErrFormatMismatch
+	}
+	if w.buf == nil {
+		w.buf = make([]byte, w.Header.FrameSize())
+	}
+	width, height := w.Header.planeSizes()
+	dst := w.buf
+	for p := 0; p < 3; p++ {
+		stride := int(img.Stride[p])
+		plane := (*[1 << 30]byte)(unsafe.Pointer(img.Planes[p]))
+		for y := 0; y < height[p]; y++ {
+			row := plane[y*stride : y*stride+width[p]*srcBps]
+			if srcBps == dstBps {
+				copy(dst, row)
+			} else {
+				// 16-bit little-endian samples holding 8-bit values
+				for x := 0; x < width[p]; x++ {
+					dst[x] = row[2*x]
+				}
+			}
+			dst = dst[width[p]*dstBps:]
+		}
+	}
+	if _, err := w.w.WriteString(frameMagic + "\n"); err != nil {
+		return err
+	}
+	if _, err := w.w.Write(w.buf); err != nil {
+		return err
+	}
+	return w.w.Flush()
+}
@@ -0,0 +1,229 @@
+// Package y4m implements reading and writing of YUV4MPEG2 streams,
+// the raw video interchange format understood by vpxenc, vpxdec and most
+// of the video tooling, using vpx.Image as the frame representation.
+package y4m
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/xlab/libvpx-go/vpx"
+)
+
+const (
+	streamMagic = "YUV4MPEG2"
+	frameMagic  = "FRAME"
+
+	maxHeaderLen = 1024
+)
+
+var (
+	ErrInvalidHeader         = errors.New("y4m: invalid stream header")
+	ErrInvalidFrameHeader    = errors.New("y4m: invalid frame header")
+	ErrUnsupportedColorspace = errors.New("y4m: unsupported colorspace")
+	ErrFormatMismatch        = errors.New("y4m: image does not match the stream header")
+	ErrReaderClosed          = errors.New("y4m: reader is closed")
+)
+
+// Header holds the parameters of a Y4M stream.
+type Header struct {
+	Width  int
+	Height int
+	// FrameRate is FpsNum/FpsDen frames per second.
+	FpsNum int
+	FpsDen int
+	// Pixel aspect ratio, 0:0 means unknown.
+	AspectNum int
+	AspectDen int
+	// Interlace is one of 'p' (progressive), 't' (top field first),
+	// 'b' (bottom field first) or 'm' (mixed).
+	Interlace byte
+	// Colorspace is the value of the C tag, e.g. "420jpeg" or "422p10".
+	Colorspace string
+	// Format and BitDepth are derived from Colorspace.
+	Format   vpx.ImageFormat
+	BitDepth int
+	// Comments holds the X tags of the header.
+	Comments []string
+}
+
+type colorspace struct {
+	name     string
+	format   vpx.ImageFormat
+	bitDepth int
+}
+
+var colorspaces = []colorspace{
+	{"420jpeg", vpx.ImageFormatI420, 8},
+	{"420mpeg2", vpx.ImageFormatI420, 8},
+	{"420paldv", vpx.ImageFormatI420, 8},
+	{"420", vpx.ImageFormatI420, 8},
+	{"422", vpx.ImageFormatI422, 8},
+	{"444", vpx.ImageFormatI444, 8},
+	{"440", vpx.ImageFormatI440, 8},
+	{"420p10", vpx.ImageFormatI42016, 10},
+	{"420p12", vpx.ImageFormatI42016, 12},
+	{"422p10", vpx.ImageFormatI42216, 10},
+	{"422p12", vpx.ImageFormatI42216, 12},
+	{"444p10", vpx.ImageFormatI44416, 10},
+	{"444p12", vpx.ImageFormatI44416, 12},
+	{"440p10", vpx.ImageFormatI44016, 10},
+	{"440p12", vpx.ImageFormatI44016, 12},
+}
+
+func lookupColorspace(name string) (colorspace, bool) {
+	for _, cs := range colorspaces {
+		if cs.name == name {
+			return cs, true
+		}
+	}
+	return colorspace{}, false
+}
+
+// colorspaceName returns the name of the C tag for the image format and bit depth.
+func colorspaceName(format vpx.ImageFormat, bitDepth int) (string, bool) {
+	if format == vpx.ImageFormatYv12 {
+		format = vpx.ImageFormatI420
+	}
+	if bitDepth <= 8 {
+		format &^= vpx.ImageFormatHighbitdepth
+		bitDepth = 8
+	}
+	for _, cs := range colorspaces {
+		if cs.format == format && cs.bitDepth == bitDepth {
+			return cs.name, true
+		}
+	}
+	return "", false
+}
+
+// HeaderForImage returns the header of a stream that holds images of the same
+// format as img, at the given frame rate.
+func HeaderForImage(img *vpx.Image, fpsNum, fpsDen int) (Header, error) {
+	bitDepth := int(img.BitDepth)
+	if img.Fmt&vpx.ImageFormatHighbitdepth == 0 {
+		bitDepth = 8
+	}
+	name, ok := colorspaceName(img.Fmt, bitDepth)
+	if !ok {
+		return Header{}, ErrUnsupportedColorspace
+	}
+	h := Header{
+		Width:      int(img.DW),
+		Height:     int(img.DH),
+		FpsNum:     fpsNum,
+		FpsDen:     fpsDen,
+		AspectNum:  1,
+		AspectDen:  1,
+		Interlace:  'p',
+		Colorspace: name,
+	}
+	cs, _ := lookupColorspace(name)
+	h.Format = cs.format
+	h.BitDepth = cs.bitDepth
+	return h, nil
+}
+
+func (h *Header) parse(line string) error {
+	fields := strings.Fields(line)
+	if len(fields) == 0 || fields[0] != streamMagic {
+		return ErrInvalidHeader
+	}
+	h.Interlace = 'p'
+	h.Colorspace = "420jpeg"
+	for _, field := range fields[1:] {
+		tag, value := field[0], field[1:]
+		var err error
+		switch tag {
+		case 'W':
+			h.Width, err = strconv.Atoi(value)
+		case 'H':
+			h.Height, err = strconv.Atoi(value)
+		case 'F':
+			h.FpsNum, h.FpsDen, err = parseRatio(value)
+		case 'A':
+			h.AspectNum, h.AspectDen, err = parseRatio(value)
+		case 'I':
+			if len(value) != 1 {
+				err = ErrInvalidHeader
+				break
+			}
+			h.Interlace = value[0]
+		case 'C':
+			h.Colorspace = value
+		case 'X':
+			h.Comments = append(h.Comments, value)
+		}
+		if err != nil {
+			return fmt.Errorf("y4m: invalid %c tag: %q", tag, value)
+		}
+	}
+	if h.Width <= 0 || h.Height <= 0 || h.FpsNum <= 0 || h.FpsDen <= 0 {
+		return ErrInvalidHeader
+	}
+	cs, ok := lookupColorspace(h.Colorspace)
+	if !ok {
+		return ErrUnsupportedColorspace
+	}
+	h.Format = cs.format
+	h.BitDepth = cs.bitDepth
+	return nil
+}
+
+func (h *Header) String() string {
+	buf := fmt.Sprintf("%s W%d H%d F%d:%d I%c A%d:%d C%s", streamMagic,
+		h.Width, h.Height, h.FpsNum, h.FpsDen, h.Interlace, h.AspectNum, h.AspectDen, h.Colorspace)
+	for _, comment := range h.Comments {
+		buf += " X" + comment
+	}
+	return buf
+}
+
+func parseRatio(v string) (int, int, error) {
+	parts := strings.SplitN(v, ":", 2)
+	if len(parts) != 2 {
+		return 0, 0, ErrInvalidHeader
+	}
+	num, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, 0, err
+	}
+	den, err := strconv.Atoi(parts[1])
+	if err != nil {
+		return 0, 0, err
+	}
+	return num, den, nil
+}
+
+// planeSizes returns width and height of each plane in samples.
+func (h *Header) planeSizes() (w, hh [3]int) {
+	cw, ch := h.Width, h.Height
+	switch h.Format &^ vpx.ImageFormatHighbitdepth {
+	case vpx.ImageFormatI420:
+		cw, ch = (h.Width+1)/2, (h.Height+1)/2
+	case vpx.ImageFormatI422:
+		cw = (h.Width + 1) / 2
+	case vpx.ImageFormatI440:
+		ch = (h.Height + 1) / 2
+	}
+	return [3]int{h.Width, cw, cw}, [3]int{h.Height, ch, ch}
+}
+
+func (h *Header) bytesPerSample() int {
+	if h.BitDepth > 8 {
+		return 2
+	}
+	return 1
+}
+
+// FrameSize returns the size of the frame payload in bytes.
+func (h *Header) FrameSize() int {
+	w, hh := h.planeSizes()
+	var size int
+	for p := 0; p < 3; p++ {
+		size += w[p] * hh[p]
+	}
+	return size * h.bytesPerSample()
+}